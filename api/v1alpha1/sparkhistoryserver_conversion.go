@@ -0,0 +1,465 @@
+/*
+Copyright 2023 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"slices"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/zncdatadev/spark-k8s-operator/api/v1beta1"
+)
+
+var _ conversion.Convertible = &SparkHistoryServer{}
+
+// ConvertTo converts the SparkHistoryServer to the hub version v1beta1.
+func (src *SparkHistoryServer) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.SparkHistoryServer)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = specToHub(&src.Spec)
+	dst.Status = v1beta1.SparkHistoryServerStatus{
+		Status: *src.Status.Status.DeepCopy(),
+		URLs:   slices.Clone(src.Status.URLs),
+	}
+	return nil
+}
+
+// ConvertFrom converts the hub version v1beta1 to this version.
+func (dst *SparkHistoryServer) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.SparkHistoryServer)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = specFromHub(&src.Spec)
+	dst.Status = SparkHistoryServerStatus{
+		Status: *src.Status.Status.DeepCopy(),
+		URLs:   slices.Clone(src.Status.URLs),
+	}
+	return nil
+}
+
+// The fields are converted explicitly. The structs which are the same in both versions are converted
+// with a type conversion, so a field added to only one version fails to compile. The structs are deep
+// copied first, the converted object does not share maps or slices with the source.
+
+// convertPtr converts a pointer to a struct with the given conversion, nil is kept.
+func convertPtr[S, D any](src *S, convert func(*S) D) *D {
+	if src == nil {
+		return nil
+	}
+	dst := convert(src)
+	return &dst
+}
+
+// convertSlice converts a slice with the given conversion, nil is kept.
+func convertSlice[S, D any](src []S, convert func(*S) D) []D {
+	if src == nil {
+		return nil
+	}
+	dst := make([]D, 0, len(src))
+	for i := range src {
+		dst = append(dst, convert(&src[i]))
+	}
+	return dst
+}
+
+// derefOrZero returns the value of a required field of v1alpha1, which is a value in v1beta1.
+func derefOrZero[T any](src *T) *T {
+	if src == nil {
+		return new(T)
+	}
+	return src
+}
+
+func specToHub(src *SparkHistoryServerSpec) v1beta1.SparkHistoryServerSpec {
+	return v1beta1.SparkHistoryServerSpec{
+		Image:            convertPtr(src.Image, func(s *ImageSpec) v1beta1.ImageSpec { return v1beta1.ImageSpec(*s.DeepCopy()) }),
+		ClusterConfig:    clusterConfigToHub(derefOrZero(src.ClusterConfig)),
+		ClusterOperation: src.ClusterOperation.DeepCopy(),
+		Node:             roleToHub(derefOrZero(src.Node)),
+		DeletionPolicy:   v1beta1.DeletionPolicy(src.DeletionPolicy),
+		Cleanup:          convertPtr(src.Cleanup, func(s *CleanupSpec) v1beta1.CleanupSpec { return v1beta1.CleanupSpec(*s) }),
+	}
+}
+
+func specFromHub(src *v1beta1.SparkHistoryServerSpec) SparkHistoryServerSpec {
+	return SparkHistoryServerSpec{
+		Image:            convertPtr(src.Image, func(s *v1beta1.ImageSpec) ImageSpec { return ImageSpec(*s.DeepCopy()) }),
+		ClusterConfig:    convertPtr(&src.ClusterConfig, clusterConfigFromHub),
+		ClusterOperation: src.ClusterOperation.DeepCopy(),
+		Node:             convertPtr(&src.Node, roleFromHub),
+		DeletionPolicy:   string(src.DeletionPolicy),
+		Cleanup:          convertPtr(src.Cleanup, func(s *v1beta1.CleanupSpec) CleanupSpec { return CleanupSpec(*s) }),
+	}
+}
+
+func clusterConfigToHub(src *ClusterConfigSpec) v1beta1.ClusterConfigSpec {
+	return v1beta1.ClusterConfigSpec{
+		Authentication: convertPtr(src.Authentication, authenticationToHub),
+		Authorization: convertPtr(src.Authorization, func(s *AuthorizationSpec) v1beta1.AuthorizationSpec {
+			return v1beta1.AuthorizationSpec(*s.DeepCopy())
+		}),
+		Kerberos:   convertPtr(src.Kerberos, func(s *KerberosSpec) v1beta1.KerberosSpec { return v1beta1.KerberosSpec(*s) }),
+		Monitoring: convertPtr(src.Monitoring, monitoringToHub),
+		NetworkPolicy: convertPtr(src.NetworkPolicy, func(s *NetworkPolicySpec) v1beta1.NetworkPolicySpec {
+			return v1beta1.NetworkPolicySpec(*s.DeepCopy())
+		}),
+		LogFileDirectory:              logFileDirectoryToHub(derefOrZero(src.LogFileDirectory)),
+		ListenerClass:                 v1beta1.ListenerClass(src.ListenerClass),
+		VectorAggregatorConfigMapName: src.VectorAggregatorConfigMapName,
+		ExtraJars:                     convertSlice(src.ExtraJars, extraJarToHub),
+	}
+}
+
+func clusterConfigFromHub(src *v1beta1.ClusterConfigSpec) ClusterConfigSpec {
+	return ClusterConfigSpec{
+		Authentication: convertPtr(src.Authentication, authenticationFromHub),
+		Authorization: convertPtr(src.Authorization, func(s *v1beta1.AuthorizationSpec) AuthorizationSpec {
+			return AuthorizationSpec(*s.DeepCopy())
+		}),
+		Kerberos:   convertPtr(src.Kerberos, func(s *v1beta1.KerberosSpec) KerberosSpec { return KerberosSpec(*s) }),
+		Monitoring: convertPtr(src.Monitoring, monitoringFromHub),
+		NetworkPolicy: convertPtr(src.NetworkPolicy, func(s *v1beta1.NetworkPolicySpec) NetworkPolicySpec {
+			return NetworkPolicySpec(*s.DeepCopy())
+		}),
+		LogFileDirectory:              convertPtr(&src.LogFileDirectory, logFileDirectoryFromHub),
+		ListenerClass:                 string(src.ListenerClass),
+		VectorAggregatorConfigMapName: src.VectorAggregatorConfigMapName,
+		ExtraJars:                     convertSlice(src.ExtraJars, extraJarFromHub),
+	}
+}
+
+func authenticationToHub(src *AuthenticationSpec) v1beta1.AuthenticationSpec {
+	return v1beta1.AuthenticationSpec{
+		AuthenticationClass: src.AuthenticationClass,
+		Oidc:                convertPtr(src.Oidc, func(s *OidcSpec) v1beta1.OidcSpec { return v1beta1.OidcSpec(*s.DeepCopy()) }),
+	}
+}
+
+func authenticationFromHub(src *v1beta1.AuthenticationSpec) AuthenticationSpec {
+	return AuthenticationSpec{
+		AuthenticationClass: src.AuthenticationClass,
+		Oidc:                convertPtr(src.Oidc, func(s *v1beta1.OidcSpec) OidcSpec { return OidcSpec(*s.DeepCopy()) }),
+	}
+}
+
+// logFileDirectoryToHub converts the log directory to the union of v1beta1, which names its only member
+// by the type. v1alpha1 does not validate that a single member is set, the member with the highest
+// precedence is kept and the others are dropped, the controller rejects such a log directory anyway.
+func logFileDirectoryToHub(src *LogFileDirectorySpec) v1beta1.LogFileDirectorySpec {
+	switch {
+	case src.S3 != nil:
+		return v1beta1.LogFileDirectorySpec{
+			Type: v1beta1.LogFileDirectoryTypeS3,
+			S3: &v1beta1.S3Spec{
+				Bucket: v1beta1.BucketSpec(*derefOrZero(src.S3.Bucket).DeepCopy()),
+				Prefix: src.S3.Prefix,
+			},
+		}
+	case src.ABFS != nil:
+		return v1beta1.LogFileDirectorySpec{
+			Type: v1beta1.LogFileDirectoryTypeABFS,
+			ABFS: &v1beta1.ABFSSpec{
+				Account:        src.ABFS.Account,
+				Container:      src.ABFS.Container,
+				Prefix:         src.ABFS.Prefix,
+				EndpointSuffix: src.ABFS.EndpointSuffix,
+				Credentials:    *derefOrZero(src.ABFS.Credentials).DeepCopy(),
+			},
+		}
+	case src.GCS != nil:
+		return v1beta1.LogFileDirectorySpec{
+			Type: v1beta1.LogFileDirectoryTypeGCS,
+			GCS: &v1beta1.GCSSpec{
+				Bucket:      src.GCS.Bucket,
+				Prefix:      src.GCS.Prefix,
+				Credentials: *derefOrZero(src.GCS.Credentials).DeepCopy(),
+			},
+		}
+	}
+	return v1beta1.LogFileDirectorySpec{}
+}
+
+func logFileDirectoryFromHub(src *v1beta1.LogFileDirectorySpec) LogFileDirectorySpec {
+	return LogFileDirectorySpec{
+		S3: convertPtr(src.S3, func(s *v1beta1.S3Spec) S3Spec {
+			return S3Spec{
+				Bucket: convertPtr(&s.Bucket, bucketFromHub),
+				Prefix: s.Prefix,
+			}
+		}),
+		ABFS: convertPtr(src.ABFS, func(s *v1beta1.ABFSSpec) ABFSSpec {
+			return ABFSSpec{
+				Account:        s.Account,
+				Container:      s.Container,
+				Prefix:         s.Prefix,
+				EndpointSuffix: s.EndpointSuffix,
+				Credentials:    s.Credentials.DeepCopy(),
+			}
+		}),
+		GCS: convertPtr(src.GCS, func(s *v1beta1.GCSSpec) GCSSpec {
+			return GCSSpec{
+				Bucket:      s.Bucket,
+				Prefix:      s.Prefix,
+				Credentials: s.Credentials.DeepCopy(),
+			}
+		}),
+	}
+}
+
+func bucketFromHub(src *v1beta1.BucketSpec) BucketSpec {
+	return BucketSpec(*src.DeepCopy())
+}
+
+func extraJarToHub(src *ExtraJarSpec) v1beta1.ExtraJarSpec {
+	return v1beta1.ExtraJarSpec{
+		S3: convertPtr(src.S3, func(s *ExtraJarS3Spec) v1beta1.ExtraJarS3Spec {
+			return v1beta1.ExtraJarS3Spec{
+				Bucket: v1beta1.BucketSpec(*derefOrZero(s.Bucket).DeepCopy()),
+				Key:    s.Key,
+			}
+		}),
+		HTTP: convertPtr(src.HTTP, func(s *ExtraJarHTTPSpec) v1beta1.ExtraJarHTTPSpec { return v1beta1.ExtraJarHTTPSpec(*s) }),
+		OCI:  convertPtr(src.OCI, func(s *ExtraJarOCISpec) v1beta1.ExtraJarOCISpec { return v1beta1.ExtraJarOCISpec(*s) }),
+	}
+}
+
+func extraJarFromHub(src *v1beta1.ExtraJarSpec) ExtraJarSpec {
+	return ExtraJarSpec{
+		S3: convertPtr(src.S3, func(s *v1beta1.ExtraJarS3Spec) ExtraJarS3Spec {
+			return ExtraJarS3Spec{
+				Bucket: convertPtr(&s.Bucket, bucketFromHub),
+				Key:    s.Key,
+			}
+		}),
+		HTTP: convertPtr(src.HTTP, func(s *v1beta1.ExtraJarHTTPSpec) ExtraJarHTTPSpec { return ExtraJarHTTPSpec(*s) }),
+		OCI:  convertPtr(src.OCI, func(s *v1beta1.ExtraJarOCISpec) ExtraJarOCISpec { return ExtraJarOCISpec(*s) }),
+	}
+}
+
+func monitoringToHub(src *MonitoringSpec) v1beta1.MonitoringSpec {
+	return v1beta1.MonitoringSpec{
+		Monitor: convertPtr(src.Monitor, func(s *MonitorSpec) v1beta1.MonitorSpec {
+			s = s.DeepCopy()
+			return v1beta1.MonitorSpec{
+				Kind:          s.Kind,
+				Labels:        s.Labels,
+				Interval:      s.Interval,
+				ScrapeTimeout: s.ScrapeTimeout,
+				Relabelings: convertSlice(s.Relabelings, func(r *RelabelConfig) v1beta1.RelabelConfig {
+					return v1beta1.RelabelConfig(*r)
+				}),
+				MetricRelabelings: convertSlice(s.MetricRelabelings, func(r *RelabelConfig) v1beta1.RelabelConfig {
+					return v1beta1.RelabelConfig(*r)
+				}),
+				Scheme: s.Scheme,
+				TLSConfig: convertPtr(s.TLSConfig, func(t *MonitorTLSConfig) v1beta1.MonitorTLSConfig {
+					return v1beta1.MonitorTLSConfig(*t)
+				}),
+				BearerTokenSecret: s.BearerTokenSecret,
+			}
+		}),
+		PrometheusRule: convertPtr(src.PrometheusRule, func(s *PrometheusRuleSpec) v1beta1.PrometheusRuleSpec {
+			return v1beta1.PrometheusRuleSpec(*s.DeepCopy())
+		}),
+		JmxExporter: convertPtr(src.JmxExporter, func(s *JmxExporterSpec) v1beta1.JmxExporterSpec {
+			return v1beta1.JmxExporterSpec{
+				Rules: convertSlice(s.DeepCopy().Rules, func(r *JmxExporterRule) v1beta1.JmxExporterRule {
+					return v1beta1.JmxExporterRule(*r)
+				}),
+			}
+		}),
+		GrafanaDashboard: convertPtr(src.GrafanaDashboard, func(s *GrafanaDashboardSpec) v1beta1.GrafanaDashboardSpec {
+			return v1beta1.GrafanaDashboardSpec(*s.DeepCopy())
+		}),
+	}
+}
+
+func monitoringFromHub(src *v1beta1.MonitoringSpec) MonitoringSpec {
+	return MonitoringSpec{
+		Monitor: convertPtr(src.Monitor, func(s *v1beta1.MonitorSpec) MonitorSpec {
+			s = s.DeepCopy()
+			return MonitorSpec{
+				Kind:          s.Kind,
+				Labels:        s.Labels,
+				Interval:      s.Interval,
+				ScrapeTimeout: s.ScrapeTimeout,
+				Relabelings: convertSlice(s.Relabelings, func(r *v1beta1.RelabelConfig) RelabelConfig {
+					return RelabelConfig(*r)
+				}),
+				MetricRelabelings: convertSlice(s.MetricRelabelings, func(r *v1beta1.RelabelConfig) RelabelConfig {
+					return RelabelConfig(*r)
+				}),
+				Scheme: s.Scheme,
+				TLSConfig: convertPtr(s.TLSConfig, func(t *v1beta1.MonitorTLSConfig) MonitorTLSConfig {
+					return MonitorTLSConfig(*t)
+				}),
+				BearerTokenSecret: s.BearerTokenSecret,
+			}
+		}),
+		PrometheusRule: convertPtr(src.PrometheusRule, func(s *v1beta1.PrometheusRuleSpec) PrometheusRuleSpec {
+			return PrometheusRuleSpec(*s.DeepCopy())
+		}),
+		JmxExporter: convertPtr(src.JmxExporter, func(s *v1beta1.JmxExporterSpec) JmxExporterSpec {
+			return JmxExporterSpec{
+				Rules: convertSlice(s.DeepCopy().Rules, func(r *v1beta1.JmxExporterRule) JmxExporterRule {
+					return JmxExporterRule(*r)
+				}),
+			}
+		}),
+		GrafanaDashboard: convertPtr(src.GrafanaDashboard, func(s *v1beta1.GrafanaDashboardSpec) GrafanaDashboardSpec {
+			return GrafanaDashboardSpec(*s.DeepCopy())
+		}),
+	}
+}
+
+func roleToHub(src *RoleSpec) v1beta1.RoleSpec {
+	var roleGroups map[string]*v1beta1.RoleGroupSpec
+	if src.RoleGroups != nil {
+		roleGroups = make(map[string]*v1beta1.RoleGroupSpec, len(src.RoleGroups))
+		for name, roleGroup := range src.RoleGroups {
+			roleGroups[name] = convertPtr(roleGroup, roleGroupToHub)
+		}
+	}
+	return v1beta1.RoleSpec{
+		OverridesSpec: src.OverridesSpec.DeepCopy(),
+		Config:        convertPtr(src.Config, configToHub),
+		RoleGroups:    roleGroups,
+		RoleConfig:    src.RoleConfig.DeepCopy(),
+	}
+}
+
+func roleFromHub(src *v1beta1.RoleSpec) RoleSpec {
+	var roleGroups map[string]*RoleGroupSpec
+	if src.RoleGroups != nil {
+		roleGroups = make(map[string]*RoleGroupSpec, len(src.RoleGroups))
+		for name, roleGroup := range src.RoleGroups {
+			roleGroups[name] = convertPtr(roleGroup, roleGroupFromHub)
+		}
+	}
+	return RoleSpec{
+		OverridesSpec: src.OverridesSpec.DeepCopy(),
+		Config:        convertPtr(src.Config, configFromHub),
+		RoleGroups:    roleGroups,
+		RoleConfig:    src.RoleConfig.DeepCopy(),
+	}
+}
+
+func roleGroupToHub(src *RoleGroupSpec) v1beta1.RoleGroupSpec {
+	return v1beta1.RoleGroupSpec{
+		OverridesSpec: src.OverridesSpec.DeepCopy(),
+		Replicas:      copyPtr(src.Replicas),
+		Config:        convertPtr(src.Config, configToHub),
+	}
+}
+
+func roleGroupFromHub(src *v1beta1.RoleGroupSpec) RoleGroupSpec {
+	return RoleGroupSpec{
+		OverridesSpec: src.OverridesSpec.DeepCopy(),
+		Replicas:      copyPtr(src.Replicas),
+		Config:        convertPtr(src.Config, configFromHub),
+	}
+}
+
+// copyPtr returns a copy of a pointer to a value, nil is kept.
+func copyPtr[T any](src *T) *T {
+	if src == nil {
+		return nil
+	}
+	dst := *src
+	return &dst
+}
+
+func configToHub(src *ConfigSpec) v1beta1.ConfigSpec {
+	return v1beta1.ConfigSpec{
+		RoleGroupConfigSpec: src.RoleGroupConfigSpec.DeepCopy(),
+		Cleaner:             copyPtr(src.Cleaner),
+		Probes: convertPtr(src.Probes, func(s *ProbesSpec) v1beta1.ProbesSpec {
+			s = s.DeepCopy()
+			return v1beta1.ProbesSpec{
+				Startup:   convertPtr(s.Startup, func(p *ProbeSpec) v1beta1.ProbeSpec { return v1beta1.ProbeSpec(*p) }),
+				Readiness: convertPtr(s.Readiness, func(p *ProbeSpec) v1beta1.ProbeSpec { return v1beta1.ProbeSpec(*p) }),
+				Liveness:  convertPtr(s.Liveness, func(p *ProbeSpec) v1beta1.ProbeSpec { return v1beta1.ProbeSpec(*p) }),
+			}
+		}),
+		Ingress: convertPtr(src.Ingress, func(s *IngressSpec) v1beta1.IngressSpec {
+			s = s.DeepCopy()
+			return v1beta1.IngressSpec{
+				Kind:             v1beta1.IngressKind(s.Kind),
+				Hosts:            s.Hosts,
+				Path:             s.Path,
+				TLSSecretName:    s.TLSSecretName,
+				Scheme:           s.Scheme,
+				IngressClassName: s.IngressClassName,
+				ParentRefs: convertSlice(s.ParentRefs, func(r *GatewayParentRef) v1beta1.GatewayParentRef {
+					return v1beta1.GatewayParentRef(*r)
+				}),
+				Annotations: s.Annotations,
+			}
+		}),
+		Autoscaling: convertPtr(src.Autoscaling, func(s *AutoscalingSpec) v1beta1.AutoscalingSpec {
+			return v1beta1.AutoscalingSpec(*s.DeepCopy())
+		}),
+		SessionAffinity: convertPtr(src.SessionAffinity, func(s *SessionAffinitySpec) v1beta1.SessionAffinitySpec {
+			return v1beta1.SessionAffinitySpec{
+				Mode:           v1beta1.SessionAffinityMode(s.Mode),
+				TimeoutSeconds: copyPtr(s.TimeoutSeconds),
+				CookieName:     s.CookieName,
+			}
+		}),
+	}
+}
+
+func configFromHub(src *v1beta1.ConfigSpec) ConfigSpec {
+	return ConfigSpec{
+		RoleGroupConfigSpec: src.RoleGroupConfigSpec.DeepCopy(),
+		Cleaner:             copyPtr(src.Cleaner),
+		Probes: convertPtr(src.Probes, func(s *v1beta1.ProbesSpec) ProbesSpec {
+			s = s.DeepCopy()
+			return ProbesSpec{
+				Startup:   convertPtr(s.Startup, func(p *v1beta1.ProbeSpec) ProbeSpec { return ProbeSpec(*p) }),
+				Readiness: convertPtr(s.Readiness, func(p *v1beta1.ProbeSpec) ProbeSpec { return ProbeSpec(*p) }),
+				Liveness:  convertPtr(s.Liveness, func(p *v1beta1.ProbeSpec) ProbeSpec { return ProbeSpec(*p) }),
+			}
+		}),
+		Ingress: convertPtr(src.Ingress, func(s *v1beta1.IngressSpec) IngressSpec {
+			s = s.DeepCopy()
+			return IngressSpec{
+				Kind:             string(s.Kind),
+				Hosts:            s.Hosts,
+				Path:             s.Path,
+				TLSSecretName:    s.TLSSecretName,
+				Scheme:           s.Scheme,
+				IngressClassName: s.IngressClassName,
+				ParentRefs: convertSlice(s.ParentRefs, func(r *v1beta1.GatewayParentRef) GatewayParentRef {
+					return GatewayParentRef(*r)
+				}),
+				Annotations: s.Annotations,
+			}
+		}),
+		Autoscaling: convertPtr(src.Autoscaling, func(s *v1beta1.AutoscalingSpec) AutoscalingSpec {
+			return AutoscalingSpec(*s.DeepCopy())
+		}),
+		SessionAffinity: convertPtr(src.SessionAffinity, func(s *v1beta1.SessionAffinitySpec) SessionAffinitySpec {
+			return SessionAffinitySpec{
+				Mode:           string(s.Mode),
+				TimeoutSeconds: copyPtr(s.TimeoutSeconds),
+				CookieName:     s.CookieName,
+			}
+		}),
+	}
+}
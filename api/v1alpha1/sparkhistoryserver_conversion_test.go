@@ -0,0 +1,232 @@
+/*
+Copyright 2023 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/apitesting/fuzzer"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metafuzzer "k8s.io/apimachinery/pkg/apis/meta/fuzzer"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"sigs.k8s.io/randfill"
+
+	"github.com/zncdatadev/spark-k8s-operator/api/v1beta1"
+)
+
+const fuzzIterations = 1000
+
+// conversionFuzzerFuncs keeps the fuzzed objects valid for the schema: the required fields of
+// v1alpha1 are set and the log directory has a single member, named by the type in v1beta1.
+func conversionFuzzerFuncs(_ serializer.CodecFactory) []any {
+	return []any{
+		func(spec *SparkHistoryServerSpec, c randfill.Continue) {
+			c.FillNoCustom(spec)
+			if spec.ClusterConfig == nil {
+				spec.ClusterConfig = &ClusterConfigSpec{}
+			}
+			if spec.Node == nil {
+				spec.Node = &RoleSpec{}
+			}
+		},
+		func(config *ClusterConfigSpec, c randfill.Continue) {
+			c.FillNoCustom(config)
+			if config.LogFileDirectory == nil {
+				config.LogFileDirectory = &LogFileDirectorySpec{}
+			}
+		},
+		func(s3 *S3Spec, c randfill.Continue) {
+			c.FillNoCustom(s3)
+			if s3.Bucket == nil {
+				s3.Bucket = &BucketSpec{}
+			}
+		},
+		func(abfs *ABFSSpec, c randfill.Continue) {
+			c.FillNoCustom(abfs)
+			if abfs.Credentials == nil {
+				abfs.Credentials = &commonsv1alpha1.Credentials{}
+			}
+		},
+		func(gcs *GCSSpec, c randfill.Continue) {
+			c.FillNoCustom(gcs)
+			if gcs.Credentials == nil {
+				gcs.Credentials = &commonsv1alpha1.Credentials{}
+			}
+		},
+		func(directory *LogFileDirectorySpec, c randfill.Continue) {
+			// a single member is set, the type of v1beta1 can not name several members
+			*directory = LogFileDirectorySpec{}
+			switch c.Intn(3) {
+			case 0:
+				directory.S3 = &S3Spec{}
+				c.Fill(directory.S3)
+			case 1:
+				directory.ABFS = &ABFSSpec{}
+				c.Fill(directory.ABFS)
+			case 2:
+				directory.GCS = &GCSSpec{}
+				c.Fill(directory.GCS)
+			}
+		},
+		func(jar *ExtraJarS3Spec, c randfill.Continue) {
+			c.FillNoCustom(jar)
+			if jar.Bucket == nil {
+				jar.Bucket = &BucketSpec{}
+			}
+		},
+		func(directory *v1beta1.LogFileDirectorySpec, c randfill.Continue) {
+			*directory = v1beta1.LogFileDirectorySpec{}
+			switch c.Intn(3) {
+			case 0:
+				directory.Type = v1beta1.LogFileDirectoryTypeS3
+				directory.S3 = &v1beta1.S3Spec{}
+				c.Fill(directory.S3)
+			case 1:
+				directory.Type = v1beta1.LogFileDirectoryTypeABFS
+				directory.ABFS = &v1beta1.ABFSSpec{}
+				c.Fill(directory.ABFS)
+			case 2:
+				directory.Type = v1beta1.LogFileDirectoryTypeGCS
+				directory.GCS = &v1beta1.GCSSpec{}
+				c.Fill(directory.GCS)
+			}
+		},
+	}
+}
+
+// multiMemberFuzzerFuncs sets any of the members of the log directory, v1alpha1 does not validate that a
+// single member is set.
+func multiMemberFuzzerFuncs(_ serializer.CodecFactory) []any {
+	return []any{
+		func(directory *LogFileDirectorySpec, c randfill.Continue) {
+			*directory = LogFileDirectorySpec{}
+			if c.Bool() {
+				directory.S3 = &S3Spec{}
+				c.Fill(directory.S3)
+			}
+			if c.Bool() {
+				directory.ABFS = &ABFSSpec{}
+				c.Fill(directory.ABFS)
+			}
+			if c.Bool() {
+				directory.GCS = &GCSSpec{}
+				c.Fill(directory.GCS)
+			}
+		},
+	}
+}
+
+func newConversionFuzzer(t *testing.T, seed int64, funcs ...fuzzer.FuzzerFuncs) *randfill.Filler {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	funcs = append([]fuzzer.FuzzerFuncs{metafuzzer.Funcs, conversionFuzzerFuncs}, funcs...)
+	return fuzzer.FuzzerFor(fuzzer.MergeFuzzerFuncs(funcs...), rand.NewSource(seed), serializer.NewCodecFactory(scheme))
+}
+
+func TestSpokeHubSpokeRoundTrip(t *testing.T) {
+	f := newConversionFuzzer(t, 1)
+	for range fuzzIterations {
+		src := &SparkHistoryServer{}
+		f.Fill(src)
+
+		hub := &v1beta1.SparkHistoryServer{}
+		if err := src.ConvertTo(hub); err != nil {
+			t.Fatalf("ConvertTo() error = %v", err)
+		}
+		dst := &SparkHistoryServer{}
+		if err := dst.ConvertFrom(hub); err != nil {
+			t.Fatalf("ConvertFrom() error = %v", err)
+		}
+
+		// the type meta is set by the API server
+		dst.TypeMeta = src.TypeMeta
+		if !apiequality.Semantic.DeepEqual(src, dst) {
+			t.Fatalf("v1alpha1 -> v1beta1 -> v1alpha1 is not lossless:\n%s", cmp.Diff(src, dst))
+		}
+	}
+}
+
+func TestHubSpokeHubRoundTrip(t *testing.T) {
+	f := newConversionFuzzer(t, 2)
+	for range fuzzIterations {
+		src := &v1beta1.SparkHistoryServer{}
+		f.Fill(src)
+
+		spoke := &SparkHistoryServer{}
+		if err := spoke.ConvertFrom(src); err != nil {
+			t.Fatalf("ConvertFrom() error = %v", err)
+		}
+		dst := &v1beta1.SparkHistoryServer{}
+		if err := spoke.ConvertTo(dst); err != nil {
+			t.Fatalf("ConvertTo() error = %v", err)
+		}
+
+		dst.TypeMeta = src.TypeMeta
+		if !apiequality.Semantic.DeepEqual(src, dst) {
+			t.Fatalf("v1beta1 -> v1alpha1 -> v1beta1 is not lossless:\n%s", cmp.Diff(src, dst))
+		}
+	}
+}
+
+// TestConvertMultiMemberLogFileDirectory checks that a log directory with several members converts to a
+// valid union, the member named by the type is the only member set.
+func TestConvertMultiMemberLogFileDirectory(t *testing.T) {
+	f := newConversionFuzzer(t, 3, multiMemberFuzzerFuncs)
+	for range fuzzIterations {
+		src := &SparkHistoryServer{}
+		f.Fill(src)
+
+		hub := &v1beta1.SparkHistoryServer{}
+		if err := src.ConvertTo(hub); err != nil {
+			t.Fatalf("ConvertTo() error = %v", err)
+		}
+
+		directory, members := src.Spec.ClusterConfig.LogFileDirectory, hub.Spec.ClusterConfig.LogFileDirectory
+		var want v1beta1.LogFileDirectoryType
+		switch {
+		case directory.S3 != nil:
+			want = v1beta1.LogFileDirectoryTypeS3
+		case directory.ABFS != nil:
+			want = v1beta1.LogFileDirectoryTypeABFS
+		case directory.GCS != nil:
+			want = v1beta1.LogFileDirectoryTypeGCS
+		}
+		set := map[v1beta1.LogFileDirectoryType]bool{
+			v1beta1.LogFileDirectoryTypeS3:   members.S3 != nil,
+			v1beta1.LogFileDirectoryTypeABFS: members.ABFS != nil,
+			v1beta1.LogFileDirectoryTypeGCS:  members.GCS != nil,
+		}
+		for member, ok := range set {
+			if ok != (member == members.Type) {
+				t.Fatalf("log directory of type %q has member %s set = %v, want only the member of the type", members.Type, member, ok)
+			}
+		}
+		if members.Type != want {
+			t.Fatalf("Type = %q, want %q", members.Type, want)
+		}
+	}
+}
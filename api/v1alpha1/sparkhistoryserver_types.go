@@ -20,7 +20,9 @@ import (
 	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
 	s3v1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/s3/v1alpha1"
 	"github.com/zncdatadev/operator-go/pkg/status"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -33,6 +35,7 @@ const (
 // https://book.kubebuilder.io/reference/generating-crd
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:storageversion
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // SparkHistoryServer is the Schema for the sparkhistoryservers API
@@ -40,8 +43,16 @@ type SparkHistoryServer struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec   SparkHistoryServerSpec `json:"spec,omitempty"`
-	Status status.Status          `json:"status,omitempty"`
+	Spec   SparkHistoryServerSpec   `json:"spec,omitempty"`
+	Status SparkHistoryServerStatus `json:"status,omitempty"`
+}
+
+type SparkHistoryServerStatus struct {
+	status.Status `json:",inline"`
+
+	// URLs of the history server UI exposed by the ingress of the role groups.
+	// +kubebuilder:validation:Optional
+	URLs []string `json:"urls,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -69,12 +80,59 @@ type SparkHistoryServerSpec struct {
 	// spark history server role spec
 	// +kubebuilder:validation:Required
 	Node *RoleSpec `json:"node"`
+
+	// DeletionPolicy of the event logs when the history server is deleted. Retain keeps the event logs,
+	// Delete purges the event log prefix in the S3 bucket.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Retain;Delete
+	// +kubebuilder:default=Retain
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+
+	// Cleanup configures the cleanup of the external state when the history server is deleted.
+	// +kubebuilder:validation:Optional
+	Cleanup *CleanupSpec `json:"cleanup,omitempty"`
+}
+
+const (
+	DeletionPolicyRetain = "Retain"
+	DeletionPolicyDelete = "Delete"
+)
+
+type CleanupSpec struct {
+	// WriteTombstone writes a marker object in the event log prefix when the event logs are retained,
+	// so that the readers of the bucket know that the history server was deleted.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=false
+	WriteTombstone bool `json:"writeTombstone,omitempty"`
+
+	// RemoveDiscoveryConfigMaps removes the discovery ConfigMaps of the history server in other namespaces.
+	// They are selected by the spark.kubedoop.dev/discovery-namespace and spark.kubedoop.dev/discovery-name labels,
+	// the operator does not create them.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=false
+	RemoveDiscoveryConfigMaps bool `json:"removeDiscoveryConfigMaps,omitempty"`
 }
 
 type ClusterConfigSpec struct {
 	// +kubebuilder:validation:Optional
 	Authentication *AuthenticationSpec `json:"authentication,omitempty"`
 
+	// Authorization of the history server UI, it requires authentication to be configured.
+	// +kubebuilder:validation:Optional
+	Authorization *AuthorizationSpec `json:"authorization,omitempty"`
+
+	// Kerberos enables kerberos for the history server, it is used to access secure HDFS
+	// and to authenticate the UI users with SPNEGO.
+	// +kubebuilder:validation:Optional
+	Kerberos *KerberosSpec `json:"kerberos,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Monitoring *MonitoringSpec `json:"monitoring,omitempty"`
+
+	// NetworkPolicy creates a NetworkPolicy per role group which only allows the traffic required by the history server.
+	// +kubebuilder:validation:Optional
+	NetworkPolicy *NetworkPolicySpec `json:"networkPolicy,omitempty"`
+
 	// +kubebuilder:validation:Required
 	LogFileDirectory *LogFileDirectorySpec `json:"logFileDirectory"`
 
@@ -85,6 +143,12 @@ type ClusterConfigSpec struct {
 
 	// +kubebuilder:validation:Optional
 	VectorAggregatorConfigMapName string `json:"vectorAggregatorConfigMapName,omitempty"`
+
+	// ExtraJars are downloaded into the classpath of the history server before it starts, e.g. the
+	// Hadoop connectors of other file systems or a servlet filter authenticating the UI.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MaxItems=32
+	ExtraJars []ExtraJarSpec `json:"extraJars,omitempty"`
 }
 
 type AuthenticationSpec struct {
@@ -108,9 +172,74 @@ type OidcSpec struct {
 	ExtraScopes []string `json:"extraScopes,omitempty"`
 }
 
-type LogFileDirectorySpec struct {
+// AuthorizationSpec enables the Spark UI ACLs of the history server.
+// Applications are only visible to the users in their view ACLs and to the admins.
+type AuthorizationSpec struct {
+	// Users who can view all applications.
+	// +kubebuilder:validation:Optional
+	AdminUsers []string `json:"adminUsers,omitempty"`
+
+	// Groups whose members can view all applications.
+	// +kubebuilder:validation:Optional
+	AdminGroups []string `json:"adminGroups,omitempty"`
+
+	// Servlet filter which sets the remote user of the request from the header
+	// forwarded by the authentication proxy. The filter jar must be available in
+	// the extra jars directory of the image.
+	// +kubebuilder:validation:Required
+	FilterClass string `json:"filterClass"`
+
+	// Header which carries the authenticated user, passed to the filter as `userHeader` parameter.
+	// OIDC authentication always forwards the user in X-Forwarded-User, a custom header requires LDAP.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=X-Forwarded-User
+	UserHeader string `json:"userHeader,omitempty"`
+
+	// Extra parameters of the filter.
+	// +kubebuilder:validation:Optional
+	FilterParams map[string]string `json:"filterParams,omitempty"`
+
+	// Class used to map a user to groups, for admin groups and the groups ACLs of applications.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=org.apache.spark.security.ShellBasedGroupsMappingProvider
+	GroupMappingProvider string `json:"groupMappingProvider,omitempty"`
+}
+
+type KerberosSpec struct {
+	// Secret class of the secret-operator providing the keytab and krb5.conf.
 	// +kubebuilder:validation:Required
-	S3 *S3Spec `json:"s3"`
+	SecretClass string `json:"secretClass"`
+}
+
+type NetworkPolicySpec struct {
+	// Peers allowed to access the UI, or the authentication proxy when authentication is configured.
+	// All peers are allowed when empty.
+	// +kubebuilder:validation:Optional
+	UIFrom []networkingv1.NetworkPolicyPeer `json:"uiFrom,omitempty"`
+
+	// Namespace of Prometheus allowed to scrape the metrics port.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=monitoring
+	MonitoringNamespace string `json:"monitoringNamespace,omitempty"`
+
+	// Egress rules added to the generated rules. The generated rules allow the egress to DNS, the storage of
+	// the event logs, the authentication provider, the vector aggregator, the KDC and the sources of the extra
+	// jars. NetworkPolicies can not select DNS names, so the egress to an endpoint outside the cluster given by
+	// a host name is allowed to any destination on its port, the KDC is only restricted by its port.
+	// +kubebuilder:validation:Optional
+	ExtraEgress []networkingv1.NetworkPolicyEgressRule `json:"extraEgress,omitempty"`
+}
+
+// LogFileDirectorySpec is the storage of the event logs, exactly one of the storages is set.
+type LogFileDirectorySpec struct {
+	// +kubebuilder:validation:Optional
+	S3 *S3Spec `json:"s3,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	ABFS *ABFSSpec `json:"abfs,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	GCS *GCSSpec `json:"gcs,omitempty"`
 }
 
 type S3Spec struct {
@@ -121,6 +250,97 @@ type S3Spec struct {
 	Prefix string `json:"prefix"`
 }
 
+// ABFSSpec stores the event logs in a container of an Azure storage account with the ABFS connector of
+// Hadoop. The secret of the credentials contains the shared key of the account in ACCOUNT_KEY.
+// The hadoop-azure jar is added with the extra jars when the image does not ship it.
+type ABFSSpec struct {
+	// Account is the name of the storage account.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]{3,24}$`
+	Account string `json:"account"`
+
+	// Container is the container of the event logs in the storage account.
+	// +kubebuilder:validation:Required
+	Container string `json:"container"`
+
+	// +kubebuilder:validation:Required
+	Prefix string `json:"prefix"`
+
+	// EndpointSuffix is the DFS endpoint of the cloud, e.g. dfs.core.chinacloudapi.cn for Azure China.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=dfs.core.windows.net
+	EndpointSuffix string `json:"endpointSuffix,omitempty"`
+
+	// +kubebuilder:validation:Required
+	Credentials *commonsv1alpha1.Credentials `json:"credentials"`
+}
+
+// GCSSpec stores the event logs in a Google Cloud Storage bucket with the GCS connector. The secret of
+// the credentials contains the JSON key of a service account in service-account.json.
+// The gcs-connector jar is added with the extra jars when the image does not ship it.
+type GCSSpec struct {
+	// +kubebuilder:validation:Required
+	Bucket string `json:"bucket"`
+
+	// +kubebuilder:validation:Required
+	Prefix string `json:"prefix"`
+
+	// +kubebuilder:validation:Required
+	Credentials *commonsv1alpha1.Credentials `json:"credentials"`
+}
+
+// ExtraJarSpec is a jar added to the classpath of the history server, exactly one source is set.
+type ExtraJarSpec struct {
+	// +kubebuilder:validation:Optional
+	S3 *ExtraJarS3Spec `json:"s3,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	HTTP *ExtraJarHTTPSpec `json:"http,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	OCI *ExtraJarOCISpec `json:"oci,omitempty"`
+}
+
+// ExtraJarS3Spec downloads a jar from a S3 bucket, the connection and the credentials of the bucket
+// are resolved like the bucket of the event logs.
+type ExtraJarS3Spec struct {
+	// +kubebuilder:validation:Required
+	Bucket *BucketSpec `json:"bucket"`
+
+	// Key of the jar in the bucket, e.g. jars/hadoop-azure-3.4.1.jar.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`\.jar$`
+	Key string `json:"key"`
+}
+
+// ExtraJarHTTPSpec downloads a jar from a HTTP URL, the download is verified with its checksum.
+type ExtraJarHTTPSpec struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^https?://.+\.jar$`
+	URL string `json:"url"`
+
+	// SHA256 is the hex encoded SHA-256 checksum of the jar.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[a-f0-9]{64}$`
+	SHA256 string `json:"sha256"`
+}
+
+// ExtraJarOCISpec copies the jars of an OCI image or artifact, it is mounted as an image volume which
+// requires the ImageVolume feature of Kubernetes.
+type ExtraJarOCISpec struct {
+	// +kubebuilder:validation:Required
+	Reference string `json:"reference"`
+
+	// Path of the directory of the jars in the image, the *.jar files in it are copied.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=/
+	Path string `json:"path,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Always;Never;IfNotPresent
+	PullPolicy corev1.PullPolicy `json:"pullPolicy,omitempty"`
+}
+
 type BucketSpec struct {
 	// +kubebuilder:validation:Optional
 	Inline *s3v1alpha1.S3BucketSpec `json:"inline,omitempty"`
@@ -152,6 +372,9 @@ type ImageSpec struct {
 }
 
 type RoleSpec struct {
+	// The podOverrides are a pod template merged into the pod template of the StatefulSet with a
+	// strategic merge patch, the overrides of the role before the overrides of the role group. The
+	// containers, volumes and selector labels of the operator can be changed but not removed.
 	*commonsv1alpha1.OverridesSpec `json:",inline"`
 
 	// +kubebuilder:validation:Optional
@@ -168,9 +391,171 @@ type ConfigSpec struct {
 
 	// +kubebuilder:validation:Optional
 	Cleaner *bool `json:"cleaner,omitempty"`
+
+	// Probes of the history server container, unset fields use the operator defaults.
+	// +kubebuilder:validation:Optional
+	Probes *ProbesSpec `json:"probes,omitempty"`
+
+	// Ingress exposes the UI of the role group with an Ingress or a Gateway API HTTPRoute.
+	// The authentication proxy is exposed when authentication is configured.
+	// +kubebuilder:validation:Optional
+	Ingress *IngressSpec `json:"ingress,omitempty"`
+
+	// Autoscaling scales the role group with a HorizontalPodAutoscaler, the replicas of the
+	// role group are ignored then. It can not be enabled on the cleaner role group.
+	// +kubebuilder:validation:Optional
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+
+	// SessionAffinity routes the requests of a client to the same replica, every replica has
+	// its own application cache and authentication proxy session.
+	// +kubebuilder:validation:Optional
+	SessionAffinity *SessionAffinitySpec `json:"sessionAffinity,omitempty"`
+}
+
+const (
+	SessionAffinityModeClientIP = "ClientIP"
+	SessionAffinityModeCookie   = "Cookie"
+)
+
+type SessionAffinitySpec struct {
+	// ClientIP pins the clients on the role group Service. Cookie pins the clients with a cookie
+	// set by the Ingress or Gateway in front of the role group, it requires the ingress to be configured.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=ClientIP
+	// +kubebuilder:validation:Enum=ClientIP;Cookie
+	Mode string `json:"mode,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=10800
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=86400
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+
+	// Name of the affinity cookie, only used by the Cookie mode.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=spark-history-affinity
+	CookieName string `json:"cookieName,omitempty"`
+}
+
+type AutoscalingSpec struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+
+	// Average CPU utilization of the pods, in percent of the requested CPU.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+
+	// Average memory utilization of the pods, in percent of the requested memory.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+
+	// Additional metrics, e.g. pods or external metrics served by a custom metrics adapter.
+	// +kubebuilder:validation:Optional
+	Metrics []autoscalingv2.MetricSpec `json:"metrics,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Behavior *autoscalingv2.HorizontalPodAutoscalerBehavior `json:"behavior,omitempty"`
+}
+
+const (
+	IngressKindIngress   = "Ingress"
+	IngressKindHTTPRoute = "HTTPRoute"
+)
+
+type IngressSpec struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=Ingress
+	// +kubebuilder:validation:Enum=Ingress;HTTPRoute
+	Kind string `json:"kind,omitempty"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	Hosts []string `json:"hosts"`
+
+	// Path of the UI. A sub path is stripped by the Ingress or HTTPRoute and the links of the UI
+	// are prefixed with it, the Ingress is rewritten with the annotations of ingress-nginx.
+	// A sub path is not supported with OIDC authentication.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default="/"
+	// +kubebuilder:validation:Pattern=`^/[A-Za-z0-9._~/-]*$`
+	Path string `json:"path,omitempty"`
+
+	// Secret with the TLS certificate of the hosts, only used by the Ingress.
+	// The TLS of an HTTPRoute is terminated by the listener of the Gateway.
+	// +kubebuilder:validation:Optional
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+
+	// Scheme of the public URL, https is used when tlsSecretName is set.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=http;https
+	Scheme string `json:"scheme,omitempty"`
+
+	// Only used by the Ingress.
+	// +kubebuilder:validation:Optional
+	IngressClassName string `json:"ingressClassName,omitempty"`
+
+	// Gateways the HTTPRoute is attached to, required by the HTTPRoute.
+	// +kubebuilder:validation:Optional
+	ParentRefs []GatewayParentRef `json:"parentRefs,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type GatewayParentRef struct {
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// The namespace of the history server is used when unset.
+	// +kubebuilder:validation:Optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+type ProbesSpec struct {
+	// Startup probe, it must tolerate the time to replay the event logs on startup.
+	// +kubebuilder:validation:Optional
+	Startup *ProbeSpec `json:"startup,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Readiness *ProbeSpec `json:"readiness,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Liveness *ProbeSpec `json:"liveness,omitempty"`
+}
+
+type ProbeSpec struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	PeriodSeconds *int32 `json:"periodSeconds,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
 }
 
 type RoleGroupSpec struct {
+	// The podOverrides are a pod template merged into the pod template of the StatefulSet with a
+	// strategic merge patch, the overrides of the role before the overrides of the role group. The
+	// containers, volumes and selector labels of the operator can be changed but not removed.
 	*commonsv1alpha1.OverridesSpec `json:",inline"`
 
 	// +kubebuilder:validation:Optional
@@ -181,9 +566,6 @@ type RoleGroupSpec struct {
 	Config *ConfigSpec `json:"config,omitempty"`
 }
 
-type PodOverridesSpec struct {
-}
-
 func init() {
 	SchemeBuilder.Register(&SparkHistoryServer{}, &SparkHistoryServerList{})
 }
@@ -0,0 +1,228 @@
+/*
+Copyright 2023 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	MonitorKindServiceMonitor = "ServiceMonitor"
+	MonitorKindPodMonitor     = "PodMonitor"
+)
+
+// MonitoringSpec configures the integration with the Prometheus Operator.
+// Resources of the Prometheus Operator are only created when its CRDs are installed in the cluster.
+type MonitoringSpec struct {
+	// Monitor creates a ServiceMonitor or PodMonitor per role group to scrape the history server metrics.
+	// +kubebuilder:validation:Optional
+	Monitor *MonitorSpec `json:"monitor,omitempty"`
+
+	// PrometheusRule creates a PrometheusRule with the health alerts of the history server.
+	// +kubebuilder:validation:Optional
+	PrometheusRule *PrometheusRuleSpec `json:"prometheusRule,omitempty"`
+
+	// JmxExporter configures the JMX exporter java agent of the history server.
+	// +kubebuilder:validation:Optional
+	JmxExporter *JmxExporterSpec `json:"jmxExporter,omitempty"`
+
+	// GrafanaDashboard creates a ConfigMap with the Grafana dashboard of the history server,
+	// the ConfigMap is discovered by the dashboard sidecar of Grafana.
+	// +kubebuilder:validation:Optional
+	GrafanaDashboard *GrafanaDashboardSpec `json:"grafanaDashboard,omitempty"`
+}
+
+type GrafanaDashboardSpec struct {
+	// Labels added to the ConfigMap, the `grafana_dashboard: "1"` label of the sidecar is always added.
+	// +kubebuilder:validation:Optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations added to the ConfigMap, e.g. `grafana_folder` to select the folder of the dashboard.
+	// +kubebuilder:validation:Optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type JmxExporterSpec struct {
+	// Rules are evaluated before the default rules of the operator, the first matching rule is applied.
+	// A rule with the same pattern as a default rule replaces the default rule.
+	// +kubebuilder:validation:Optional
+	Rules []JmxExporterRule `json:"rules,omitempty"`
+}
+
+// JmxExporterRule is a rule of the JMX exporter, see https://github.com/prometheus/jmx_exporter.
+type JmxExporterRule struct {
+	// Regex matched against the bean name, e.g. `metrics<name=(.+), type=counters><>Count`.
+	// +kubebuilder:validation:Required
+	Pattern string `json:"pattern"`
+
+	// Name of the metric, capture groups of the pattern can be referenced with $1.
+	// +kubebuilder:validation:Optional
+	Name string `json:"name,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Value string `json:"value,omitempty"`
+
+	// Factor the value is multiplied with, e.g. 0.001.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^[0-9]+(\.[0-9]+)?$`
+	ValueFactor string `json:"valueFactor,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Help string `json:"help,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=GAUGE;COUNTER;UNTYPED
+	Type string `json:"type,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	AttrNameSnakeCase bool `json:"attrNameSnakeCase,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Cache bool `json:"cache,omitempty"`
+}
+
+type MonitorSpec struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=ServiceMonitor
+	// +kubebuilder:validation:Enum=ServiceMonitor;PodMonitor
+	Kind string `json:"kind,omitempty"`
+
+	// Labels added to the monitor, e.g. to match the monitor selector of Prometheus.
+	// +kubebuilder:validation:Optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Scrape interval, e.g. 30s. The Prometheus default is used when unset.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^(0|(([0-9]+)y)?(([0-9]+)w)?(([0-9]+)d)?(([0-9]+)h)?(([0-9]+)m)?(([0-9]+)s)?(([0-9]+)ms)?)$`
+	Interval string `json:"interval,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^(0|(([0-9]+)y)?(([0-9]+)w)?(([0-9]+)d)?(([0-9]+)h)?(([0-9]+)m)?(([0-9]+)s)?(([0-9]+)ms)?)$`
+	ScrapeTimeout string `json:"scrapeTimeout,omitempty"`
+
+	// Relabelings applied to the target before scraping.
+	// +kubebuilder:validation:Optional
+	Relabelings []RelabelConfig `json:"relabelings,omitempty"`
+
+	// Relabelings applied to the samples before ingestion.
+	// +kubebuilder:validation:Optional
+	MetricRelabelings []RelabelConfig `json:"metricRelabelings,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=http;https
+	Scheme string `json:"scheme,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	TLSConfig *MonitorTLSConfig `json:"tlsConfig,omitempty"`
+
+	// Secret key containing the bearer token sent with the scrape requests.
+	// +kubebuilder:validation:Optional
+	BearerTokenSecret *corev1.SecretKeySelector `json:"bearerTokenSecret,omitempty"`
+}
+
+// RelabelConfig is a Prometheus relabel config.
+type RelabelConfig struct {
+	// +kubebuilder:validation:Optional
+	SourceLabels []string `json:"sourceLabels,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Separator string `json:"separator,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	TargetLabel string `json:"targetLabel,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Regex string `json:"regex,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Modulus uint64 `json:"modulus,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Replacement *string `json:"replacement,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=replace;Replace;keep;Keep;drop;Drop;hashmod;HashMod;labelmap;LabelMap;labeldrop;LabelDrop;labelkeep;LabelKeep;lowercase;Lowercase;uppercase;Uppercase;keepequal;KeepEqual;dropequal;DropEqual
+	Action string `json:"action,omitempty"`
+}
+
+type MonitorTLSConfig struct {
+	// Secret key containing the CA certificate of the targets.
+	// +kubebuilder:validation:Optional
+	CASecret *corev1.SecretKeySelector `json:"caSecret,omitempty"`
+
+	// Secret key containing the client certificate.
+	// +kubebuilder:validation:Optional
+	CertSecret *corev1.SecretKeySelector `json:"certSecret,omitempty"`
+
+	// Secret key containing the client key.
+	// +kubebuilder:validation:Optional
+	KeySecret *corev1.SecretKeySelector `json:"keySecret,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	ServerName string `json:"serverName,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// PrometheusRuleSpec configures the alerts of the history server, one alert group is created per role group.
+type PrometheusRuleSpec struct {
+	// Labels added to the PrometheusRule, e.g. to match the rule selector of Prometheus.
+	// +kubebuilder:validation:Optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Labels added to every alert.
+	// +kubebuilder:validation:Optional
+	AlertLabels map[string]string `json:"alertLabels,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=warning
+	Severity string `json:"severity,omitempty"`
+
+	// Duration the role group has unavailable pods before alerting.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default="5m"
+	PodDownFor string `json:"podDownFor,omitempty"`
+
+	// Heap usage in percent of the max heap to alert on.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=90
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	HeapUsagePercent int32 `json:"heapUsagePercent,omitempty"`
+
+	// Duration without listing the event log directory before the listing is considered stale.
+	// The listing is measured with the S3A metrics, the alert is only generated for an S3 log directory.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default="30m"
+	ListingStaleAfter string `json:"listingStaleAfter,omitempty"`
+
+	// Number of failed application replays in 15 minutes to alert on.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	ReplayFailures int32 `json:"replayFailures,omitempty"`
+
+	// Number of retried S3 requests in 5 minutes to alert on, the alert is only generated for an S3 log directory.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=10
+	// +kubebuilder:validation:Minimum=1
+	S3RequestErrors int32 `json:"s3RequestErrors,omitempty"`
+}
@@ -17,10 +17,13 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -28,6 +31,7 @@ import (
 
 	authv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/authentication/v1alpha1"
 	s3v1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/s3/v1alpha1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -39,11 +43,26 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	sparkv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+	sparkv1beta1 "github.com/zncdatadev/spark-k8s-operator/api/v1beta1"
 	"github.com/zncdatadev/spark-k8s-operator/internal/controller/historyserver"
+	"github.com/zncdatadev/spark-k8s-operator/internal/crd"
+	"github.com/zncdatadev/spark-k8s-operator/internal/manager"
+	"github.com/zncdatadev/spark-k8s-operator/internal/metrics"
+	"github.com/zncdatadev/spark-k8s-operator/internal/tracing"
 	"github.com/zncdatadev/spark-k8s-operator/internal/util/version"
+	webhookv1beta1 "github.com/zncdatadev/spark-k8s-operator/internal/webhook/v1beta1"
 	// +kubebuilder:scaffold:imports
 )
 
+const (
+	tracingShutdownTimeout = 5 * time.Second
+
+	// the port of the Service in front of the webhook server
+	webhookServicePort = 443
+	// the CA of the serving certificate issued by cert-manager
+	webhookCAName = "ca.crt"
+)
+
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
@@ -53,22 +72,37 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(sparkv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(sparkv1beta1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
+
 	utilruntime.Must(authv1alpha1.AddToScheme(scheme))
 	utilruntime.Must(s3v1alpha1.AddToScheme(scheme))
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == renderCommand {
+		if err := runRender(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	var metricsAddr string
 	var metricsCertPath, metricsCertName, metricsCertKey string
 	var webhookCertPath, webhookCertName, webhookCertKey string
+	var conversionServiceNamespace, conversionServiceName string
+	var migrateStorageVersion bool
 	var enableLeaderElection bool
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
 	var showVersion bool
 	var tlsOpts []func(*tls.Config)
+	var tracingOpts tracing.Options
+	var managerOpts manager.Options
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -81,6 +115,13 @@ func main() {
 	flag.StringVar(&webhookCertPath, "webhook-cert-path", "", "The directory that contains the webhook certificate.")
 	flag.StringVar(&webhookCertName, "webhook-cert-name", "tls.crt", "The name of the webhook certificate file.")
 	flag.StringVar(&webhookCertKey, "webhook-cert-key", "tls.key", "The name of the webhook key file.")
+	flag.StringVar(&conversionServiceNamespace, "conversion-webhook-service-namespace", "",
+		"The namespace of the Service of the webhook server, used with --conversion-webhook-service-name.")
+	flag.StringVar(&conversionServiceName, "conversion-webhook-service-name", "",
+		"The name of the Service of the webhook server. If set, the conversion webhook of the CRD is configured "+
+			"by the operator with the CA found in --webhook-cert-path.")
+	flag.BoolVar(&migrateStorageVersion, "migrate-storage-version", true,
+		"If set, the stored SparkHistoryServers are migrated to the storage version of the CRD.")
 	flag.StringVar(&metricsCertPath, "metrics-cert-path", "",
 		"The directory that contains the metrics server certificate.")
 	flag.StringVar(&metricsCertName, "metrics-cert-name", "tls.crt", "The name of the metrics server certificate file.")
@@ -88,6 +129,8 @@ func main() {
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
 	flag.BoolVar(&showVersion, "version", false, "Print version information and exit.")
+	tracingOpts.BindFlags(flag.CommandLine)
+	managerOpts.BindFlags(flag.CommandLine)
 	opts := zap.Options{
 		Development: true,
 	}
@@ -102,6 +145,33 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if err := managerOpts.Validate(); err != nil {
+		setupLog.Error(err, "invalid manager options")
+		os.Exit(1)
+	}
+	if conversionServiceName != "" && (conversionServiceNamespace == "" || webhookCertPath == "") {
+		setupLog.Error(nil, "--conversion-webhook-service-name requires "+
+			"--conversion-webhook-service-namespace and --webhook-cert-path")
+		os.Exit(1)
+	}
+	cacheOpts, err := managerOpts.CacheOptions()
+	if err != nil {
+		setupLog.Error(err, "invalid cache options")
+		os.Exit(1)
+	}
+	namespaceSelector, err := managerOpts.GetNamespaceSelector()
+	if err != nil {
+		setupLog.Error(err, "invalid namespace selector")
+		os.Exit(1)
+	}
+
+	tracingOpts.ServiceVersion = version.BuildVersion
+	shutdownTracing, err := tracing.Setup(context.Background(), tracingOpts)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
@@ -171,6 +241,7 @@ func main() {
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
+		Cache:                  cacheOpts,
 		Metrics:                metricsServerOptions,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
@@ -194,15 +265,58 @@ func main() {
 	}
 
 	if err = (&historyserver.SparkHistoryServerReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		Recorder:          mgr.GetEventRecorder("sparkhistoryserver-controller"),
+		APIReader:         mgr.GetAPIReader(),
+		Options:           managerOpts.ControllerOptions(),
+		NamespaceSelector: namespaceSelector,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SparkHistoryServer")
 		os.Exit(1)
 	}
 
+	// nolint:goconst
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err := webhookv1beta1.SetupSparkHistoryServerWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "SparkHistoryServer")
+			os.Exit(1)
+		}
+
+		if conversionServiceName != "" {
+			if err := mgr.Add(&crd.ConversionInjector{
+				Client:           mgr.GetClient(),
+				CRDName:          crd.SparkHistoryServerCRDName,
+				ServiceNamespace: conversionServiceNamespace,
+				ServiceName:      conversionServiceName,
+				ServicePort:      webhookServicePort,
+				CAFile:           filepath.Join(webhookCertPath, webhookCAName),
+				StorageVersion:   sparkv1beta1.GroupVersion.Version,
+			}); err != nil {
+				setupLog.Error(err, "unable to set up the conversion webhook of the CRD")
+				os.Exit(1)
+			}
+		}
+
+		// the objects are only converted to the storage version with the conversion webhook
+		if migrateStorageVersion {
+			if err := mgr.Add(&crd.StorageVersionMigrator{
+				Client:  mgr.GetClient(),
+				Reader:  mgr.GetAPIReader(),
+				CRDName: crd.SparkHistoryServerCRDName,
+			}); err != nil {
+				setupLog.Error(err, "unable to set up the storage version migration")
+				os.Exit(1)
+			}
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
+	if err := metrics.Register(mgr.GetClient()); err != nil {
+		setupLog.Error(err, "unable to register metrics")
+		os.Exit(1)
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -217,4 +331,11 @@ func main() {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+
+	// flush the spans of the last reconciles
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		setupLog.Error(err, "problem shutting down tracing")
+	}
 }
@@ -0,0 +1,196 @@
+/*
+Copyright 2023 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/zncdatadev/operator-go/pkg/client"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/yaml"
+
+	sparkv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+	"github.com/zncdatadev/spark-k8s-operator/internal/controller/historyserver"
+)
+
+const renderCommand = "render"
+
+var yamlDocumentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// fileList is a repeatable flag of file names.
+type fileList []string
+
+func (f *fileList) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *fileList) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// runRender implements `manager render`, it prints the objects the operator would create for the
+// SparkHistoryServers in the given files. The S3 and authentication objects referenced by the
+// history servers are read from the same files, no cluster is accessed.
+func runRender(args []string, stdin io.Reader, stdout io.Writer) error {
+	var files fileList
+	var namespace string
+
+	fs := flag.NewFlagSet(renderCommand, flag.ContinueOnError)
+	fs.Var(&files, "f", "File with a SparkHistoryServer and the objects it references, e.g. S3Bucket, "+
+		"S3Connection or AuthenticationClass. Can be repeated, use - to read from stdin.")
+	fs.StringVar(&namespace, "namespace", "default", "The namespace of the objects without a namespace.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("at least one file is required, use -f")
+	}
+
+	// the builders log the resources they build, keep the output clean
+	ctrl.SetLogger(zap.New(zap.WriteTo(io.Discard)))
+
+	instances, objects, err := readRenderInput(files, stdin, namespace)
+	if err != nil {
+		return err
+	}
+	if len(instances) == 0 {
+		return errors.New("no SparkHistoryServer found in the files")
+	}
+
+	ctx := context.Background()
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+	for _, instance := range instances {
+		resourceClient := &client.Client{
+			Client:         fakeClient,
+			OwnerReference: instance,
+		}
+		rendered, err := historyserver.RenderResources(ctx, resourceClient, instance)
+		if err != nil {
+			return fmt.Errorf("failed to render SparkHistoryServer %s/%s: %w", instance.Namespace, instance.Name, err)
+		}
+		if err := printObjects(stdout, rendered); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readRenderInput(files []string, stdin io.Reader, namespace string) ([]*sparkv1alpha1.SparkHistoryServer, []ctrlclient.Object, error) {
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+
+	instances := []*sparkv1alpha1.SparkHistoryServer{}
+	objects := []ctrlclient.Object{}
+	for _, file := range files {
+		var data []byte
+		var err error
+		if file == "-" {
+			data, err = io.ReadAll(stdin)
+		} else {
+			data, err = os.ReadFile(file)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, doc := range yamlDocumentSeparator.Split(string(data), -1) {
+			if strings.TrimSpace(doc) == "" {
+				continue
+			}
+			obj, _, err := decoder.Decode([]byte(doc), nil, nil)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to decode %s: %w", file, err)
+			}
+			o, ok := obj.(ctrlclient.Object)
+			if !ok {
+				return nil, nil, fmt.Errorf("unsupported object %T in %s", obj, file)
+			}
+			// The fake client treats the CRDs as namespaced, the cluster scoped objects, e.g. the
+			// AuthenticationClass, are looked up in the namespace of the history server.
+			if o.GetNamespace() == "" {
+				o.SetNamespace(namespace)
+			}
+			if instance, ok := o.(*sparkv1alpha1.SparkHistoryServer); ok {
+				// the CRD defaults are not applied offline
+				if instance.Spec.Image == nil {
+					instance.Spec.Image = &sparkv1alpha1.ImageSpec{
+						Repo:       "quay.io/zncdatadev",
+						PullPolicy: corev1.PullIfNotPresent,
+					}
+				}
+				instances = append(instances, instance)
+				continue
+			}
+			objects = append(objects, o)
+		}
+	}
+	return instances, objects, nil
+}
+
+// printObjects prints the objects as a YAML stream, sorted by kind and name.
+func printObjects(w io.Writer, objects []ctrlclient.Object) error {
+	for _, obj := range objects {
+		if err := setGroupVersionKind(obj); err != nil {
+			return err
+		}
+	}
+	slices.SortStableFunc(objects, func(a, b ctrlclient.Object) int {
+		if c := strings.Compare(a.GetObjectKind().GroupVersionKind().Kind, b.GetObjectKind().GroupVersionKind().Kind); c != 0 {
+			return c
+		}
+		return strings.Compare(a.GetName(), b.GetName())
+	})
+
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setGroupVersionKind sets the type meta of the typed objects, the builders do not set it.
+func setGroupVersionKind(obj runtime.Object) error {
+	if !obj.GetObjectKind().GroupVersionKind().Empty() {
+		return nil
+	}
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return err
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	return nil
+}
@@ -60,3 +60,17 @@ Create the name of the service account to use
 {{- default "default" .Values.serviceAccount.name }}
 {{- end }}
 {{- end }}
+
+{{/*
+Create the name of the service of the webhook server
+*/}}
+{{- define "operator.webhookServiceName" -}}
+{{- printf "%s-webhook" (include "operator.fullname" .) | trunc 63 | trimSuffix "-" }}
+{{- end }}
+
+{{/*
+Create the name of the secret of the webhook server certificate
+*/}}
+{{- define "operator.webhookCertSecretName" -}}
+{{- printf "%s-webhook-cert" (include "operator.fullname" .) | trunc 63 | trimSuffix "-" }}
+{{- end }}
@@ -0,0 +1,79 @@
+package historyserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	authv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/authentication/v1alpha1"
+	"github.com/zncdatadev/operator-go/pkg/client"
+	"go.opentelemetry.io/otel/attribute"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+	"github.com/zncdatadev/spark-k8s-operator/internal/tracing"
+)
+
+var (
+	// ErrUnsupportedAuthenticationProvider is returned when the referenced AuthenticationClass
+	// uses a provider that can not be used to protect the history server UI.
+	ErrUnsupportedAuthenticationProvider = errors.New("unsupported authentication provider")
+
+	// ErrAuthentication is returned when the referenced AuthenticationClass can not be resolved.
+	ErrAuthentication = errors.New("failed to resolve authentication")
+)
+
+// Authentication is the resolved authentication of the history server UI.
+// It holds the AuthenticationClass referenced by the cluster config.
+type Authentication struct {
+	Spec  *shsv1alpha1.AuthenticationSpec
+	Class *authv1alpha1.AuthenticationClass
+}
+
+// NewAuthentication fetches the AuthenticationClass referenced by the spec and validates
+// that its provider is supported. Only OIDC and LDAP providers are supported, any other
+// provider returns an error wrapping ErrUnsupportedAuthenticationProvider.
+func NewAuthentication(
+	ctx context.Context,
+	client *client.Client,
+	spec *shsv1alpha1.AuthenticationSpec,
+) (*Authentication, error) {
+	ctx, span := tracing.Start(ctx, "AuthenticationClass.Get", attribute.String("name", spec.AuthenticationClass))
+	authClass := &authv1alpha1.AuthenticationClass{}
+	err := client.GetWithOwnerNamespace(ctx, spec.AuthenticationClass, authClass)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAuthentication, err)
+	}
+
+	provider := authClass.Spec.AuthenticationProvider
+	switch {
+	case provider != nil && provider.OIDC != nil:
+		if spec.Oidc == nil {
+			return nil, fmt.Errorf("%w: authentication class %q uses the oidc provider, but clusterConfig.authentication.oidc is not set", ErrAuthentication, spec.AuthenticationClass)
+		}
+	case provider != nil && provider.LDAP != nil:
+	default:
+		return nil, fmt.Errorf("%w: authentication class %q must use the oidc or ldap provider", ErrUnsupportedAuthenticationProvider, spec.AuthenticationClass)
+	}
+
+	return &Authentication{
+		Spec:  spec,
+		Class: authClass,
+	}, nil
+}
+
+func (a *Authentication) IsOidc() bool {
+	return a.Class.Spec.AuthenticationProvider.OIDC != nil
+}
+
+func (a *Authentication) IsLdap() bool {
+	return a.Class.Spec.AuthenticationProvider.LDAP != nil
+}
+
+func (a *Authentication) GetOidcProvider() *authv1alpha1.OIDCProvider {
+	return a.Class.Spec.AuthenticationProvider.OIDC
+}
+
+func (a *Authentication) GetLdapProvider() *authv1alpha1.LDAPProvider {
+	return a.Class.Spec.AuthenticationProvider.LDAP
+}
@@ -0,0 +1,111 @@
+package historyserver
+
+import (
+	"fmt"
+	"strings"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+const (
+	DefaultUserHeader           = "X-Forwarded-User"
+	DefaultGroupMappingProvider = "org.apache.spark.security.ShellBasedGroupsMappingProvider"
+)
+
+// UIFilter is a servlet filter of the Spark UI, rendered to `spark.ui.filters`
+// and `spark.<filter class>.param.<name>` properties.
+type UIFilter struct {
+	Class  string
+	Params map[string]string
+}
+
+// getUIFiltersProperties returns the spark properties of the given filters,
+// the filters are applied in the given order.
+func getUIFiltersProperties(filters []UIFilter) map[string]string {
+	properties := map[string]string{}
+	if len(filters) == 0 {
+		return properties
+	}
+
+	classes := make([]string, 0, len(filters))
+	for _, filter := range filters {
+		classes = append(classes, filter.Class)
+		for name, value := range filter.Params {
+			properties["spark."+filter.Class+".param."+name] = value
+		}
+	}
+	properties["spark.ui.filters"] = strings.Join(classes, ",")
+
+	return properties
+}
+
+func getUserHeader(authorization *shsv1alpha1.AuthorizationSpec) string {
+	if authorization.UserHeader != "" {
+		return authorization.UserHeader
+	}
+	return DefaultUserHeader
+}
+
+// getForwardedUserHeader returns the header the authentication proxy sets to the authenticated user,
+// or empty string when authorization is disabled.
+func getForwardedUserHeader(clusterConfig *shsv1alpha1.ClusterConfigSpec) string {
+	if clusterConfig.Authorization == nil {
+		return ""
+	}
+	return getUserHeader(clusterConfig.Authorization)
+}
+
+// validateAuthorization rejects the authorization without an authentication proxy, the user header would
+// be set by the clients. oauth2-proxy always forwards the user in X-Forwarded-User, so a custom header is
+// only supported with LDAP.
+func validateAuthorization(authorization *shsv1alpha1.AuthorizationSpec, authentication *Authentication) error {
+	if authorization == nil {
+		return nil
+	}
+	if authentication == nil {
+		return fmt.Errorf("clusterConfig.authorization requires clusterConfig.authentication to be configured")
+	}
+	if authentication.IsOidc() && getUserHeader(authorization) != DefaultUserHeader {
+		return fmt.Errorf("clusterConfig.authorization.userHeader %s is not supported with OIDC authentication, the user is forwarded in %s",
+			authorization.UserHeader, DefaultUserHeader,
+		)
+	}
+	return nil
+}
+
+// getAuthorizationFilter returns the filter which sets the remote user from the header
+// forwarded by the authentication proxy, so that the UI ACLs are checked against it.
+func getAuthorizationFilter(authorization *shsv1alpha1.AuthorizationSpec) UIFilter {
+	params := map[string]string{}
+	for name, value := range authorization.FilterParams {
+		params[name] = value
+	}
+	params["userHeader"] = getUserHeader(authorization)
+
+	return UIFilter{
+		Class:  authorization.FilterClass,
+		Params: params,
+	}
+}
+
+// getAuthorizationProperties returns the spark properties enabling the history UI ACLs.
+func getAuthorizationProperties(authorization *shsv1alpha1.AuthorizationSpec) map[string]string {
+	groupMappingProvider := authorization.GroupMappingProvider
+	if groupMappingProvider == "" {
+		groupMappingProvider = DefaultGroupMappingProvider
+	}
+
+	properties := map[string]string{
+		"spark.history.ui.acls.enable": trueValue,
+		"spark.user.groups.mapping":    groupMappingProvider,
+	}
+
+	if len(authorization.AdminUsers) > 0 {
+		properties["spark.history.ui.admin.acls"] = strings.Join(authorization.AdminUsers, ",")
+	}
+	if len(authorization.AdminGroups) > 0 {
+		properties["spark.history.ui.admin.acls.groups"] = strings.Join(authorization.AdminGroups, ",")
+	}
+
+	return properties
+}
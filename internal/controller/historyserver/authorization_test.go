@@ -0,0 +1,56 @@
+package historyserver
+
+import (
+	"testing"
+
+	authv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/authentication/v1alpha1"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+	"github.com/zncdatadev/spark-k8s-operator/internal/util"
+)
+
+func newTestAuthentication(provider *authv1alpha1.AuthenticationProvider) *Authentication {
+	return &Authentication{Class: &authv1alpha1.AuthenticationClass{
+		Spec: authv1alpha1.AuthenticationClassSpec{AuthenticationProvider: provider},
+	}}
+}
+
+func TestValidateAuthorization(t *testing.T) {
+	oidc := newTestAuthentication(&authv1alpha1.AuthenticationProvider{OIDC: &authv1alpha1.OIDCProvider{}})
+	ldap := newTestAuthentication(&authv1alpha1.AuthenticationProvider{LDAP: &authv1alpha1.LDAPProvider{}})
+
+	tests := []struct {
+		name           string
+		userHeader     string
+		authentication *Authentication
+		wantErr        bool
+	}{
+		{name: "without authentication", authentication: nil, wantErr: true},
+		{name: "oidc", authentication: oidc},
+		{name: "oidc with the default header", userHeader: DefaultUserHeader, authentication: oidc},
+		{name: "oidc with a custom header", userHeader: "X-Remote-User", authentication: oidc, wantErr: true},
+		{name: "ldap with a custom header", userHeader: "X-Remote-User", authentication: ldap},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authorization := &shsv1alpha1.AuthorizationSpec{FilterClass: "org.example.Filter", UserHeader: tt.userHeader}
+			if err := validateAuthorization(authorization, tt.authentication); (err != nil) != tt.wantErr {
+				t.Errorf("validateAuthorization() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServicePortsWithAuthentication(t *testing.T) {
+	for _, authentication := range []*Authentication{
+		newTestAuthentication(&authv1alpha1.AuthenticationProvider{OIDC: &authv1alpha1.OIDCProvider{}}),
+		newTestAuthentication(&authv1alpha1.AuthenticationProvider{LDAP: &authv1alpha1.LDAPProvider{}}),
+	} {
+		r := &NodeRoleReconciler{Authentication: authentication}
+		for _, port := range r.getServicePorts() {
+			if port.Name == util.HttpPortName {
+				t.Errorf("service ports = %v, the UI must only be exposed through the authentication proxy", r.getServicePorts())
+			}
+		}
+	}
+}
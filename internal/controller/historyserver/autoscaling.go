@@ -0,0 +1,140 @@
+package historyserver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	"github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/utils/ptr"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+const (
+	DefaultAutoscalingMinReplicas int32 = 1
+)
+
+func getAutoscalingMinReplicas(spec *shsv1alpha1.AutoscalingSpec) int32 {
+	if spec.MinReplicas != nil {
+		return *spec.MinReplicas
+	}
+	return DefaultAutoscalingMinReplicas
+}
+
+func newResourceMetric(name corev1.ResourceName, utilization int32) autoscalingv2.MetricSpec {
+	return autoscalingv2.MetricSpec{
+		Type: autoscalingv2.ResourceMetricSourceType,
+		Resource: &autoscalingv2.ResourceMetricSource{
+			Name: name,
+			Target: autoscalingv2.MetricTarget{
+				Type:               autoscalingv2.UtilizationMetricType,
+				AverageUtilization: ptr.To(utilization),
+			},
+		},
+	}
+}
+
+// validateAutoscaling rejects autoscaling on the cleaner role group, the cleaner must run
+// in exactly one history server, otherwise the replicas delete the event logs concurrently.
+func validateAutoscaling(info *reconciler.RoleGroupInfo, config *shsv1alpha1.ConfigSpec) error {
+	if config == nil || config.Autoscaling == nil {
+		return nil
+	}
+	if config.Cleaner != nil && *config.Cleaner {
+		return fmt.Errorf("%w: role group has cleaner enabled and can not be autoscaled. "+
+			"ClusterName: %s, RoleName: %s, RoleGroupName: %s",
+			ErrCleanerValidation, info.GetClusterName(), info.GetRoleName(), info.GetGroupName(),
+		)
+	}
+	return nil
+}
+
+// getAutoscaledReplicas returns the replicas of the StatefulSet of an autoscaled role group. The replicas
+// of the existing StatefulSet are kept, so the operator does not revert the replicas set by the autoscaler.
+// A StatefulSet scaled to zero by a stopped cluster is restarted with the minimum replicas.
+func getAutoscaledReplicas(ctx context.Context, client *client.Client, name string, spec *shsv1alpha1.AutoscalingSpec) (*int32, error) {
+	obj := &appsv1.StatefulSet{}
+	if err := client.GetWithOwnerNamespace(ctx, name, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ptr.To(getAutoscalingMinReplicas(spec)), nil
+		}
+		return nil, err
+	}
+	if obj.Spec.Replicas == nil || *obj.Spec.Replicas == 0 {
+		return ptr.To(getAutoscalingMinReplicas(spec)), nil
+	}
+	return obj.Spec.Replicas, nil
+}
+
+var _ builder.ObjectBuilder = &HorizontalPodAutoscalerBuilder{}
+
+// HorizontalPodAutoscalerBuilder builds the HorizontalPodAutoscaler of the StatefulSet of a role group.
+type HorizontalPodAutoscalerBuilder struct {
+	builder.ObjectMeta
+
+	Spec *shsv1alpha1.AutoscalingSpec
+}
+
+func NewHorizontalPodAutoscalerBuilder(
+	client *client.Client,
+	name string,
+	spec *shsv1alpha1.AutoscalingSpec,
+	options ...builder.Option,
+) *HorizontalPodAutoscalerBuilder {
+	return &HorizontalPodAutoscalerBuilder{
+		ObjectMeta: *builder.NewObjectMeta(client, name, options...),
+		Spec:       spec,
+	}
+}
+
+func (b *HorizontalPodAutoscalerBuilder) getMetrics() []autoscalingv2.MetricSpec {
+	metrics := []autoscalingv2.MetricSpec{}
+	if b.Spec.TargetCPUUtilizationPercentage != nil {
+		metrics = append(metrics, newResourceMetric(corev1.ResourceCPU, *b.Spec.TargetCPUUtilizationPercentage))
+	}
+	if b.Spec.TargetMemoryUtilizationPercentage != nil {
+		metrics = append(metrics, newResourceMetric(corev1.ResourceMemory, *b.Spec.TargetMemoryUtilizationPercentage))
+	}
+	return append(metrics, b.Spec.Metrics...)
+}
+
+func (b *HorizontalPodAutoscalerBuilder) Build(_ context.Context) (ctrlclient.Object, error) {
+	if b.Spec.MaxReplicas < getAutoscalingMinReplicas(b.Spec) {
+		return nil, fmt.Errorf("autoscaling maxReplicas %d is less than minReplicas %d, role group: %s",
+			b.Spec.MaxReplicas, getAutoscalingMinReplicas(b.Spec), b.GetName())
+	}
+
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: b.GetObjectMeta(),
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: appsv1.SchemeGroupVersion.String(),
+				Kind:       "StatefulSet",
+				Name:       b.GetName(),
+			},
+			MinReplicas: ptr.To(getAutoscalingMinReplicas(b.Spec)),
+			MaxReplicas: b.Spec.MaxReplicas,
+			Metrics:     b.getMetrics(),
+			Behavior:    b.Spec.Behavior,
+		},
+	}, nil
+}
+
+// NewRoleGroupHorizontalPodAutoscalerReconciler creates the reconciler of the HorizontalPodAutoscaler
+// targeting the StatefulSet of the role group.
+func NewRoleGroupHorizontalPodAutoscalerReconciler(
+	client *client.Client,
+	roleGroupInfo *reconciler.RoleGroupInfo,
+	spec *shsv1alpha1.AutoscalingSpec,
+	options ...builder.Option,
+) reconciler.Reconciler {
+	b := NewHorizontalPodAutoscalerBuilder(client, roleGroupInfo.GetFullName(), spec, options...)
+	return reconciler.NewGenericResourceReconciler(client, b)
+}
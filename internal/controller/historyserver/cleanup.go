@@ -0,0 +1,130 @@
+package historyserver
+
+import (
+	"context"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	resourceClient "github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	oputil "github.com/zncdatadev/operator-go/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// CleanupActionPurge removes the event log prefix of a deleted history server.
+	CleanupActionPurge = "purge-event-logs"
+	// CleanupActionTombstone writes a marker object in the event log prefix of a deleted history server.
+	CleanupActionTombstone = "write-tombstone"
+
+	CleanupContainerName = "cleanup"
+	TombstoneFileName    = "_SPARK_HISTORY_SERVER_DELETED"
+
+	// the hadoop shell is on the classpath of spark, it reads the credentials of the storage from the environment
+	fsShellClass = "org.apache.hadoop.fs.FsShell"
+
+	cleanupBackoffLimit = 3
+)
+
+var _ builder.JobBuilder = &CleanupJobBuilder{}
+
+// CleanupJobBuilder builds the Job which cleans up the event logs of a deleted history server.
+// The operator can not access the bucket, the credentials are only mounted into the pods.
+type CleanupJobBuilder struct {
+	builder.Job
+
+	LogDirectory LogDirectory
+	Action       string
+	// InstanceName is the namespace/name of the history server, written into the tombstone.
+	InstanceName string
+}
+
+func NewCleanupJobBuilder(
+	client *resourceClient.Client,
+	clusterInfo reconciler.ClusterInfo,
+	image *oputil.Image,
+	logDirectory LogDirectory,
+	action string,
+) *CleanupJobBuilder {
+	job := builder.NewGenericJobBuilder(
+		client,
+		getCleanupJobName(clusterInfo, action),
+		image,
+		nil,
+		nil,
+		func(o *builder.Options) {
+			o.ClusterName = clusterInfo.GetClusterName()
+			o.Labels = clusterInfo.GetLabels()
+			o.Annotations = clusterInfo.GetAnnotations()
+		},
+	)
+	return &CleanupJobBuilder{
+		Job:          *job.(*builder.Job),
+		LogDirectory: logDirectory,
+		Action:       action,
+		InstanceName: client.GetOwnerNamespace() + "/" + clusterInfo.GetClusterName(),
+	}
+}
+
+// getHadoopOptions returns the hadoop properties of the history server as options of the hadoop shell,
+// the values are quoted as they may reference the environment, e.g. ${env.AZURE_STORAGE_ACCOUNT_KEY}.
+func (b *CleanupJobBuilder) getHadoopOptions() string {
+	properties := b.LogDirectory.GetPartialProperties()
+	options := []string{}
+	for _, key := range slices.Sorted(maps.Keys(properties)) {
+		if name, ok := strings.CutPrefix(key, "spark.hadoop."); ok {
+			options = append(options, "-D "+name+"="+shellQuote(properties[key]))
+		}
+	}
+	return strings.Join(options, " ")
+}
+
+func (b *CleanupJobBuilder) getTombstonePath() string {
+	return strings.TrimSuffix(b.LogDirectory.GetLogDirectory(), "/") + "/" + TombstoneFileName
+}
+
+func (b *CleanupJobBuilder) getCmdArgs() string {
+	fsShell := path.Join(constants.KubedoopRoot, "spark/bin/spark-class") + " " + fsShellClass + " " + b.getHadoopOptions()
+
+	command := fsShell + " -rm -r -f -skipTrash " + b.LogDirectory.GetLogDirectory()
+	if b.Action == CleanupActionTombstone {
+		command = `echo "SparkHistoryServer ` + b.InstanceName + ` deleted at $(date -u +%Y-%m-%dT%H:%M:%SZ)" | ` +
+			fsShell + " -put -f - " + b.getTombstonePath()
+	}
+
+	args := `
+` + b.LogDirectory.GetPartialCmdArgs() + `
+` + command + `
+`
+	return oputil.IndentTab4Spaces(args)
+}
+
+func (b *CleanupJobBuilder) Build(_ context.Context) (ctrlclient.Object, error) {
+	containerBuilder := builder.NewContainer(CleanupContainerName, b.GetImage())
+	containerBuilder.SetCommand([]string{"/bin/bash", "-c"})
+	containerBuilder.SetArgs([]string{b.getCmdArgs()})
+	containerBuilder.AddVolumeMount(b.LogDirectory.GetVolumeMount())
+
+	b.AddContainer(containerBuilder.Build())
+	b.AddVolume(b.LogDirectory.GetVolume())
+	b.SetRestPolicy(ptr.To(corev1.RestartPolicyNever))
+
+	obj, err := b.GetObject()
+	if err != nil {
+		return nil, err
+	}
+	obj.Spec.BackoffLimit = ptr.To[int32](cleanupBackoffLimit)
+	return obj, nil
+}
+
+// getCleanupJobName returns the name of the Job of a cleanup action, a changed deletion policy runs
+// another Job.
+func getCleanupJobName(clusterInfo reconciler.ClusterInfo, action string) string {
+	return clusterInfo.GetFullName() + "-" + action
+}
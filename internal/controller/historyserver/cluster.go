@@ -6,6 +6,8 @@ import (
 	resourceClient "github.com/zncdatadev/operator-go/pkg/client"
 	"github.com/zncdatadev/operator-go/pkg/reconciler"
 	"github.com/zncdatadev/operator-go/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
 	"github.com/zncdatadev/spark-k8s-operator/internal/util/version"
@@ -68,10 +70,23 @@ func (r *ClusterReconciler) RegisterResource(ctx context.Context) error {
 		RoleName:    RoleName,
 	}
 
+	var authentication *Authentication
+	if r.ClusterConfig.Authentication != nil {
+		var err error
+		if authentication, err = NewAuthentication(ctx, r.Client, r.ClusterConfig.Authentication); err != nil {
+			return err
+		}
+	}
+
+	if err := validateAuthorization(r.ClusterConfig.Authorization, authentication); err != nil {
+		return err
+	}
+
 	node := NewNodeRoleReconciler(
 		r.Client,
 		r.IsStopped(),
 		r.ClusterConfig,
+		authentication,
 		roleInfo,
 		r.GetImage(),
 		r.Spec.Node,
@@ -82,5 +97,33 @@ func (r *ClusterReconciler) RegisterResource(ctx context.Context) error {
 
 	r.AddResource(node)
 
+	if r.ClusterConfig.Monitoring != nil && r.ClusterConfig.Monitoring.PrometheusRule != nil {
+		roleGroupInfos := make([]*reconciler.RoleGroupInfo, 0, len(r.Spec.Node.RoleGroups))
+		for name := range r.Spec.Node.RoleGroups {
+			roleGroupInfos = append(roleGroupInfos, &reconciler.RoleGroupInfo{
+				RoleInfo:      roleInfo,
+				RoleGroupName: name,
+			})
+		}
+		r.AddResource(NewPrometheusRuleReconciler(
+			r.Client,
+			r.ClusterInfo,
+			r.ClusterConfig.Monitoring.PrometheusRule,
+			r.ClusterConfig.LogFileDirectory,
+			roleGroupInfos,
+		))
+	} else {
+		// the alerts of the removed rule would keep firing
+		r.AddResource(newObsoleteUnstructuredReconciler(r.Client, PrometheusRuleGVK, r.ClusterInfo.GetFullName()))
+	}
+
+	if r.ClusterConfig.Monitoring != nil && r.ClusterConfig.Monitoring.GrafanaDashboard != nil {
+		r.AddResource(NewDashboardConfigMapReconciler(r.Client, r.ClusterInfo, r.ClusterConfig.Monitoring.GrafanaDashboard))
+	} else {
+		// the Grafana sidecar would keep provisioning the dashboard of the removed section
+		dashboard := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: getDashboardConfigMapName(r.ClusterInfo)}}
+		r.AddResource(NewObsoleteResourceReconciler(r.Client, dashboard))
+	}
+
 	return nil
 }
@@ -2,6 +2,7 @@ package historyserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"maps"
 	"slices"
@@ -12,18 +13,25 @@ import (
 	"github.com/zncdatadev/operator-go/pkg/client"
 	"github.com/zncdatadev/operator-go/pkg/productlogging"
 	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	"go.opentelemetry.io/otel/attribute"
 	"k8s.io/utils/ptr"
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 
 	sparkv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+	"github.com/zncdatadev/spark-k8s-operator/internal/tracing"
+	"github.com/zncdatadev/spark-k8s-operator/internal/util"
 )
 
+// ErrCleanerValidation is returned when the cleaner is enabled for more than one history server instance.
+var ErrCleanerValidation = errors.New("invalid cleaner configuration")
+
 var _ builder.ConfigBuilder = &ConfigMapBuilder{}
 
 type ConfigMapBuilder struct {
 	builder.ConfigMapBuilder
 
 	ClusteerConfig  *sparkv1alpha1.ClusterConfigSpec
+	Authentication  *Authentication
 	RoleGroupConfig *sparkv1alpha1.ConfigSpec
 }
 
@@ -31,45 +39,52 @@ func NewSparkConfigMapBuilder(
 	client *client.Client,
 	name string,
 	clusterConfig *sparkv1alpha1.ClusterConfigSpec,
+	authentication *Authentication,
 	roleGroupConfig *sparkv1alpha1.ConfigSpec,
 	options ...builder.Option,
 ) *ConfigMapBuilder {
 	return &ConfigMapBuilder{
 		ConfigMapBuilder: *builder.NewConfigMapBuilder(client, name, options...),
 		ClusteerConfig:   clusterConfig,
+		Authentication:   authentication,
 		RoleGroupConfig:  roleGroupConfig,
 	}
 }
 
-func (b *ConfigMapBuilder) getS3LogConfig(ctx context.Context) (*S3Logconfig, error) {
-	if b.ClusteerConfig.LogFileDirectory.S3 == nil {
-		return nil, nil
-	}
-	s3Logconfig, err := NewS3Logconfig(
-		ctx,
-		b.GetClient(),
-		b.ClusteerConfig.LogFileDirectory.S3,
-	)
-	if err != nil {
-		return nil, err
-	}
-	return s3Logconfig, nil
+func (b *ConfigMapBuilder) getLogDirectory(ctx context.Context) (LogDirectory, error) {
+	return NewLogDirectory(ctx, b.GetClient(), b.ClusteerConfig.LogFileDirectory)
 }
 
 func (b *ConfigMapBuilder) Build(ctx context.Context) (ctrlclient.Object, error) {
 
-	S3Logconfig, err := b.getS3LogConfig(ctx)
+	logDirectory, err := b.getLogDirectory(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	b.AddItem(SparkConfigDefauleFileName, b.getSparkDefaules(S3Logconfig))
+	sparkDefaults, err := b.getSparkDefaules(logDirectory)
+	if err != nil {
+		return nil, err
+	}
+	b.AddItem(SparkConfigDefauleFileName, sparkDefaults)
 	logProperties, err := b.getLog4j()
 	if err != nil {
 		return nil, err
 	}
 	b.AddItem("log4j2.properties", logProperties)
 
+	jmxExporterConfig, err := getJmxExporterConfig(b.ClusteerConfig.Monitoring)
+	if err != nil {
+		return nil, err
+	}
+	b.AddItem(JmxExporterConfigFileName, jmxExporterConfig)
+	b.AddItem(SparkMetricsConfigFileName, getSparkMetricsConfig())
+
+	if b.Authentication != nil && b.Authentication.IsLdap() {
+		ldapProxy := NewLdapProxy(b.Authentication.GetLdapProvider(), util.HttpPort, getForwardedUserHeader(b.ClusteerConfig))
+		b.AddItem(LdapProxyConfigFileName, ldapProxy.GetConfig())
+	}
+
 	if vectorConfig, err := b.getVectorConfig(ctx); err != nil {
 		return nil, err
 	} else if vectorConfig != "" {
@@ -81,6 +96,7 @@ func (b *ConfigMapBuilder) Build(ctx context.Context) (ctrlclient.Object, error)
 
 func (b *ConfigMapBuilder) getVectorConfig(ctx context.Context) (string, error) {
 	if b.ClusteerConfig != nil && b.ClusteerConfig.VectorAggregatorConfigMapName != "" {
+		ctx, span := tracing.Start(ctx, "VectorAggregatorConfigMap.Get", attribute.String("name", b.ClusteerConfig.VectorAggregatorConfigMapName))
 		s, err := productlogging.MakeVectorYaml(
 			ctx,
 			b.Client.Client,
@@ -90,6 +106,7 @@ func (b *ConfigMapBuilder) getVectorConfig(ctx context.Context) (string, error)
 			b.RoleGroupName,
 			b.ClusteerConfig.VectorAggregatorConfigMapName,
 		)
+		tracing.End(span, err)
 		if err != nil {
 			return "", err
 		}
@@ -108,9 +125,9 @@ func (b *ConfigMapBuilder) isCleaner() (bool, error) {
 	role := owner.Spec.Node
 	if role.Config != nil && role.Config.Cleaner != nil {
 		if *role.Config.Cleaner && len(role.RoleGroups) > 1 {
-			return false, fmt.Errorf("more than one role group has cleaner enabled. Role cleaner can only be enabled for one role group. "+
+			return false, fmt.Errorf("%w: more than one role group has cleaner enabled. Role cleaner can only be enabled for one role group. "+
 				"Namespace: %s, ClusterName: %s, Cleaners %v",
-				b.GetClient().GetOwnerNamespace(), b.GetClient().GetOwnerName(), cleaners,
+				ErrCleanerValidation, b.GetClient().GetOwnerNamespace(), b.GetClient().GetOwnerName(), cleaners,
 			)
 		}
 	}
@@ -119,9 +136,9 @@ func (b *ConfigMapBuilder) isCleaner() (bool, error) {
 		if roleGroup.Config != nil && roleGroup.Config.Cleaner != nil && roleGroup.Replicas != nil {
 			if *roleGroup.Config.Cleaner && *roleGroup.Replicas > 1 {
 				return false, fmt.Errorf(
-					"role group has cleaner enabled but has more than one replica. "+
+					"%w: role group has cleaner enabled but has more than one replica. "+
 						"Namespace: %s, ClusterName: %s, RoleName: %s, RoleGroupName: %s",
-					b.GetClient().GetOwnerNamespace(), b.GetClient().GetOwnerName(), b.RoleName, roleGroupName,
+					ErrCleanerValidation, b.GetClient().GetOwnerNamespace(), b.GetClient().GetOwnerName(), b.RoleName, roleGroupName,
 				)
 			}
 			cleaners[roleGroupName] = *roleGroup.Config.Cleaner
@@ -129,7 +146,7 @@ func (b *ConfigMapBuilder) isCleaner() (bool, error) {
 	}
 
 	for name, enabled := range cleaners {
-		if b.RoleName == name {
+		if b.RoleGroupName == name {
 			return enabled, nil
 		}
 	}
@@ -164,23 +181,56 @@ func (b *ConfigMapBuilder) getLog4j() (string, error) {
 	return logGenerator.Content()
 }
 
-func (b *ConfigMapBuilder) getSparkDefaules(s3Logconfig *S3Logconfig) string {
+func (b *ConfigMapBuilder) getKerberos() *Kerberos {
+	return getKerberos(b.ClusteerConfig, b.Name, b.Client.GetOwnerNamespace())
+}
+
+func (b *ConfigMapBuilder) getUIFilters() []UIFilter {
+	filters := []UIFilter{}
+	// the UI is authenticated by the proxy sidecar when authentication is configured,
+	// otherwise kerberos users are authenticated with SPNEGO
+	if kerberos := b.getKerberos(); kerberos != nil && b.Authentication == nil {
+		filters = append(filters, kerberos.GetSpnegoFilter())
+	}
+	if b.ClusteerConfig.Authorization != nil {
+		filters = append(filters, getAuthorizationFilter(b.ClusteerConfig.Authorization))
+	}
+	return filters
+}
+
+func (b *ConfigMapBuilder) getSparkDefaules(logDirectory LogDirectory) (string, error) {
 
 	config := map[string]string{}
 
 	cleaner, err := b.isCleaner()
 	if err != nil {
-		return ""
+		return "", err
 	}
 
 	if cleaner {
 		config["spark.history.fs.cleaner.enabled"] = trueValue
 	}
 
-	if s3Logconfig != nil {
-		maps.Copy(config, s3Logconfig.GetPartialProperties())
+	maps.Copy(config, logDirectory.GetPartialProperties())
+
+	maps.Copy(config, getSparkMetricsProperties())
+
+	if b.RoleGroupConfig != nil && b.RoleGroupConfig.Ingress != nil {
+		if proxyBase := getIngressProxyBase(b.RoleGroupConfig.Ingress); proxyBase != "" {
+			config["spark.ui.proxyBase"] = proxyBase
+		}
+	}
+
+	if b.ClusteerConfig.Authorization != nil {
+		maps.Copy(config, getAuthorizationProperties(b.ClusteerConfig.Authorization))
 	}
 
+	if kerberos := b.getKerberos(); kerberos != nil {
+		maps.Copy(config, kerberos.GetProperties())
+	}
+
+	maps.Copy(config, getUIFiltersProperties(b.getUIFilters()))
+
 	sortedConfig := make([][]string, 0, len(config))
 	for k, v := range config {
 		sortedConfig = append(sortedConfig, []string{k, v})
@@ -194,12 +244,13 @@ func (b *ConfigMapBuilder) getSparkDefaules(s3Logconfig *S3Logconfig) string {
 		str += kv[0] + "        " + kv[1] + "\n"
 	}
 
-	return str
+	return str, nil
 }
 
 func NewConfigMapReconciler(
 	client *client.Client,
 	clusterConfig *sparkv1alpha1.ClusterConfigSpec,
+	authentication *Authentication,
 	roleGroupInfo reconciler.RoleGroupInfo,
 	roleGroupConfig *sparkv1alpha1.ConfigSpec,
 	options ...builder.Option,
@@ -209,6 +260,7 @@ func NewConfigMapReconciler(
 		client,
 		roleGroupInfo.GetFullName(),
 		clusterConfig,
+		authentication,
 		roleGroupConfig,
 		options...,
 	)
@@ -0,0 +1,84 @@
+package historyserver
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	"k8s.io/utils/ptr"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+func newCleanerTestConfigMapBuilder(t *testing.T, roleGroups map[string]*shsv1alpha1.RoleGroupSpec, roleGroupName string) *ConfigMapBuilder {
+	t.Helper()
+	c := newOptionalTestClient(t)
+	owner := c.OwnerReference.(*shsv1alpha1.SparkHistoryServer)
+	owner.Spec.Node = &shsv1alpha1.RoleSpec{RoleGroups: roleGroups}
+
+	return NewSparkConfigMapBuilder(c, "shs-node-"+roleGroupName, &shsv1alpha1.ClusterConfigSpec{}, nil, nil,
+		func(o *builder.Options) {
+			o.RoleName = RoleName
+			o.RoleGroupName = roleGroupName
+		},
+	)
+}
+
+func TestConfigMapCleanerRoleGroup(t *testing.T) {
+	roleGroups := map[string]*shsv1alpha1.RoleGroupSpec{
+		"default": {Replicas: ptr.To[int32](1), Config: &shsv1alpha1.ConfigSpec{Cleaner: ptr.To(true)}},
+		"other":   {Replicas: ptr.To[int32](1), Config: &shsv1alpha1.ConfigSpec{Cleaner: ptr.To(false)}},
+	}
+
+	for roleGroupName, want := range map[string]bool{"default": true, "other": false} {
+		cleaner, err := newCleanerTestConfigMapBuilder(t, roleGroups, roleGroupName).isCleaner()
+		if err != nil {
+			t.Fatalf("isCleaner() error = %v", err)
+		}
+		if cleaner != want {
+			t.Errorf("isCleaner() of role group %s = %v, want %v", roleGroupName, cleaner, want)
+		}
+	}
+}
+
+// TestConfigMapCleanerRoleGroupNotRoleName covers the cleaner lookup by the role group name. The cleaner
+// was looked up by the role name, so a role group named like the role enabled the cleaner of all role groups.
+func TestConfigMapCleanerRoleGroupNotRoleName(t *testing.T) {
+	roleGroups := map[string]*shsv1alpha1.RoleGroupSpec{
+		RoleName:  {Replicas: ptr.To[int32](1), Config: &shsv1alpha1.ConfigSpec{Cleaner: ptr.To(true)}},
+		"default": {Replicas: ptr.To[int32](1)},
+	}
+
+	for roleGroupName, want := range map[string]bool{RoleName: true, "default": false} {
+		cleaner, err := newCleanerTestConfigMapBuilder(t, roleGroups, roleGroupName).isCleaner()
+		if err != nil {
+			t.Fatalf("isCleaner() error = %v", err)
+		}
+		if cleaner != want {
+			t.Errorf("isCleaner() of role group %s in role %s = %v, want %v", roleGroupName, RoleName, cleaner, want)
+		}
+	}
+}
+
+func TestConfigMapCleanerValidation(t *testing.T) {
+	roleGroups := map[string]*shsv1alpha1.RoleGroupSpec{
+		"default": {Replicas: ptr.To[int32](2), Config: &shsv1alpha1.ConfigSpec{Cleaner: ptr.To(true)}},
+	}
+	logDirectory, err := NewGCSLogconfig(&shsv1alpha1.GCSSpec{
+		Bucket:      "spark-history",
+		Credentials: &commonsv1alpha1.Credentials{SecretClass: "credentials"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sparkDefaults, err := newCleanerTestConfigMapBuilder(t, roleGroups, "default").getSparkDefaules(logDirectory)
+	if !errors.Is(err, ErrCleanerValidation) {
+		t.Fatalf("getSparkDefaules() error = %v, want %v", err, ErrCleanerValidation)
+	}
+	if strings.TrimSpace(sparkDefaults) != "" {
+		t.Errorf("getSparkDefaules() = %q, want no configuration rendered", sparkDefaults)
+	}
+}
@@ -4,3 +4,8 @@ const (
 	trueValue     = "true"
 	defaultScheme = "http"
 )
+
+const (
+	ConditionReasonUnsupportedAuthenticationProvider = "UnsupportedAuthenticationProvider"
+	ConditionReasonInvalidPodOverrides               = "InvalidPodOverrides"
+)
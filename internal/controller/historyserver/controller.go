@@ -18,15 +18,29 @@ package historyserver
 
 import (
 	"context"
+	"errors"
+	"slices"
 
 	"github.com/zncdatadev/operator-go/pkg/client"
 	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	"github.com/zncdatadev/operator-go/pkg/status"
+	"github.com/zncdatadev/operator-go/pkg/util"
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	sparkv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+	"github.com/zncdatadev/spark-k8s-operator/internal/metrics"
+	"github.com/zncdatadev/spark-k8s-operator/internal/tracing"
 )
 
 var (
@@ -37,6 +51,17 @@ var (
 type SparkHistoryServerReconciler struct {
 	ctrlclient.Client
 	Scheme *runtime.Scheme
+	// Recorder records the events of the cleanup of deleted history servers.
+	Recorder events.EventRecorder
+	// APIReader reads from the API server, it lists the discovery ConfigMaps of deleted history servers
+	// in all namespaces.
+	APIReader ctrlclient.Reader
+
+	// Options configures the concurrency and the rate limiting of the controller.
+	Options controller.Options
+	// NamespaceSelector restricts the reconciled history servers to the namespaces it selects, all
+	// namespaces are reconciled when nil.
+	NamespaceSelector labels.Selector
 }
 
 // +kubebuilder:rbac:groups=spark.kubedoop.dev,resources=sparkhistoryservers,verbs=get;list;watch;create;update;patch;delete
@@ -47,31 +72,80 @@ type SparkHistoryServerReconciler struct {
 // +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions/status,verbs=update
 // +kubebuilder:rbac:groups=authentication.kubedoop.dev,resources=authenticationclasses,verbs=get;list;watch
 // +kubebuilder:rbac:groups=s3.kubedoop.dev,resources=s3connections,verbs=get;list;watch
 // +kubebuilder:rbac:groups=s3.kubedoop.dev,resources=s3buckets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses;networkpolicies,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors;podmonitors;prometheusrules,verbs=get;list;watch;create;update;patch;delete
 
-func (r *SparkHistoryServerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *SparkHistoryServerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
 
 	logger.Info("Reconciling SparkHistory")
 
+	ctx, span := tracing.Start(ctx, "SparkHistoryServer.Reconcile",
+		attribute.String("namespace", req.Namespace),
+		attribute.String("name", req.Name),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	instance := &sparkv1alpha1.SparkHistoryServer{}
-	err := r.Get(ctx, req.NamespacedName, instance)
+	err = r.Get(ctx, req.NamespacedName, instance)
 	if err != nil {
 		if ctrlclient.IgnoreNotFound(err) == nil {
 			logger.V(1).Info("SparkHistoryServer resource not found. Ignoring since object must be deleted.")
+			metrics.Forget(req.Namespace, req.Name)
 			return ctrl.Result{}, nil
 		}
 		return ctrl.Result{}, err
 	}
 
+	if !instance.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, instance)
+	}
+	if err := r.ensureFinalizer(ctx, instance); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	resourceClient := &client.Client{
 		Client:         r.Client,
 		OwnerReference: instance,
 	}
 
-	clusterInfo := reconciler.ClusterInfo{
+	reconciler := NewClusterReconciler(resourceClient, getClusterInfo(instance), &instance.Spec)
+	recordImage(instance, reconciler.GetImage())
+
+	if err := reconciler.RegisterResource(ctx); err != nil {
+		metrics.RecordReconcileFailure(getFailureReason(err))
+		if updateErr := r.setReconcileCondition(ctx, instance, err); updateErr != nil {
+			logger.Error(updateErr, "Failed to update SparkHistoryServer status")
+		}
+		return ctrl.Result{}, err
+	}
+
+	if err := r.setReconcileCondition(ctx, instance, nil); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	result, err = reconciler.Run(ctx)
+	if err != nil {
+		metrics.RecordReconcileFailure(getFailureReason(err))
+		return result, err
+	}
+	metrics.RecordReconcileSuccess(instance.Namespace, instance.Name)
+
+	return result, nil
+}
+
+func getClusterInfo(instance *sparkv1alpha1.SparkHistoryServer) reconciler.ClusterInfo {
+	return reconciler.ClusterInfo{
 		GVK: &metav1.GroupVersionKind{
 			Group:   sparkv1alpha1.GroupVersion.Group,
 			Version: sparkv1alpha1.GroupVersion.Version,
@@ -79,19 +153,108 @@ func (r *SparkHistoryServerReconciler) Reconcile(ctx context.Context, req ctrl.R
 		},
 		ClusterName: instance.Name,
 	}
+}
 
-	reconciler := NewClusterReconciler(resourceClient, clusterInfo, &instance.Spec)
+// getFailureReason maps a reconcile error to the reason of the failure metric.
+func getFailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrS3Resolution):
+		return metrics.ReasonS3
+	case errors.Is(err, ErrAuthentication), errors.Is(err, ErrUnsupportedAuthenticationProvider):
+		return metrics.ReasonAuthentication
+	case errors.Is(err, ErrCleanerValidation):
+		return metrics.ReasonCleaner
+	default:
+		return metrics.ReasonOther
+	}
+}
 
-	if err := reconciler.RegisterResource(ctx); err != nil {
-		return ctrl.Result{}, err
+func recordImage(instance *sparkv1alpha1.SparkHistoryServer, image *util.Image) {
+	imageWithTag, err := image.GetImageWithTag()
+	if err != nil {
+		logger.Error(err, "Failed to resolve the image of SparkHistoryServer")
+		return
+	}
+	metrics.SetImage(instance.Namespace, instance.Name, imageWithTag, image.ProductVersion)
+}
+
+// setReconcileCondition records the result of resolving the cluster resources in the Reconcile condition,
+// so that configuration errors, e.g. an unsupported authentication provider, are visible on the object.
+// The public URLs of the ingress are updated together with the condition.
+func (r *SparkHistoryServerReconciler) setReconcileCondition(ctx context.Context, instance *sparkv1alpha1.SparkHistoryServer, err error) error {
+	condition := metav1.Condition{
+		Type:    status.ConditionTypeReconcile,
+		Status:  metav1.ConditionTrue,
+		Reason:  status.ConditionReasonReady,
+		Message: "Resources of SparkHistoryServer are resolved",
+	}
+
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = status.ConditionReasonFail
+		condition.Message = err.Error()
+		switch {
+		case errors.Is(err, ErrUnsupportedAuthenticationProvider):
+			condition.Reason = ConditionReasonUnsupportedAuthenticationProvider
+		case errors.Is(err, ErrPodOverridesValidation):
+			condition.Reason = ConditionReasonInvalidPodOverrides
+		}
+	}
+
+	urls, urlsErr := GetIngressURLs(&instance.Spec)
+	if urlsErr != nil {
+		return urlsErr
+	}
+	urlsChanged := !slices.Equal(instance.Status.URLs, urls)
+	instance.Status.URLs = urls
+
+	if !instance.Status.SetStatusCondition(condition) && !urlsChanged {
+		return nil
 	}
 
-	return reconciler.Run(ctx)
+	return r.Status().Update(ctx, instance)
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *SparkHistoryServerReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&sparkv1alpha1.SparkHistoryServer{}).
-		Complete(r)
+		WithOptions(r.Options)
+
+	if r.NamespaceSelector != nil {
+		// reconcile the history servers of a namespace when it starts matching the selector
+		b = b.Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.getNamespaceRequests)).
+			WithEventFilter(predicate.NewPredicateFuncs(func(obj ctrlclient.Object) bool {
+				return r.isNamespaceSelected(context.Background(), obj)
+			}))
+	}
+
+	return b.Complete(r)
+}
+
+// isNamespaceSelected returns whether the namespace of the object, or the object itself when it is
+// a namespace, matches the namespace selector.
+func (r *SparkHistoryServerReconciler) isNamespaceSelected(ctx context.Context, obj ctrlclient.Object) bool {
+	namespace, ok := obj.(*corev1.Namespace)
+	if !ok {
+		namespace = &corev1.Namespace{}
+		if err := r.Get(ctx, ctrlclient.ObjectKey{Name: obj.GetNamespace()}, namespace); err != nil {
+			logger.Error(err, "Failed to get namespace", "namespace", obj.GetNamespace())
+			return false
+		}
+	}
+	return r.NamespaceSelector.Matches(labels.Set(namespace.Labels))
+}
+
+func (r *SparkHistoryServerReconciler) getNamespaceRequests(ctx context.Context, obj ctrlclient.Object) []reconcile.Request {
+	list := &sparkv1alpha1.SparkHistoryServerList{}
+	if err := r.List(ctx, list, ctrlclient.InNamespace(obj.GetName())); err != nil {
+		logger.Error(err, "Failed to list SparkHistoryServers", "namespace", obj.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, item := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: ctrlclient.ObjectKeyFromObject(&item)})
+	}
+	return requests
 }
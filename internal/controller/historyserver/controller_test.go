@@ -0,0 +1,323 @@
+/*
+Copyright 2023 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package historyserver
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/authentication/v1alpha1"
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	s3v1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/s3/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+	"github.com/zncdatadev/spark-k8s-operator/internal/util"
+)
+
+const (
+	reconcileTimeout  = 30 * time.Second
+	reconcileInterval = 100 * time.Millisecond
+)
+
+// recorder receives the events of the reconcilers of the tests.
+var recorder = events.NewFakeRecorder(100)
+
+func newReconciler() *SparkHistoryServerReconciler {
+	return &SparkHistoryServerReconciler{Client: k8sClient, Scheme: k8sClient.Scheme(), Recorder: recorder, APIReader: k8sClient}
+}
+
+// reconcileUntil reconciles the history server until check passes. The resources are created one per
+// reconcile, because every created resource requeues the request.
+func reconcileUntil(name types.NamespacedName, check func(g Gomega)) {
+	r := newReconciler()
+	Eventually(func(g Gomega) {
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: name})
+		g.Expect(err).NotTo(HaveOccurred())
+		check(g)
+	}).WithTimeout(reconcileTimeout).WithPolling(reconcileInterval).Should(Succeed())
+}
+
+func getServicePortNames(service *corev1.Service) []string {
+	names := make([]string, 0, len(service.Spec.Ports))
+	for _, port := range service.Spec.Ports {
+		names = append(names, port.Name)
+	}
+	return names
+}
+
+func newHistoryServer(namespace string) *shsv1alpha1.SparkHistoryServer {
+	return &shsv1alpha1.SparkHistoryServer{
+		ObjectMeta: metav1.ObjectMeta{Name: "sparkhistory", Namespace: namespace},
+		Spec: shsv1alpha1.SparkHistoryServerSpec{
+			ClusterConfig: &shsv1alpha1.ClusterConfigSpec{
+				ListenerClass: "cluster-internal",
+				LogFileDirectory: &shsv1alpha1.LogFileDirectorySpec{
+					S3: &shsv1alpha1.S3Spec{
+						Prefix: "events",
+						Bucket: &shsv1alpha1.BucketSpec{Reference: "spark-history"},
+					},
+				},
+			},
+			Node: &shsv1alpha1.RoleSpec{
+				RoleGroups: map[string]*shsv1alpha1.RoleGroupSpec{
+					"default": {Replicas: ptr.To[int32](1)},
+				},
+			},
+		},
+	}
+}
+
+var _ = Describe("SparkHistoryServer Controller", func() {
+	var (
+		namespace string
+		key       types.NamespacedName
+		roleGroup string
+		instance  *shsv1alpha1.SparkHistoryServer
+	)
+
+	BeforeEach(func() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "shs-"}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+		namespace = ns.Name
+
+		By("creating the S3 connection and bucket of the event logs")
+		Expect(k8sClient.Create(ctx, &s3v1alpha1.S3Connection{
+			ObjectMeta: metav1.ObjectMeta{Name: "minio", Namespace: namespace},
+			Spec: s3v1alpha1.S3ConnectionSpec{
+				Host:        "minio." + namespace + ".svc.cluster.local",
+				Port:        9000,
+				PathStyle:   true,
+				Credentials: &commonsv1alpha1.Credentials{SecretClass: "s3-credentials"},
+			},
+		})).To(Succeed())
+		Expect(k8sClient.Create(ctx, &s3v1alpha1.S3Bucket{
+			ObjectMeta: metav1.ObjectMeta{Name: "spark-history", Namespace: namespace},
+			Spec: s3v1alpha1.S3BucketSpec{
+				BucketName: "spark-history",
+				Connection: &s3v1alpha1.S3BucketConnectionSpec{Reference: "minio"},
+			},
+		})).To(Succeed())
+
+		instance = newHistoryServer(namespace)
+		key = types.NamespacedName{Name: instance.Name, Namespace: namespace}
+		roleGroup = instance.Name + "-" + RoleName + "-default"
+	})
+
+	getStatefulSet := func(g Gomega) *appsv1.StatefulSet {
+		sts := &appsv1.StatefulSet{}
+		g.Expect(k8sClient.Get(ctx, types.NamespacedName{Name: roleGroup, Namespace: namespace}, sts)).To(Succeed())
+		return sts
+	}
+
+	updateClusterOperation := func(operation *commonsv1alpha1.ClusterOperationSpec, replicas int32) {
+		Eventually(func(g Gomega) {
+			g.Expect(k8sClient.Get(ctx, key, instance)).To(Succeed())
+			instance.Spec.ClusterOperation = operation
+			instance.Spec.Node.RoleGroups["default"].Replicas = ptr.To(replicas)
+			g.Expect(k8sClient.Update(ctx, instance)).To(Succeed())
+		}).WithTimeout(reconcileTimeout).Should(Succeed())
+	}
+
+	Context("with the event logs in S3", func() {
+		BeforeEach(func() {
+			Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+		})
+
+		It("should create the ConfigMap, StatefulSet and Services of the role group", func() {
+			reconcileUntil(key, func(g Gomega) {
+				cm := &corev1.ConfigMap{}
+				g.Expect(k8sClient.Get(ctx, types.NamespacedName{Name: roleGroup, Namespace: namespace}, cm)).To(Succeed())
+				g.Expect(cm.Data).To(HaveKey(SparkConfigDefauleFileName))
+				g.Expect(cm.Data[SparkConfigDefauleFileName]).To(ContainSubstring("s3a://spark-history/events"))
+				g.Expect(cm.Data).To(HaveKey(JmxExporterConfigFileName))
+
+				sts := getStatefulSet(g)
+				g.Expect(sts.Spec.Replicas).To(Equal(ptr.To[int32](1)))
+				g.Expect(sts.Spec.Template.Spec.Containers).NotTo(BeEmpty())
+				g.Expect(sts.Spec.Template.Spec.Containers[0].Name).To(Equal(SparkHistoryContainerName))
+
+				svc := &corev1.Service{}
+				g.Expect(k8sClient.Get(ctx, types.NamespacedName{Name: roleGroup, Namespace: namespace}, svc)).To(Succeed())
+				g.Expect(svc.Spec.Type).To(Equal(corev1.ServiceTypeClusterIP))
+				g.Expect(getServicePortNames(svc)).To(ConsistOf(util.HttpPortName, util.MetricPortName))
+
+				metricsSvc := &corev1.Service{}
+				g.Expect(k8sClient.Get(ctx, types.NamespacedName{Name: roleGroup + "-metrics", Namespace: namespace}, metricsSvc)).To(Succeed())
+				g.Expect(metricsSvc.Spec.ClusterIP).To(Equal(corev1.ClusterIPNone))
+				g.Expect(metricsSvc.Annotations).To(HaveKeyWithValue("prometheus.io/scrape", "true"))
+
+				replicaSvc := &corev1.Service{}
+				g.Expect(k8sClient.Get(ctx, types.NamespacedName{Name: roleGroup + "-0", Namespace: namespace}, replicaSvc)).To(Succeed())
+				g.Expect(replicaSvc.Spec.Selector).To(HaveKeyWithValue(PodNameLabel, roleGroup+"-0"))
+			})
+		})
+
+		It("should scale the StatefulSet to zero when stopped and back when resumed", func() {
+			reconcileUntil(key, func(g Gomega) {
+				g.Expect(getStatefulSet(g).Spec.Replicas).To(Equal(ptr.To[int32](1)))
+			})
+
+			By("stopping the cluster")
+			updateClusterOperation(&commonsv1alpha1.ClusterOperationSpec{Stopped: true}, 1)
+			reconcileUntil(key, func(g Gomega) {
+				g.Expect(getStatefulSet(g).Spec.Replicas).To(Equal(ptr.To[int32](0)))
+			})
+
+			By("resuming the cluster")
+			updateClusterOperation(&commonsv1alpha1.ClusterOperationSpec{Stopped: false}, 1)
+			reconcileUntil(key, func(g Gomega) {
+				g.Expect(getStatefulSet(g).Spec.Replicas).To(Equal(ptr.To[int32](1)))
+			})
+		})
+
+		It("should not update the resources while the reconciliation is paused", func() {
+			reconcileUntil(key, func(g Gomega) {
+				g.Expect(getStatefulSet(g).Spec.Replicas).To(Equal(ptr.To[int32](1)))
+			})
+
+			By("pausing the reconciliation and scaling the role group")
+			updateClusterOperation(&commonsv1alpha1.ClusterOperationSpec{ReconciliationPaused: true}, 2)
+			r := newReconciler()
+			Consistently(func(g Gomega) {
+				_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(getStatefulSet(g).Spec.Replicas).To(Equal(ptr.To[int32](1)))
+			}).WithTimeout(2 * time.Second).WithPolling(reconcileInterval).Should(Succeed())
+
+			By("resuming the reconciliation")
+			updateClusterOperation(&commonsv1alpha1.ClusterOperationSpec{ReconciliationPaused: false}, 2)
+			reconcileUntil(key, func(g Gomega) {
+				g.Expect(getStatefulSet(g).Spec.Replicas).To(Equal(ptr.To[int32](2)))
+			})
+		})
+	})
+
+	Context("with the deletion policy Delete", func() {
+		BeforeEach(func() {
+			instance.Spec.DeletionPolicy = shsv1alpha1.DeletionPolicyDelete
+			instance.Spec.Cleanup = &shsv1alpha1.CleanupSpec{RemoveDiscoveryConfigMaps: true}
+			Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+		})
+
+		It("should purge the event logs and remove the discovery ConfigMaps before the deletion", func() {
+			By("creating a discovery ConfigMap in another namespace")
+			other := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "shs-client-"}}
+			Expect(k8sClient.Create(ctx, other)).To(Succeed())
+			discovery := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "sparkhistory-discovery",
+					Namespace: other.Name,
+					Labels: map[string]string{
+						DiscoveryNamespaceLabel: namespace,
+						DiscoveryNameLabel:      instance.Name,
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, discovery)).To(Succeed())
+
+			reconcileUntil(key, func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, key, instance)).To(Succeed())
+				g.Expect(instance.Finalizers).To(ContainElement(Finalizer))
+			})
+
+			By("deleting the history server")
+			Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+			job := &batchv1.Job{}
+			jobKey := types.NamespacedName{Name: instance.Name + "-" + CleanupActionPurge, Namespace: namespace}
+			reconcileUntil(key, func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, jobKey, job)).To(Succeed())
+			})
+			Expect(job.Spec.Template.Spec.Containers[0].Args[0]).To(ContainSubstring("-rm -r -f -skipTrash s3a://spark-history/events"))
+			Expect(k8sClient.Get(ctx, key, instance)).To(Succeed())
+			Expect(instance.Finalizers).To(ContainElement(Finalizer))
+
+			By("completing the cleanup job")
+			// there is no job controller in the test environment
+			now := metav1.Now()
+			job.Status.StartTime = &now
+			job.Status.CompletionTime = &now
+			job.Status.Succeeded = 1
+			job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+			Expect(k8sClient.Status().Update(ctx, job)).To(Succeed())
+
+			reconcileUntil(key, func(g Gomega) {
+				g.Expect(apierrors.IsNotFound(k8sClient.Get(ctx, key, &shsv1alpha1.SparkHistoryServer{}))).To(BeTrue())
+				g.Expect(apierrors.IsNotFound(k8sClient.Get(ctx, ctrlclient.ObjectKeyFromObject(discovery), &corev1.ConfigMap{}))).To(BeTrue())
+			})
+			Eventually(recorder.Events).Should(Receive(And(
+				ContainSubstring(CleanupReason),
+				ContainSubstring("Cleaned up the event logs: purged the event logs in s3a://spark-history/events"),
+			)))
+			Eventually(recorder.Events).Should(Receive(And(
+				ContainSubstring(CleanupReason),
+				ContainSubstring("Removed 1 discovery ConfigMaps"),
+			)))
+		})
+	})
+
+	Context("with OIDC authentication", func() {
+		BeforeEach(func() {
+			authClass := &authv1alpha1.AuthenticationClass{
+				ObjectMeta: metav1.ObjectMeta{Name: "oidc-" + namespace},
+				Spec: authv1alpha1.AuthenticationClassSpec{
+					AuthenticationProvider: &authv1alpha1.AuthenticationProvider{
+						OIDC: &authv1alpha1.OIDCProvider{
+							Hostname:       "keycloak." + namespace + ".svc.cluster.local",
+							Port:           8080,
+							PrincipalClaim: "preferred_username",
+							ProviderHint:   "keycloak",
+							RootPath:       "/realms/kubedoop",
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, authClass)).To(Succeed())
+
+			instance.Spec.ClusterConfig.Authentication = &shsv1alpha1.AuthenticationSpec{
+				AuthenticationClass: authClass.Name,
+				Oidc:                &shsv1alpha1.OidcSpec{ClientCredentialsSecret: "oidc-credentials"},
+			}
+			Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+		})
+
+		It("should only expose the UI through the authentication proxy", func() {
+			reconcileUntil(key, func(g Gomega) {
+				sts := getStatefulSet(g)
+				g.Expect(sts.Spec.Template.Spec.Containers).To(HaveLen(2))
+				g.Expect(sts.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{
+					Name:  "SPARK_LOCAL_IP",
+					Value: LoopbackAddress,
+				}))
+
+				svc := &corev1.Service{}
+				g.Expect(k8sClient.Get(ctx, types.NamespacedName{Name: roleGroup, Namespace: namespace}, svc)).To(Succeed())
+				g.Expect(getServicePortNames(svc)).To(ConsistOf(util.OidcPortName, util.MetricPortName))
+			})
+		})
+	})
+})
@@ -0,0 +1,104 @@
+package historyserver
+
+import (
+	"context"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"strings"
+
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	"github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+const (
+	GrafanaDashboardLabel = "grafana_dashboard"
+
+	// placeholders of the dashboard, the Grafana variables use the `$var` syntax
+	dashboardNamespacePlaceholder = "__NAMESPACE__"
+	dashboardClusterPlaceholder   = "__CLUSTER__"
+	dashboardUIDPlaceholder       = "__UID__"
+)
+
+// historyServerDashboard shows the JVM, UI, event log listing and S3 metrics of the role groups,
+// the pods are selected by the namespace, cluster and role group variables of the dashboard.
+//
+//go:embed dashboards/spark-history-server.json
+var historyServerDashboard string
+
+// getDashboardUID returns a stable uid per cluster within the 40 characters limit of Grafana.
+func getDashboardUID(namespace, clusterName string) string {
+	sum := sha256.Sum256([]byte(namespace + "/" + clusterName))
+	return "spark-history-" + hex.EncodeToString(sum[:8])
+}
+
+var _ builder.ConfigBuilder = &DashboardConfigMapBuilder{}
+
+// DashboardConfigMapBuilder builds the ConfigMap with the Grafana dashboard of a SparkHistoryServer.
+type DashboardConfigMapBuilder struct {
+	builder.ConfigMapBuilder
+
+	Spec        *shsv1alpha1.GrafanaDashboardSpec
+	ClusterName string
+}
+
+func NewDashboardConfigMapBuilder(
+	client *client.Client,
+	name string,
+	clusterName string,
+	spec *shsv1alpha1.GrafanaDashboardSpec,
+	options ...builder.Option,
+) *DashboardConfigMapBuilder {
+	return &DashboardConfigMapBuilder{
+		ConfigMapBuilder: *builder.NewConfigMapBuilder(client, name, options...),
+		Spec:             spec,
+		ClusterName:      clusterName,
+	}
+}
+
+func (b *DashboardConfigMapBuilder) getDashboard() string {
+	namespace := b.Client.GetOwnerNamespace()
+	return strings.NewReplacer(
+		dashboardNamespacePlaceholder, namespace,
+		dashboardClusterPlaceholder, b.ClusterName,
+		dashboardUIDPlaceholder, getDashboardUID(namespace, b.ClusterName),
+	).Replace(historyServerDashboard)
+}
+
+func (b *DashboardConfigMapBuilder) Build(_ context.Context) (ctrlclient.Object, error) {
+	b.AddLabels(map[string]string{GrafanaDashboardLabel: "1"})
+	b.AddLabels(b.Spec.Labels)
+	b.AddAnnotations(b.Spec.Annotations)
+
+	b.AddItem("spark-history-server-"+b.ClusterName+".json", b.getDashboard())
+
+	return b.GetObject(), nil
+}
+
+// getDashboardConfigMapName returns the name of the dashboard ConfigMap of a SparkHistoryServer.
+func getDashboardConfigMapName(clusterInfo reconciler.ClusterInfo) string {
+	return clusterInfo.GetFullName() + "-grafana-dashboard"
+}
+
+func NewDashboardConfigMapReconciler(
+	client *client.Client,
+	clusterInfo reconciler.ClusterInfo,
+	spec *shsv1alpha1.GrafanaDashboardSpec,
+) *reconciler.SimpleResourceReconciler[*DashboardConfigMapBuilder] {
+	b := NewDashboardConfigMapBuilder(
+		client,
+		getDashboardConfigMapName(clusterInfo),
+		clusterInfo.GetClusterName(),
+		spec,
+		func(o *builder.Options) {
+			o.ClusterName = clusterInfo.GetClusterName()
+			o.Labels = clusterInfo.GetLabels()
+			o.Annotations = clusterInfo.GetAnnotations()
+		},
+	)
+	return reconciler.NewSimpleResourceReconciler[*DashboardConfigMapBuilder](client, b)
+}
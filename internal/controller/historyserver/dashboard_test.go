@@ -0,0 +1,86 @@
+package historyserver
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+func TestDashboardConfigMap(t *testing.T) {
+	c := newOptionalTestClient(t)
+	clusterInfo := newOptionalTestRoleGroupInfo(c).ClusterInfo
+	spec := &shsv1alpha1.GrafanaDashboardSpec{
+		Labels:      map[string]string{"team": "data"},
+		Annotations: map[string]string{"grafana_folder": "Spark"},
+	}
+
+	r := NewDashboardConfigMapReconciler(c, clusterInfo, spec)
+	obj, err := r.GetBuilder().Build(context.Background())
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	cm := obj.(*corev1.ConfigMap)
+
+	if cm.Name != getDashboardConfigMapName(clusterInfo) {
+		t.Errorf("name = %s, want %s", cm.Name, getDashboardConfigMapName(clusterInfo))
+	}
+	for key, value := range map[string]string{GrafanaDashboardLabel: "1", "team": "data", "app.kubernetes.io/instance": "shs"} {
+		if cm.Labels[key] != value {
+			t.Errorf("label %s = %q, want %q", key, cm.Labels[key], value)
+		}
+	}
+	if cm.Annotations["grafana_folder"] != "Spark" {
+		t.Errorf("annotations = %v, want the annotations of the spec", cm.Annotations)
+	}
+
+	data, ok := cm.Data["spark-history-server-shs.json"]
+	if !ok || len(cm.Data) != 1 {
+		t.Fatalf("data keys = %v, want the dashboard of the cluster", cm.Data)
+	}
+	for _, placeholder := range []string{dashboardNamespacePlaceholder, dashboardClusterPlaceholder, dashboardUIDPlaceholder} {
+		if strings.Contains(data, placeholder) {
+			t.Errorf("the dashboard contains the placeholder %s", placeholder)
+		}
+	}
+	dashboard := map[string]any{}
+	if err := json.Unmarshal([]byte(data), &dashboard); err != nil {
+		t.Fatalf("the dashboard is not valid JSON: %v", err)
+	}
+	uid, _ := dashboard["uid"].(string)
+	if uid != getDashboardUID("default", "shs") || len(uid) > 40 {
+		t.Errorf("uid = %s, want the uid of the cluster within 40 characters", uid)
+	}
+	if getDashboardUID("default", "shs") == getDashboardUID("other", "shs") {
+		t.Error("the uid of the clusters in different namespaces is equal")
+	}
+}
+
+func TestDashboardConfigMapDeletedWhenRemoved(t *testing.T) {
+	ctx := context.Background()
+	c := newOptionalTestClient(t)
+	clusterInfo := newOptionalTestRoleGroupInfo(c).ClusterInfo
+
+	if _, err := NewDashboardConfigMapReconciler(c, clusterInfo, &shsv1alpha1.GrafanaDashboardSpec{}).Reconcile(ctx); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	key := ctrlclient.ObjectKey{Namespace: "default", Name: getDashboardConfigMapName(clusterInfo)}
+	if err := c.Client.Get(ctx, key, &corev1.ConfigMap{}); err != nil {
+		t.Fatalf("Get() error = %v, want the dashboard created", err)
+	}
+
+	dashboard := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: getDashboardConfigMapName(clusterInfo)}}
+	if _, err := NewObsoleteResourceReconciler(c, dashboard).Reconcile(ctx); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if err := c.Client.Get(ctx, key, &corev1.ConfigMap{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Get() error = %v, want the dashboard deleted", err)
+	}
+}
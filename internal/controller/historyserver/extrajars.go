@@ -0,0 +1,264 @@
+package historyserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	"github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	oputil "github.com/zncdatadev/operator-go/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+const (
+	ExtraJarsContainerName = "extra-jars"
+	ExtraJarsVolumeName    = "extra-jars"
+	// ExtraJarsDir is on the classpath of the history server, see SPARK_DAEMON_CLASSPATH.
+	ExtraJarsDir = "/kubedoop/spark/extra-jars"
+
+	extraJarsS3VolumePrefix  = "extra-jars-s3-"
+	extraJarsOCIVolumePrefix = "extra-jars-oci-"
+)
+
+var ErrExtraJarsValidation = errors.New("invalid extra jars")
+
+// extraJar is an extra jar with its resolved S3 bucket.
+type extraJar struct {
+	*shsv1alpha1.ExtraJarSpec
+	s3BucketConnect *S3BucketConnect
+}
+
+// ExtraJars downloads the extra jars with an init container into a volume shared with the history server.
+type ExtraJars struct {
+	jars []extraJar
+}
+
+// NewExtraJars validates the extra jars and resolves their S3 buckets, it returns nil without extra jars.
+func NewExtraJars(ctx context.Context, client *client.Client, specs []shsv1alpha1.ExtraJarSpec) (*ExtraJars, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	jars := make([]extraJar, 0, len(specs))
+	fileNames := map[string]int{}
+	for i := range specs {
+		spec := &specs[i]
+		if err := validateExtraJar(i, spec); err != nil {
+			return nil, err
+		}
+
+		// the jars of an OCI image are copied with their names
+		if fileName := getExtraJarFileName(spec); fileName != "" {
+			if previous, ok := fileNames[fileName]; ok {
+				return nil, fmt.Errorf("%w: the extra jars %d and %d are both named %s", ErrExtraJarsValidation, previous, i, fileName)
+			}
+			fileNames[fileName] = i
+		}
+
+		jar := extraJar{ExtraJarSpec: spec}
+		if spec.S3 != nil {
+			s3BucketConnect, err := GetS3BucketConnect(ctx, client, spec.S3.Bucket)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrS3Resolution, err)
+			}
+			jar.s3BucketConnect = s3BucketConnect
+		}
+		jars = append(jars, jar)
+	}
+	return &ExtraJars{jars: jars}, nil
+}
+
+func validateExtraJar(index int, spec *shsv1alpha1.ExtraJarSpec) error {
+	sources := 0
+	for _, set := range []bool{spec.S3 != nil, spec.HTTP != nil, spec.OCI != nil} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("%w: exactly one of s3, http and oci must be set for the extra jar %d", ErrExtraJarsValidation, index)
+	}
+	if spec.S3 != nil && spec.S3.Bucket == nil {
+		return fmt.Errorf("%w: the bucket of the extra jar %d is required", ErrExtraJarsValidation, index)
+	}
+	if spec.HTTP != nil {
+		if u, err := url.Parse(spec.HTTP.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("%w: the url of the extra jar %d is not a HTTP URL: %s", ErrExtraJarsValidation, index, spec.HTTP.URL)
+		}
+	}
+	return nil
+}
+
+// getExtraJarFileName returns the file name of a downloaded jar, empty for the jars of an OCI image.
+func getExtraJarFileName(spec *shsv1alpha1.ExtraJarSpec) string {
+	switch {
+	case spec.S3 != nil:
+		return path.Base(spec.S3.Key)
+	case spec.HTTP != nil:
+		u, _ := url.Parse(spec.HTTP.URL)
+		return path.Base(u.Path)
+	}
+	return ""
+}
+
+func getExtraJarS3MountPath(index int) string {
+	return path.Join(constants.KubedoopSecretDir, extraJarsS3VolumePrefix+strconv.Itoa(index))
+}
+
+func getExtraJarOCIMountPath(index int) string {
+	return path.Join(constants.KubedoopRoot, ExtraJarsVolumeName, "oci", strconv.Itoa(index))
+}
+
+// GetVolumeMount returns the mount of the downloaded jars in the history server container.
+func (e *ExtraJars) GetVolumeMount() *corev1.VolumeMount {
+	return &corev1.VolumeMount{
+		Name:      ExtraJarsVolumeName,
+		MountPath: ExtraJarsDir,
+		ReadOnly:  true,
+	}
+}
+
+// GetVolumes returns the shared volume of the jars, the credentials of the S3 buckets and the OCI images.
+func (e *ExtraJars) GetVolumes() []corev1.Volume {
+	volumes := []corev1.Volume{
+		{
+			Name:         ExtraJarsVolumeName,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		},
+	}
+	for i, jar := range e.jars {
+		switch {
+		case jar.S3 != nil && jar.s3BucketConnect.credential != nil:
+			volumes = append(volumes, *newCredentialsVolume(extraJarsS3VolumePrefix+strconv.Itoa(i), jar.s3BucketConnect.credential))
+		case jar.OCI != nil:
+			volumes = append(volumes, corev1.Volume{
+				Name: extraJarsOCIVolumePrefix + strconv.Itoa(i),
+				VolumeSource: corev1.VolumeSource{
+					Image: &corev1.ImageVolumeSource{
+						Reference:  jar.OCI.Reference,
+						PullPolicy: jar.OCI.PullPolicy,
+					},
+				},
+			})
+		}
+	}
+	return volumes
+}
+
+func (e *ExtraJars) getVolumeMounts() []corev1.VolumeMount {
+	mounts := []corev1.VolumeMount{
+		{
+			Name:      ExtraJarsVolumeName,
+			MountPath: ExtraJarsDir,
+		},
+	}
+	for i, jar := range e.jars {
+		switch {
+		case jar.S3 != nil && jar.s3BucketConnect.credential != nil:
+			mounts = append(mounts, corev1.VolumeMount{
+				Name:      extraJarsS3VolumePrefix + strconv.Itoa(i),
+				MountPath: getExtraJarS3MountPath(i),
+			})
+		case jar.OCI != nil:
+			mounts = append(mounts, corev1.VolumeMount{
+				Name:      extraJarsOCIVolumePrefix + strconv.Itoa(i),
+				MountPath: getExtraJarOCIMountPath(i),
+				ReadOnly:  true,
+			})
+		}
+	}
+	return mounts
+}
+
+// getS3Command returns the command downloading a jar from S3 with the hadoop shell, the credentials
+// are only exported to the shell of the download.
+func (e *ExtraJars) getS3Command(index int, jar extraJar, target string) string {
+	connect := jar.s3BucketConnect
+	options := []string{
+		"-D fs.s3a.endpoint=" + shellQuote(connect.Endpoint.String()),
+		"-D fs.s3a.path.style.access=" + strconv.FormatBool(connect.PathStyle),
+		"-D fs.s3a.connection.ssl.enabled=" + strconv.FormatBool(connect.Endpoint.Scheme == "https"),
+	}
+	source := url.URL{Scheme: "s3a", Host: connect.Bucket, Path: "/" + strings.TrimPrefix(jar.S3.Key, "/")}
+
+	credentials := ""
+	if connect.credential != nil {
+		mountPath := getExtraJarS3MountPath(index)
+		credentials = "export AWS_ACCESS_KEY_ID=$(cat " + path.Join(mountPath, S3AccessKeyName) + ") " +
+			"AWS_SECRET_ACCESS_KEY=$(cat " + path.Join(mountPath, S3SecretKeyName) + "); "
+	}
+	return "(" + credentials + path.Join(constants.KubedoopRoot, "spark/bin/spark-class") + " " + fsShellClass + " " +
+		strings.Join(options, " ") + " -copyToLocal -f " + shellQuote(source.String()) + " " + shellQuote(target) + ")"
+}
+
+// GetEgressEndpoints returns the endpoints the jars are downloaded from, the jars of OCI images are pulled
+// by the kubelet. The redirects followed by the HTTP downloads are not known.
+func (e *ExtraJars) GetEgressEndpoints() []url.URL {
+	endpoints := []url.URL{}
+	for _, jar := range e.jars {
+		switch {
+		case jar.S3 != nil:
+			endpoints = append(endpoints, jar.s3BucketConnect.Endpoint)
+		case jar.HTTP != nil:
+			if endpoint, err := url.Parse(jar.HTTP.URL); err == nil {
+				endpoints = append(endpoints, *endpoint)
+			}
+		}
+	}
+	return endpoints
+}
+
+func (e *ExtraJars) getCmdArgs() string {
+	commands := []string{"set -euo pipefail"}
+	for i, jar := range e.jars {
+		target := path.Join(ExtraJarsDir, getExtraJarFileName(jar.ExtraJarSpec))
+		switch {
+		case jar.S3 != nil:
+			commands = append(commands,
+				"echo "+shellQuote("Downloading "+jar.S3.Key+" from the bucket "+jar.s3BucketConnect.Bucket),
+				e.getS3Command(i, jar, target),
+			)
+		case jar.HTTP != nil:
+			commands = append(commands,
+				"echo "+shellQuote("Downloading "+jar.HTTP.URL),
+				"curl --fail --silent --show-error --location --retry 3 --output "+shellQuote(target)+" "+shellQuote(jar.HTTP.URL),
+				"echo "+shellQuote(jar.HTTP.SHA256+"  "+target)+" | sha256sum --check --strict -",
+			)
+		case jar.OCI != nil:
+			source := path.Join(getExtraJarOCIMountPath(i), jar.OCI.Path)
+			commands = append(commands,
+				"echo "+shellQuote("Copying the jars of "+jar.OCI.Reference),
+				"cp -v "+shellQuote(source)+"/*.jar "+ExtraJarsDir+"/",
+			)
+		}
+	}
+
+	args := `
+` + strings.Join(commands, "\n") + `
+`
+	return oputil.IndentTab4Spaces(args)
+}
+
+// GetInitContainer returns the init container downloading the jars, it runs the product image which
+// provides the hadoop shell and curl, with the user of the history server.
+func (e *ExtraJars) GetInitContainer(image *oputil.Image) *corev1.Container {
+	containerBuilder := builder.NewContainer(ExtraJarsContainerName, image)
+	containerBuilder.SetCommand([]string{"/bin/bash", "-c"})
+	containerBuilder.SetArgs([]string{e.getCmdArgs()})
+	containerBuilder.AddVolumeMounts(e.getVolumeMounts())
+	containerBuilder.SetSecurityContext(0, 0, false)
+	return containerBuilder.Build()
+}
+
+// shellQuote quotes a value of the spec for bash, it is never interpreted by the shell.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
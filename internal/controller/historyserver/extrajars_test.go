@@ -0,0 +1,51 @@
+package historyserver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+func TestNewExtraJarsValidation(t *testing.T) {
+	http := func(url string) shsv1alpha1.ExtraJarSpec {
+		return shsv1alpha1.ExtraJarSpec{HTTP: &shsv1alpha1.ExtraJarHTTPSpec{URL: url}}
+	}
+	oci := shsv1alpha1.ExtraJarSpec{OCI: &shsv1alpha1.ExtraJarOCISpec{Reference: "quay.io/example/jars:1.0.0"}}
+
+	tests := []struct {
+		name    string
+		specs   []shsv1alpha1.ExtraJarSpec
+		wantErr bool
+	}{
+		{name: "no extra jars"},
+		{name: "http and oci", specs: []shsv1alpha1.ExtraJarSpec{http("https://example.com/a.jar"), oci, oci}},
+		{name: "no source", specs: []shsv1alpha1.ExtraJarSpec{{}}, wantErr: true},
+		{
+			name: "two sources",
+			specs: []shsv1alpha1.ExtraJarSpec{{
+				HTTP: &shsv1alpha1.ExtraJarHTTPSpec{URL: "https://example.com/a.jar"},
+				OCI:  oci.OCI,
+			}},
+			wantErr: true,
+		},
+		{name: "not a HTTP URL", specs: []shsv1alpha1.ExtraJarSpec{http("file:///etc/a.jar")}, wantErr: true},
+		{
+			name:    "same file name",
+			specs:   []shsv1alpha1.ExtraJarSpec{http("https://example.com/a.jar"), http("https://mirror.example.com/a.jar")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewExtraJars(context.Background(), nil, tt.specs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewExtraJars() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrExtraJarsValidation) {
+				t.Errorf("NewExtraJars() error = %v, want %v", err, ErrExtraJarsValidation)
+			}
+		})
+	}
+}
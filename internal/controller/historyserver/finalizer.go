@@ -0,0 +1,192 @@
+package historyserver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/zncdatadev/operator-go/pkg/client"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	sparkv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+const (
+	Finalizer = "spark.kubedoop.dev/finalizer"
+
+	// DiscoveryNamespaceLabel and DiscoveryNameLabel select the discovery ConfigMaps of a history server
+	// in other namespaces, e.g. copies for the Spark applications of other teams. The operator does not
+	// create them, and they can not be owned by the history server across namespaces.
+	DiscoveryNamespaceLabel = "spark.kubedoop.dev/discovery-namespace"
+	DiscoveryNameLabel      = "spark.kubedoop.dev/discovery-name"
+
+	// the reasons of the events recorded on the history server
+	CleanupReason       = "Cleanup"
+	CleanupFailedReason = "CleanupFailed"
+
+	cleanupEventAction  = "Delete"
+	cleanupRequeueAfter = 10 * time.Second
+)
+
+// needsCleanup returns whether the history server has external state to clean up on deletion.
+func needsCleanup(spec *sparkv1alpha1.SparkHistoryServerSpec) bool {
+	if spec.DeletionPolicy == sparkv1alpha1.DeletionPolicyDelete {
+		return true
+	}
+	return spec.Cleanup != nil && (spec.Cleanup.WriteTombstone || spec.Cleanup.RemoveDiscoveryConfigMaps)
+}
+
+// getCleanupAction returns the action of the cleanup Job on the event logs, empty when the event
+// logs are retained as they are.
+func getCleanupAction(spec *sparkv1alpha1.SparkHistoryServerSpec) string {
+	if spec.DeletionPolicy == sparkv1alpha1.DeletionPolicyDelete {
+		return CleanupActionPurge
+	}
+	if spec.Cleanup != nil && spec.Cleanup.WriteTombstone {
+		return CleanupActionTombstone
+	}
+	return ""
+}
+
+// ensureFinalizer adds the finalizer when the history server has external state to clean up, and
+// removes it when the cleanup is disabled again.
+func (r *SparkHistoryServerReconciler) ensureFinalizer(ctx context.Context, instance *sparkv1alpha1.SparkHistoryServer) error {
+	var changed bool
+	if needsCleanup(&instance.Spec) {
+		changed = controllerutil.AddFinalizer(instance, Finalizer)
+	} else {
+		changed = controllerutil.RemoveFinalizer(instance, Finalizer)
+	}
+	if !changed {
+		return nil
+	}
+	return r.Update(ctx, instance)
+}
+
+// finalize cleans up the external state of a deleted history server, the event logs and the discovery
+// ConfigMaps, and removes the finalizer once the cleanup is done.
+func (r *SparkHistoryServerReconciler) finalize(ctx context.Context, instance *sparkv1alpha1.SparkHistoryServer) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(instance, Finalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	if action := getCleanupAction(&instance.Spec); action != "" {
+		done, message, err := r.runCleanupJob(ctx, instance, action)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !done {
+			return ctrl.Result{RequeueAfter: cleanupRequeueAfter}, nil
+		}
+		r.Recorder.Eventf(instance, nil, corev1.EventTypeNormal, CleanupReason, cleanupEventAction,
+			"Cleaned up the event logs: %s", message)
+	}
+
+	if instance.Spec.Cleanup != nil && instance.Spec.Cleanup.RemoveDiscoveryConfigMaps {
+		count, err := r.removeDiscoveryConfigMaps(ctx, instance)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		r.Recorder.Eventf(instance, nil, corev1.EventTypeNormal, CleanupReason, cleanupEventAction,
+			"Removed %d discovery ConfigMaps", count)
+	}
+
+	controllerutil.RemoveFinalizer(instance, Finalizer)
+	return ctrl.Result{}, r.Update(ctx, instance)
+}
+
+// runCleanupJob runs the Job of the cleanup action on the event logs and returns whether it is done
+// with a summary of the result. The cleanup is skipped when the event logs can not be cleaned up,
+// e.g. when the S3 bucket was deleted before the history server or the log directory is invalid.
+func (r *SparkHistoryServerReconciler) runCleanupJob(
+	ctx context.Context,
+	instance *sparkv1alpha1.SparkHistoryServer,
+	action string,
+) (bool, string, error) {
+	resourceClient := &client.Client{
+		Client:         r.Client,
+		OwnerReference: instance,
+	}
+
+	logDirectory, err := NewLogDirectory(ctx, resourceClient, instance.Spec.ClusterConfig.LogFileDirectory)
+	if err != nil {
+		if !apierrors.IsNotFound(err) && !errors.Is(err, ErrLogDirectoryValidation) {
+			return false, "", err
+		}
+		r.Recorder.Eventf(instance, nil, corev1.EventTypeWarning, CleanupFailedReason, cleanupEventAction,
+			"Skipped the cleanup of the event logs: %s", err)
+		return true, "skipped the event logs", nil
+	}
+
+	if action == CleanupActionPurge && strings.Trim(logDirectory.GetLogPath(), "/") == "" {
+		r.Recorder.Eventf(instance, nil, corev1.EventTypeWarning, CleanupFailedReason, cleanupEventAction,
+			"Refused to purge the root of %s, the event log prefix is empty", logDirectory.GetLogDirectory())
+		return true, "retained the event logs in the root of the bucket", nil
+	}
+
+	clusterInfo := getClusterInfo(instance)
+	job := &batchv1.Job{}
+	key := ctrlclient.ObjectKey{Namespace: instance.Namespace, Name: getCleanupJobName(clusterInfo, action)}
+	if err := r.Get(ctx, key, job); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return false, "", err
+		}
+		image := NewClusterReconciler(resourceClient, clusterInfo, &instance.Spec).GetImage()
+		obj, err := NewCleanupJobBuilder(resourceClient, clusterInfo, image, logDirectory, action).Build(ctx)
+		if err != nil {
+			return false, "", err
+		}
+		// the Job is owned by the history server, it is garbage collected with it
+		if err := ctrl.SetControllerReference(instance, obj, r.Scheme); err != nil {
+			return false, "", err
+		}
+		logger.Info("Creating the cleanup job", "namespace", key.Namespace, "name", key.Name, "action", action)
+		return false, "", r.Create(ctx, obj)
+	}
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			if action == CleanupActionTombstone {
+				return true, "wrote the tombstone to " + logDirectory.GetLogDirectory(), nil
+			}
+			return true, "purged the event logs in " + logDirectory.GetLogDirectory(), nil
+		case batchv1.JobFailed:
+			// keep the finalizer, the event logs must not be left behind silently
+			r.Recorder.Eventf(instance, nil, corev1.EventTypeWarning, CleanupFailedReason, cleanupEventAction,
+				"The cleanup job %s failed: %s. Delete the job to retry or set the deletion policy to Retain",
+				key.Name, condition.Message)
+			return false, "", nil
+		}
+	}
+	return false, "", nil
+}
+
+// removeDiscoveryConfigMaps removes the discovery ConfigMaps of the history server in all namespaces
+// and returns the number of ConfigMaps removed. The ConfigMaps are listed from the API server, the
+// cache only holds the watched namespaces.
+func (r *SparkHistoryServerReconciler) removeDiscoveryConfigMaps(ctx context.Context, instance *sparkv1alpha1.SparkHistoryServer) (int, error) {
+	list := &corev1.ConfigMapList{}
+	if err := r.APIReader.List(ctx, list, ctrlclient.MatchingLabels{
+		DiscoveryNamespaceLabel: instance.Namespace,
+		DiscoveryNameLabel:      instance.Name,
+	}); err != nil {
+		return 0, err
+	}
+
+	for i := range list.Items {
+		if err := r.Delete(ctx, &list.Items[i]); ctrlclient.IgnoreNotFound(err) != nil {
+			return 0, err
+		}
+	}
+	return len(list.Items), nil
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2023 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package historyserver
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	authv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/authentication/v1alpha1"
+	s3v1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/s3/v1alpha1"
+	"github.com/zncdatadev/operator-go/pkg/client"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+// Run `go test ./internal/controller/historyserver/ -run TestGolden -update` to regenerate the golden files.
+var update = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+const (
+	goldenDir       = "testdata/golden"
+	goldenInputFile = "input.yaml"
+)
+
+var yamlDocumentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+func newGoldenScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{
+		clientgoscheme.AddToScheme,
+		shsv1alpha1.AddToScheme,
+		s3v1alpha1.AddToScheme,
+		authv1alpha1.AddToScheme,
+	} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return scheme
+}
+
+// loadGoldenInput decodes the history server and the objects it depends on, e.g. the S3 bucket
+// or the AuthenticationClass, from the input file of a fixture.
+func loadGoldenInput(t *testing.T, scheme *runtime.Scheme, path string) (*shsv1alpha1.SparkHistoryServer, []ctrlclient.Object) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+	var instance *shsv1alpha1.SparkHistoryServer
+	objects := []ctrlclient.Object{}
+	for _, doc := range yamlDocumentSeparator.Split(string(data), -1) {
+		if len(bytes.TrimSpace([]byte(doc))) == 0 {
+			continue
+		}
+		obj, _, err := decoder.Decode([]byte(doc), nil, nil)
+		if err != nil {
+			t.Fatalf("failed to decode %s: %v", path, err)
+		}
+		if shs, ok := obj.(*shsv1alpha1.SparkHistoryServer); ok {
+			instance = shs
+			continue
+		}
+		objects = append(objects, obj.(ctrlclient.Object))
+	}
+	if instance == nil {
+		t.Fatalf("%s does not contain a SparkHistoryServer", path)
+	}
+
+	// The fake client treats the CRDs as namespaced, the cluster scoped objects, e.g. the
+	// AuthenticationClass, are looked up in the namespace of the history server.
+	for _, obj := range objects {
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(instance.Namespace)
+		}
+	}
+	return instance, objects
+}
+
+// renderFixture renders the resources of the history server of a fixture, the same way the controller
+// does. The history server can be changed by mutate before it is rendered.
+func renderFixture(t *testing.T, path string, mutate func(*shsv1alpha1.SparkHistoryServer)) []ctrlclient.Object {
+	t.Helper()
+	scheme := newGoldenScheme(t)
+	instance, objects := loadGoldenInput(t, scheme, path)
+	if mutate != nil {
+		mutate(instance)
+	}
+
+	c := &client.Client{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(objects...).
+			Build(),
+		OwnerReference: instance,
+	}
+	rendered, err := RenderResources(context.Background(), c, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rendered
+}
+
+// renderGolden builds the ConfigMap and StatefulSet of the role group of the fixture and returns the
+// golden files by name.
+func renderGolden(t *testing.T, path string) map[string][]byte {
+	t.Helper()
+	files := map[string][]byte{}
+	for _, obj := range renderFixture(t, path, nil) {
+		switch o := obj.(type) {
+		case *corev1.ConfigMap:
+			if _, ok := o.Data[SparkConfigDefauleFileName]; !ok {
+				continue
+			}
+			files[SparkConfigDefauleFileName] = []byte(o.Data[SparkConfigDefauleFileName])
+			files["log4j2.properties"] = []byte(o.Data["log4j2.properties"])
+			if config, ok := o.Data[LdapProxyConfigFileName]; ok {
+				files[LdapProxyConfigFileName] = []byte(config)
+			}
+		case *appsv1.StatefulSet:
+			data, err := yaml.Marshal(o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files["statefulset.yaml"] = data
+		}
+	}
+	for _, name := range []string{SparkConfigDefauleFileName, "log4j2.properties", "statefulset.yaml"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("expected the ConfigMap and StatefulSet of one role group, %s is missing", name)
+		}
+	}
+	return files
+}
+
+func TestGolden(t *testing.T) {
+	entries, err := os.ReadDir(goldenDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(goldenDir, entry.Name())
+		t.Run(entry.Name(), func(t *testing.T) {
+			for name, got := range renderGolden(t, filepath.Join(dir, goldenInputFile)) {
+				path := filepath.Join(dir, name)
+				if *update {
+					if err := os.WriteFile(path, got, 0o644); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				want, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("%v, run the test with -update to create the golden file", err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("%s does not match the golden file, run the test with -update if the change is expected\n--- got\n%s", path, got)
+				}
+			}
+		})
+	}
+}
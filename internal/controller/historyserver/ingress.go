@@ -0,0 +1,343 @@
+package historyserver
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	"github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	oputil "github.com/zncdatadev/operator-go/pkg/util"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/ptr"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+	"github.com/zncdatadev/spark-k8s-operator/internal/util"
+)
+
+const (
+	DefaultIngressPath = "/"
+)
+
+var (
+	HTTPRouteGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: shsv1alpha1.IngressKindHTTPRoute}
+)
+
+func getIngressPath(spec *shsv1alpha1.IngressSpec) string {
+	if spec.Path != "" {
+		return spec.Path
+	}
+	return DefaultIngressPath
+}
+
+// getIngressProxyBase returns the sub path of the UI without the trailing slash, it is empty when the
+// UI is exposed at the root. The sub path is stripped by the Ingress or HTTPRoute and set as
+// spark.ui.proxyBase, the UI prefixes its links with it.
+func getIngressProxyBase(spec *shsv1alpha1.IngressSpec) string {
+	return strings.TrimRight(getIngressPath(spec), "/")
+}
+
+func getIngressScheme(spec *shsv1alpha1.IngressSpec) string {
+	if spec.Scheme != "" {
+		return spec.Scheme
+	}
+	if spec.TLSSecretName != "" {
+		return "https"
+	}
+	return "http"
+}
+
+// getIngressURLs returns the public URLs of the role group UI.
+func getIngressURLs(spec *shsv1alpha1.IngressSpec) []string {
+	urls := make([]string, 0, len(spec.Hosts))
+	for _, host := range spec.Hosts {
+		urls = append(urls, getIngressScheme(spec)+"://"+host+getIngressPath(spec))
+	}
+	return urls
+}
+
+// GetIngressURLs returns the sorted public URLs of all role groups of the history server.
+func GetIngressURLs(spec *shsv1alpha1.SparkHistoryServerSpec) ([]string, error) {
+	urls := []string{}
+	if spec.Node == nil {
+		return urls, nil
+	}
+	for _, roleGroup := range spec.Node.RoleGroups {
+		config, err := oputil.MergeObject(spec.Node.Config, roleGroup.Config)
+		if err != nil {
+			return nil, err
+		}
+		if config != nil && config.Ingress != nil {
+			urls = append(urls, getIngressURLs(config.Ingress)...)
+		}
+	}
+	slices.Sort(urls)
+	return slices.Compact(urls), nil
+}
+
+// getIngressBackendPort returns the port of the role group service the ingress routes to,
+// it is the port of the authentication proxy when authentication is configured.
+func getIngressBackendPort(authentication *Authentication) int32 {
+	switch {
+	case authentication == nil:
+		return util.HttpPort
+	case authentication.IsLdap():
+		return util.LdapPort
+	default:
+		return util.OidcPort
+	}
+}
+
+var _ builder.ObjectBuilder = &IngressBuilder{}
+
+// IngressBuilder builds the Ingress or HTTPRoute of a role group.
+type IngressBuilder struct {
+	builder.ObjectMeta
+
+	Spec            *shsv1alpha1.IngressSpec
+	SessionAffinity *shsv1alpha1.SessionAffinitySpec
+	ServiceName     string
+	ServicePort     int32
+	// Oidc is set when the backend is the OIDC proxy, its callback can not be served under a sub path.
+	Oidc bool
+}
+
+func NewIngressBuilder(
+	client *client.Client,
+	name string,
+	spec *shsv1alpha1.IngressSpec,
+	sessionAffinity *shsv1alpha1.SessionAffinitySpec,
+	serviceName string,
+	servicePort int32,
+	options ...builder.Option,
+) *IngressBuilder {
+	return &IngressBuilder{
+		ObjectMeta:      *builder.NewObjectMeta(client, name, options...),
+		Spec:            spec,
+		SessionAffinity: sessionAffinity,
+		ServiceName:     serviceName,
+		ServicePort:     servicePort,
+	}
+}
+
+func (b *IngressBuilder) IsHTTPRoute() bool {
+	return b.Spec.Kind == shsv1alpha1.IngressKindHTTPRoute
+}
+
+// getAnnotations returns the annotations of the Ingress. The cookie affinity and the rewrite of a sub
+// path are configured with the annotations of ingress-nginx, the annotations of the spec take
+// precedence for other controllers.
+func (b *IngressBuilder) getAnnotations() map[string]string {
+	annotations := b.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if !b.IsHTTPRoute() && isCookieSessionAffinity(b.SessionAffinity) {
+		annotations["nginx.ingress.kubernetes.io/affinity"] = "cookie"
+		annotations["nginx.ingress.kubernetes.io/session-cookie-name"] = getSessionAffinityCookieName(b.SessionAffinity)
+		annotations["nginx.ingress.kubernetes.io/session-cookie-max-age"] = strconv.Itoa(int(getSessionAffinityTimeoutSeconds(b.SessionAffinity)))
+	}
+	if !b.IsHTTPRoute() && getIngressProxyBase(b.Spec) != "" {
+		annotations["nginx.ingress.kubernetes.io/use-regex"] = trueValue
+		annotations["nginx.ingress.kubernetes.io/rewrite-target"] = "/$2"
+	}
+	maps.Copy(annotations, b.Spec.Annotations)
+	return annotations
+}
+
+func (b *IngressBuilder) buildIngress() *networkingv1.Ingress {
+	pathType := networkingv1.PathTypePrefix
+	path := getIngressPath(b.Spec)
+	if proxyBase := getIngressProxyBase(b.Spec); proxyBase != "" {
+		// the second group is the path of the UI, see the rewrite-target annotation
+		pathType = networkingv1.PathTypeImplementationSpecific
+		path = proxyBase + "(/|$)(.*)"
+	}
+	rules := make([]networkingv1.IngressRule, 0, len(b.Spec.Hosts))
+	for _, host := range b.Spec.Hosts {
+		rules = append(rules, networkingv1.IngressRule{
+			Host: host,
+			IngressRuleValue: networkingv1.IngressRuleValue{
+				HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{
+						{
+							Path:     path,
+							PathType: &pathType,
+							Backend: networkingv1.IngressBackend{
+								Service: &networkingv1.IngressServiceBackend{
+									Name: b.ServiceName,
+									Port: networkingv1.ServiceBackendPort{Number: b.ServicePort},
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+	}
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: b.GetObjectMeta(),
+		Spec: networkingv1.IngressSpec{
+			Rules: rules,
+		},
+	}
+	ingress.Annotations = b.getAnnotations()
+
+	if b.Spec.IngressClassName != "" {
+		ingress.Spec.IngressClassName = ptr.To(b.Spec.IngressClassName)
+	}
+	if b.Spec.TLSSecretName != "" {
+		ingress.Spec.TLS = []networkingv1.IngressTLS{
+			{
+				Hosts:      b.Spec.Hosts,
+				SecretName: b.Spec.TLSSecretName,
+			},
+		}
+	}
+
+	return ingress
+}
+
+func (b *IngressBuilder) buildHTTPRoute() *unstructured.Unstructured {
+	parentRefs := make([]any, 0, len(b.Spec.ParentRefs))
+	for _, ref := range b.Spec.ParentRefs {
+		parentRef := map[string]any{"name": ref.Name}
+		if ref.Namespace != "" {
+			parentRef["namespace"] = ref.Namespace
+		}
+		if ref.SectionName != "" {
+			parentRef["sectionName"] = ref.SectionName
+		}
+		parentRefs = append(parentRefs, parentRef)
+	}
+
+	hostnames := make([]any, 0, len(b.Spec.Hosts))
+	for _, host := range b.Spec.Hosts {
+		hostnames = append(hostnames, host)
+	}
+
+	rule := map[string]any{
+		"matches": []any{
+			map[string]any{
+				"path": map[string]any{
+					"type":  "PathPrefix",
+					"value": getIngressPath(b.Spec),
+				},
+			},
+		},
+		"backendRefs": []any{
+			map[string]any{
+				"name": b.ServiceName,
+				"port": int64(b.ServicePort),
+			},
+		},
+	}
+	if proxyBase := getIngressProxyBase(b.Spec); proxyBase != "" {
+		rule["matches"] = []any{
+			map[string]any{
+				"path": map[string]any{
+					"type":  "PathPrefix",
+					"value": proxyBase,
+				},
+			},
+		}
+		rule["filters"] = []any{
+			map[string]any{
+				"type": "URLRewrite",
+				"urlRewrite": map[string]any{
+					"path": map[string]any{
+						"type":               "ReplacePrefixMatch",
+						"replacePrefixMatch": "/",
+					},
+				},
+			},
+		}
+	}
+	if isCookieSessionAffinity(b.SessionAffinity) {
+		rule["sessionPersistence"] = map[string]any{
+			"type":            "Cookie",
+			"sessionName":     getSessionAffinityCookieName(b.SessionAffinity),
+			"absoluteTimeout": strconv.Itoa(int(getSessionAffinityTimeoutSeconds(b.SessionAffinity))) + "s",
+		}
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(HTTPRouteGVK)
+	obj.SetName(b.GetName())
+	obj.SetNamespace(b.Client.GetOwnerNamespace())
+	obj.SetLabels(b.GetLabels())
+	obj.SetAnnotations(b.getAnnotations())
+	obj.Object["spec"] = map[string]any{
+		"parentRefs": parentRefs,
+		"hostnames":  hostnames,
+		"rules":      []any{rule},
+	}
+	return obj
+}
+
+func (b *IngressBuilder) Build(_ context.Context) (ctrlclient.Object, error) {
+	if b.Oidc && getIngressProxyBase(b.Spec) != "" {
+		return nil, fmt.Errorf("ingress path %s is not supported with OIDC authentication, role group: %s", b.Spec.Path, b.GetName())
+	}
+	if b.IsHTTPRoute() {
+		if len(b.Spec.ParentRefs) == 0 {
+			return nil, fmt.Errorf("ingress of kind HTTPRoute requires parentRefs, role group: %s", b.GetName())
+		}
+		return b.buildHTTPRoute(), nil
+	}
+	return b.buildIngress(), nil
+}
+
+// NewRoleGroupIngressReconciler creates the Ingress or HTTPRoute reconciler of a role group,
+// the HTTPRoute is only reconciled when the Gateway API is installed in the cluster.
+func NewRoleGroupIngressReconciler(
+	client *client.Client,
+	roleGroupInfo *reconciler.RoleGroupInfo,
+	spec *shsv1alpha1.IngressSpec,
+	sessionAffinity *shsv1alpha1.SessionAffinitySpec,
+	authentication *Authentication,
+	options ...builder.Option,
+) reconciler.Reconciler {
+	b := NewIngressBuilder(
+		client,
+		roleGroupInfo.GetFullName(),
+		spec,
+		sessionAffinity,
+		roleGroupInfo.GetFullName(),
+		getIngressBackendPort(authentication),
+		options...,
+	)
+	b.Oidc = authentication != nil && !authentication.IsLdap()
+	if b.IsHTTPRoute() {
+		return NewOptionalResourceReconciler(client, HTTPRouteGVK, b)
+	}
+	return reconciler.NewGenericResourceReconciler(client, b)
+}
+
+// NewRoleGroupObsoleteIngressReconcilers creates the reconcilers deleting the Ingress or HTTPRoute of a role
+// group which is no longer configured, both when the ingress is removed, or the other kind when the kind changes.
+func NewRoleGroupObsoleteIngressReconcilers(
+	client *client.Client,
+	roleGroupInfo *reconciler.RoleGroupInfo,
+	spec *shsv1alpha1.IngressSpec,
+) []reconciler.Reconciler {
+	name := roleGroupInfo.GetFullName()
+	reconcilers := []reconciler.Reconciler{}
+	if spec == nil || spec.Kind == shsv1alpha1.IngressKindHTTPRoute {
+		ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		reconcilers = append(reconcilers, NewObsoleteResourceReconciler(client, ingress))
+	}
+	if spec == nil || spec.Kind != shsv1alpha1.IngressKindHTTPRoute {
+		reconcilers = append(reconcilers, newObsoleteUnstructuredReconciler(client, HTTPRouteGVK, name))
+	}
+	return reconcilers
+}
@@ -0,0 +1,110 @@
+package historyserver
+
+import (
+	"context"
+	"testing"
+
+	authv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/authentication/v1alpha1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+func TestIngressSubPath(t *testing.T) {
+	c := newOptionalTestClient(t)
+	spec := &shsv1alpha1.IngressSpec{Hosts: []string{"spark.example.com"}, Path: "/spark-history/"}
+
+	obj, err := NewIngressBuilder(c, "shs-node-default", spec, nil, "shs-node-default", 18080).Build(context.Background())
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	ingress := obj.(*networkingv1.Ingress)
+	path := ingress.Spec.Rules[0].HTTP.Paths[0]
+	if path.Path != "/spark-history(/|$)(.*)" || *path.PathType != networkingv1.PathTypeImplementationSpecific {
+		t.Errorf("path = %s %s, want the regex of the sub path", path.Path, *path.PathType)
+	}
+	if ingress.Annotations["nginx.ingress.kubernetes.io/rewrite-target"] != "/$2" {
+		t.Errorf("annotations = %v, want the rewrite of the sub path", ingress.Annotations)
+	}
+
+	spec.Kind = shsv1alpha1.IngressKindHTTPRoute
+	spec.ParentRefs = []shsv1alpha1.GatewayParentRef{{Name: "gateway"}}
+	obj, err = NewIngressBuilder(c, "shs-node-default", spec, nil, "shs-node-default", 18080).Build(context.Background())
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	rules, _, _ := unstructured.NestedSlice(obj.(*unstructured.Unstructured).Object, "spec", "rules")
+	filters, _, _ := unstructured.NestedSlice(rules[0].(map[string]any), "filters")
+	if len(filters) != 1 || filters[0].(map[string]any)["type"] != "URLRewrite" {
+		t.Errorf("filters = %v, want the rewrite of the sub path", filters)
+	}
+}
+
+func TestIngressSubPathWithOidc(t *testing.T) {
+	c := newOptionalTestClient(t)
+	spec := &shsv1alpha1.IngressSpec{Hosts: []string{"spark.example.com"}, Path: "/spark-history"}
+	authentication := &Authentication{Class: &authv1alpha1.AuthenticationClass{
+		Spec: authv1alpha1.AuthenticationClassSpec{AuthenticationProvider: &authv1alpha1.AuthenticationProvider{OIDC: &authv1alpha1.OIDCProvider{}}},
+	}}
+
+	r := NewRoleGroupIngressReconciler(c, newOptionalTestRoleGroupInfo(c), spec, nil, authentication)
+	if _, err := r.Reconcile(context.Background()); err == nil {
+		t.Error("Reconcile() error = nil, want the sub path rejected with OIDC")
+	}
+}
+
+func TestObsoleteIngressReconcilers(t *testing.T) {
+	ctx := context.Background()
+	c := newOptionalTestClient(t, HTTPRouteGVK, networkingv1.SchemeGroupVersion.WithKind("Ingress"))
+	info := newOptionalTestRoleGroupInfo(c)
+	key := ctrlclient.ObjectKey{Namespace: "default", Name: info.GetFullName()}
+
+	reconcile := func(spec *shsv1alpha1.IngressSpec) {
+		t.Helper()
+		reconcilers := NewRoleGroupObsoleteIngressReconcilers(c, info, spec)
+		if spec != nil {
+			reconcilers = append(reconcilers, NewRoleGroupIngressReconciler(c, info, spec, nil, nil))
+		}
+		for _, r := range reconcilers {
+			if _, err := r.Reconcile(ctx); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+		}
+	}
+	exists := func(obj ctrlclient.Object) bool {
+		t.Helper()
+		err := c.Client.Get(ctx, key, obj)
+		if err != nil && !apierrors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		return err == nil
+	}
+	route := func() ctrlclient.Object {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(HTTPRouteGVK)
+		return obj
+	}
+
+	reconcile(&shsv1alpha1.IngressSpec{Hosts: []string{"spark.example.com"}})
+	if !exists(&networkingv1.Ingress{}) {
+		t.Fatal("the Ingress does not exist")
+	}
+
+	reconcile(&shsv1alpha1.IngressSpec{
+		Kind:       shsv1alpha1.IngressKindHTTPRoute,
+		Hosts:      []string{"spark.example.com"},
+		ParentRefs: []shsv1alpha1.GatewayParentRef{{Name: "gateway"}},
+	})
+	if exists(&networkingv1.Ingress{}) || !exists(route()) {
+		t.Errorf("Ingress exists = %v, HTTPRoute exists = %v, want the Ingress replaced by the HTTPRoute",
+			exists(&networkingv1.Ingress{}), exists(route()))
+	}
+
+	reconcile(nil)
+	if exists(&networkingv1.Ingress{}) || exists(route()) {
+		t.Error("the UI is still routed, want the Ingress and HTTPRoute deleted when the ingress is removed")
+	}
+}
@@ -0,0 +1,133 @@
+package historyserver
+
+import (
+	"encoding/json"
+	"path"
+
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	"sigs.k8s.io/yaml"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+const (
+	JmxExporterConfigFileName  = "jmx-exporter.yaml"
+	SparkMetricsConfigFileName = "metrics.properties"
+
+	// SparkPrometheusServletPath is the path of the spark PrometheusServlet sink on the UI port.
+	SparkPrometheusServletPath = "/metrics/prometheus"
+)
+
+var (
+	JmxExporterConfigPath  = path.Join(constants.KubedoopConfigDir, JmxExporterConfigFileName)
+	SparkMetricsConfigPath = path.Join(constants.KubedoopConfigDir, SparkMetricsConfigFileName)
+)
+
+// defaultJmxExporterRules export the history server metrics registered by the spark JmxSink and
+// the S3A metrics of hadoop. The names are used by the alerts of the PrometheusRule.
+var defaultJmxExporterRules = []shsv1alpha1.JmxExporterRule{
+	{
+		Pattern: `metrics<name=history\.cache\.lookup\.failure\.count, type=counters><>Count`,
+		Name:    "spark_history_cache_lookup_failure_total",
+		Type:    "COUNTER",
+		Help:    "Failed lookups of application UIs, e.g. failed event log replays.",
+	},
+	{
+		Pattern: `metrics<name=history\.cache\.(.+)\.count, type=counters><>Count`,
+		Name:    "spark_history_cache_$1_total",
+		Type:    "COUNTER",
+	},
+	{
+		Pattern: `metrics<name=history\.cache\.(.+)\.timer, type=timers><>(Count|Mean|Max|99thPercentile)`,
+		Name:    "spark_history_cache_$1_timer_$2",
+		Type:    "GAUGE",
+	},
+	{
+		Pattern: `metrics<name=history\.(.+), type=gauges><>Value`,
+		Name:    "spark_history_$1",
+		Type:    "GAUGE",
+	},
+	{
+		Pattern: `Hadoop<service=s3a-file-system, name=S3AMetrics\d+-(.+)><>(object_list_request|store_io_retry|store_io_throttled|ignored_errors)`,
+		Name:    "spark_history_s3a_$2_total",
+		Type:    "COUNTER",
+		Labels:  map[string]string{"bucket": "$1"},
+	},
+	{
+		Pattern: ".*",
+	},
+}
+
+// jmxExporterRule renders the value factor as number, the CRD keeps it as string.
+type jmxExporterRule struct {
+	shsv1alpha1.JmxExporterRule `json:",inline"`
+
+	ValueFactor json.Number `json:"valueFactor,omitempty"`
+}
+
+type jmxExporterConfig struct {
+	LowercaseOutputName       bool              `json:"lowercaseOutputName"`
+	LowercaseOutputLabelNames bool              `json:"lowercaseOutputLabelNames"`
+	Rules                     []jmxExporterRule `json:"rules"`
+}
+
+// getJmxExporterRules returns the rules of the user followed by the default rules,
+// a default rule is replaced by a user rule with the same pattern.
+func getJmxExporterRules(spec *shsv1alpha1.JmxExporterSpec) []shsv1alpha1.JmxExporterRule {
+	if spec == nil || len(spec.Rules) == 0 {
+		return defaultJmxExporterRules
+	}
+
+	patterns := map[string]bool{}
+	rules := make([]shsv1alpha1.JmxExporterRule, 0, len(spec.Rules)+len(defaultJmxExporterRules))
+	for _, rule := range spec.Rules {
+		patterns[rule.Pattern] = true
+		rules = append(rules, rule)
+	}
+	for _, rule := range defaultJmxExporterRules {
+		if !patterns[rule.Pattern] {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func getJmxExporterConfig(monitoring *shsv1alpha1.MonitoringSpec) (string, error) {
+	var spec *shsv1alpha1.JmxExporterSpec
+	if monitoring != nil {
+		spec = monitoring.JmxExporter
+	}
+
+	config := jmxExporterConfig{
+		LowercaseOutputName:       true,
+		LowercaseOutputLabelNames: true,
+	}
+	for _, rule := range getJmxExporterRules(spec) {
+		config.Rules = append(config.Rules, jmxExporterRule{
+			JmxExporterRule: rule,
+			ValueFactor:     json.Number(rule.ValueFactor),
+		})
+	}
+
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// getSparkMetricsConfig enables the JmxSink, so the metrics of the history server are exported
+// by the JMX exporter, and the PrometheusServlet sink on the UI port.
+func getSparkMetricsConfig() string {
+	return `*.sink.jmx.class=org.apache.spark.metrics.sink.JmxSink
+*.sink.prometheusServlet.class=org.apache.spark.metrics.sink.PrometheusServlet
+*.sink.prometheusServlet.path=` + SparkPrometheusServletPath + `
+*.source.jvm.class=org.apache.spark.metrics.source.JvmSource
+`
+}
+
+func getSparkMetricsProperties() map[string]string {
+	return map[string]string{
+		"spark.metrics.conf": SparkMetricsConfigPath,
+	}
+}
@@ -0,0 +1,67 @@
+package historyserver
+
+import (
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+func TestGetJmxExporterRules(t *testing.T) {
+	if rules := getJmxExporterRules(nil); len(rules) != len(defaultJmxExporterRules) {
+		t.Errorf("rules = %v, want the default rules", rules)
+	}
+
+	replaced := defaultJmxExporterRules[0].Pattern
+	spec := &shsv1alpha1.JmxExporterSpec{
+		Rules: []shsv1alpha1.JmxExporterRule{
+			{Pattern: `metrics<name=custom\.(.+)><>Value`, Name: "custom_$1"},
+			{Pattern: replaced, Name: "replay_failures_total", Type: "COUNTER"},
+		},
+	}
+	rules := getJmxExporterRules(spec)
+
+	if len(rules) != len(defaultJmxExporterRules)+1 {
+		t.Fatalf("rules = %v, want the user rules and the not replaced default rules", rules)
+	}
+	if rules[0].Name != "custom_$1" || rules[1].Name != "replay_failures_total" {
+		t.Errorf("rules = %v, want the user rules first", rules[:2])
+	}
+	for _, rule := range rules[2:] {
+		if rule.Pattern == replaced {
+			t.Errorf("the default rule of %s is kept, want it replaced by the user rule", replaced)
+		}
+	}
+	if last := rules[len(rules)-1]; last.Pattern != ".*" {
+		t.Errorf("last rule = %v, want the catch-all default rule after the user rules", last)
+	}
+}
+
+func TestGetJmxExporterConfig(t *testing.T) {
+	monitoring := &shsv1alpha1.MonitoringSpec{
+		JmxExporter: &shsv1alpha1.JmxExporterSpec{
+			Rules: []shsv1alpha1.JmxExporterRule{{Pattern: `metrics<name=custom><>Value`, Name: "custom", ValueFactor: "0.001"}},
+		},
+	}
+	data, err := getJmxExporterConfig(monitoring)
+	if err != nil {
+		t.Fatalf("getJmxExporterConfig() error = %v", err)
+	}
+
+	config := map[string]any{}
+	if err := yaml.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatal(err)
+	}
+	if config["lowercaseOutputName"] != true || config["lowercaseOutputLabelNames"] != true {
+		t.Errorf("config = %v, want lowercase names", config)
+	}
+	rules := config["rules"].([]any)
+	if factor := rules[0].(map[string]any)["valueFactor"]; factor != 0.001 {
+		t.Errorf("valueFactor = %v (%T), want the number 0.001", factor, factor)
+	}
+	if !strings.Contains(data, "spark_history_cache_lookup_failure_total") {
+		t.Errorf("config = %s, want the default rules after the user rules", data)
+	}
+}
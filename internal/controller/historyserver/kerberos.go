@@ -0,0 +1,110 @@
+package historyserver
+
+import (
+	"path"
+
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	oputil "github.com/zncdatadev/operator-go/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+const (
+	KerberosVolumeName = "kerberos"
+
+	// KerberosRealmPlaceholder is replaced with the default realm of krb5.conf when the container starts.
+	KerberosRealmPlaceholder = "${env.KERBEROS_REALM}"
+
+	SpnegoFilterClass = "org.apache.hadoop.security.authentication.server.AuthenticationFilter"
+)
+
+var (
+	KerberosKeytabPath = path.Join(constants.KubedoopKerberosDir, "keytab")
+	Krb5ConfPath       = path.Join(constants.KubedoopKerberosDir, "krb5.conf")
+)
+
+// Kerberos configures the history server with the keytab provided by the secret-operator.
+// The keytab contains the `spark` principal used to access secure HDFS and the `HTTP`
+// principal used by SPNEGO, both bound to the role group service.
+type Kerberos struct {
+	Spec *shsv1alpha1.KerberosSpec
+
+	// ServiceName is the role group service the principals are bound to.
+	ServiceName string
+	Namespace   string
+}
+
+func NewKerberos(spec *shsv1alpha1.KerberosSpec, serviceName, namespace string) *Kerberos {
+	return &Kerberos{
+		Spec:        spec,
+		ServiceName: serviceName,
+		Namespace:   namespace,
+	}
+}
+
+func (k *Kerberos) getPrincipal(service string) string {
+	return service + "/" + k.ServiceName + "." + k.Namespace + ".svc.cluster.local@" + KerberosRealmPlaceholder
+}
+
+func (k *Kerberos) GetProperties() map[string]string {
+	return map[string]string{
+		"spark.history.kerberos.enabled":              trueValue,
+		"spark.history.kerberos.principal":            k.getPrincipal("spark"),
+		"spark.history.kerberos.keytab":               KerberosKeytabPath,
+		"spark.hadoop.hadoop.security.authentication": "kerberos",
+	}
+}
+
+// GetSpnegoFilter returns the hadoop authentication filter which authenticates the UI users with SPNEGO.
+func (k *Kerberos) GetSpnegoFilter() UIFilter {
+	return UIFilter{
+		Class: SpnegoFilterClass,
+		Params: map[string]string{
+			"type":               "kerberos",
+			"kerberos.principal": k.getPrincipal("HTTP"),
+			"kerberos.keytab":    KerberosKeytabPath,
+		},
+	}
+}
+
+func (k *Kerberos) GetJvmOpts() []string {
+	return []string{
+		"-Djava.security.krb5.conf=" + Krb5ConfPath,
+	}
+}
+
+func (k *Kerberos) GetVolume() *corev1.Volume {
+	volume := builder.NewSecretOperatorVolume(KerberosVolumeName, k.Spec.SecretClass)
+	volume.SetScope(&builder.SecretVolumeScope{
+		Service: []string{k.ServiceName},
+	})
+	volume.SetFormatName(constants.Kerberos)
+	volume.SetKerberosServiceNames("HTTP", "spark")
+	return volume.Builde()
+}
+
+func (k *Kerberos) GetVolumeMount() *corev1.VolumeMount {
+	return &corev1.VolumeMount{
+		Name:      KerberosVolumeName,
+		MountPath: constants.KubedoopKerberosDir,
+	}
+}
+
+// GetPartialCmdArgs returns the commands which substitute the realm placeholder
+// in the spark config with the default realm of krb5.conf.
+func (k *Kerberos) GetPartialCmdArgs() string {
+	args := `
+export KERBEROS_REALM=$(grep -oP 'default_realm = \K.*' ` + Krb5ConfPath + `)
+sed -i -e 's/\${env.KERBEROS_REALM}/'"$KERBEROS_REALM/g" ` + path.Join(constants.KubedoopConfigDir, SparkConfigDefauleFileName) + `
+`
+	return oputil.IndentTab4Spaces(args)
+}
+
+func getKerberos(clusterConfig *shsv1alpha1.ClusterConfigSpec, serviceName, namespace string) *Kerberos {
+	if clusterConfig.Kerberos == nil {
+		return nil
+	}
+	return NewKerberos(clusterConfig.Kerberos, serviceName, namespace)
+}
@@ -0,0 +1,88 @@
+package historyserver
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zncdatadev/operator-go/pkg/constants"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+func TestKerberosPrincipals(t *testing.T) {
+	k := NewKerberos(&shsv1alpha1.KerberosSpec{SecretClass: "kerberos"}, "shs-node-default", "spark")
+
+	want := "spark/shs-node-default.spark.svc.cluster.local@" + KerberosRealmPlaceholder
+	if got := k.GetProperties()["spark.history.kerberos.principal"]; got != want {
+		t.Errorf("principal = %s, want %s", got, want)
+	}
+	want = "HTTP/shs-node-default.spark.svc.cluster.local@" + KerberosRealmPlaceholder
+	if got := k.GetSpnegoFilter().Params["kerberos.principal"]; got != want {
+		t.Errorf("SPNEGO principal = %s, want %s", got, want)
+	}
+}
+
+// TestKerberosRealmSubstitution runs the start commands against a copy of the config and krb5.conf.
+func TestKerberosRealmSubstitution(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+	dir := t.TempDir()
+	krb5Conf := filepath.Join(dir, "krb5.conf")
+	sparkDefaults := filepath.Join(dir, SparkConfigDefauleFileName)
+	if err := os.WriteFile(krb5Conf, []byte("[libdefaults]\n    default_realm = EXAMPLE.COM\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	k := NewKerberos(&shsv1alpha1.KerberosSpec{SecretClass: "kerberos"}, "shs-node-default", "spark")
+	if err := os.WriteFile(sparkDefaults, []byte("principal "+k.getPrincipal("spark")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	args := strings.NewReplacer(
+		Krb5ConfPath, krb5Conf,
+		path.Join(constants.KubedoopConfigDir, SparkConfigDefauleFileName), sparkDefaults,
+	).Replace(k.GetPartialCmdArgs())
+	if out, err := exec.Command("bash", "-c", args).CombinedOutput(); err != nil {
+		t.Skipf("the start commands can not run here: %v: %s", err, out)
+	}
+
+	got, err := os.ReadFile(sparkDefaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "principal spark/shs-node-default.spark.svc.cluster.local@EXAMPLE.COM\n"; string(got) != want {
+		t.Errorf("%s = %q, want %q", SparkConfigDefauleFileName, got, want)
+	}
+}
+
+func TestKerberosVolume(t *testing.T) {
+	k := NewKerberos(&shsv1alpha1.KerberosSpec{SecretClass: "kerberos"}, "shs-node-default", "spark")
+
+	volume := k.GetVolume()
+	if volume.Name != KerberosVolumeName {
+		t.Errorf("volume name = %s, want %s", volume.Name, KerberosVolumeName)
+	}
+	annotations := volume.Ephemeral.VolumeClaimTemplate.Annotations
+	want := map[string]string{
+		constants.AnnotationSecretsClass:                "kerberos",
+		constants.AnnotationSecretsScope:                string(constants.ServiceScope) + "=shs-node-default",
+		constants.AnnotationSecretsFormat:               string(constants.Kerberos),
+		constants.AnnotationSecretsKerberosServiceNames: "HTTP,spark",
+	}
+	for key, value := range want {
+		if annotations[key] != value {
+			t.Errorf("annotation %s = %q, want %q", key, annotations[key], value)
+		}
+	}
+
+	if mount := k.GetVolumeMount(); mount.Name != KerberosVolumeName || mount.MountPath != constants.KubedoopKerberosDir {
+		t.Errorf("volume mount = %v, want the volume at %s", mount, constants.KubedoopKerberosDir)
+	}
+	if opts := k.GetJvmOpts(); len(opts) != 1 || opts[0] != "-Djava.security.krb5.conf="+Krb5ConfPath {
+		t.Errorf("JVM options = %v, want the krb5.conf of the volume", opts)
+	}
+}
@@ -0,0 +1,274 @@
+package historyserver
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	authv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/authentication/v1alpha1"
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	oputil "github.com/zncdatadev/operator-go/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/zncdatadev/spark-k8s-operator/internal/util"
+)
+
+const (
+	LdapProxyContainerName  = "ldap-proxy"
+	LdapProxyImage          = "httpd:2.4"
+	LdapProxyConfigFileName = "ldap-proxy.conf"
+
+	LdapBindCredentialsVolumeName = "ldap-bind-credentials"
+	LdapTlsVolumeName             = "ldap-tls"
+
+	// System CA bundle of the proxy image, used when the LDAP server is verified with webPki.
+	ldapWebPkiCACert = "/etc/ssl/certs/ca-certificates.crt"
+)
+
+// LdapProxy is an authenticating reverse proxy in front of the history server UI.
+// It uses apache httpd with mod_authnz_ldap, users log in with HTTP basic authentication
+// and are checked against the LDAP server of the AuthenticationClass.
+type LdapProxy struct {
+	Provider     *authv1alpha1.LDAPProvider
+	UpstreamPort int32
+	// UserHeader is the request header set to the authenticated user, empty to not forward the user.
+	UserHeader string
+}
+
+func NewLdapProxy(provider *authv1alpha1.LDAPProvider, upstreamPort int32, userHeader string) *LdapProxy {
+	return &LdapProxy{
+		Provider:     provider,
+		UpstreamPort: upstreamPort,
+		UserHeader:   userHeader,
+	}
+}
+
+func (p *LdapProxy) isTLS() bool {
+	return p.Provider.TLS != nil && p.Provider.TLS.Verification != nil
+}
+
+func (p *LdapProxy) getCACert() *commonsv1alpha1.CACert {
+	if !p.isTLS() || p.Provider.TLS.Verification.Server == nil {
+		return nil
+	}
+	return p.Provider.TLS.Verification.Server.CACert
+}
+
+func (p *LdapProxy) getCACertSecretClass() string {
+	if caCert := p.getCACert(); caCert != nil {
+		return caCert.SecretClass
+	}
+	return ""
+}
+
+// getCACertPath returns the path of the CA certificate to verify the LDAP server,
+// or empty string when the server certificate is not verified.
+func (p *LdapProxy) getCACertPath() string {
+	caCert := p.getCACert()
+	if caCert == nil {
+		return ""
+	}
+	if caCert.SecretClass != "" {
+		return path.Join(constants.KubedoopTlsDir, LdapTlsVolumeName, "ca.crt")
+	}
+	if caCert.WebPki != nil {
+		return ldapWebPkiCACert
+	}
+	return ""
+}
+
+func (p *LdapProxy) getPort() int {
+	if p.Provider.Port != 0 {
+		return p.Provider.Port
+	}
+	if p.isTLS() {
+		return 636
+	}
+	return 389
+}
+
+func (p *LdapProxy) getUidField() string {
+	if p.Provider.LDAPFieldNames != nil && p.Provider.LDAPFieldNames.Uid != "" {
+		return p.Provider.LDAPFieldNames.Uid
+	}
+	return "uid"
+}
+
+// getLdapURL returns the url used by AuthLDAPURL, e.g.
+// ldap://openldap:389/ou=users,dc=example,dc=com?uid?sub?(objectClass=person)
+func (p *LdapProxy) getLdapURL() string {
+	scheme := "ldap"
+	if p.isTLS() {
+		scheme = "ldaps"
+	}
+
+	ldapURL := url.URL{
+		Scheme: scheme,
+		Host:   p.Provider.Hostname + ":" + strconv.Itoa(p.getPort()),
+		Path:   "/" + p.Provider.SearchBase,
+	}
+
+	query := p.getUidField() + "?sub"
+	if filter := p.Provider.SearchFilter; filter != "" {
+		if !strings.HasPrefix(filter, "(") {
+			filter = "(" + filter + ")"
+		}
+		query += "?" + filter
+	}
+
+	return ldapURL.String() + "?" + query
+}
+
+func (p *LdapProxy) getBindCredentialsMountPath() string {
+	return path.Join(constants.KubedoopSecretDir, LdapBindCredentialsVolumeName)
+}
+
+// GetConfig returns the httpd configuration of the proxy.
+// The bind user and password are read from the environment at startup.
+func (p *LdapProxy) GetConfig() string {
+	var sb strings.Builder
+
+	sb.WriteString(`ServerRoot "/usr/local/apache2"
+ServerName localhost
+Listen ` + strconv.Itoa(util.LdapPort) + `
+
+LoadModule mpm_event_module modules/mod_mpm_event.so
+LoadModule unixd_module modules/mod_unixd.so
+LoadModule log_config_module modules/mod_log_config.so
+LoadModule headers_module modules/mod_headers.so
+LoadModule authn_core_module modules/mod_authn_core.so
+LoadModule authz_core_module modules/mod_authz_core.so
+LoadModule authz_user_module modules/mod_authz_user.so
+LoadModule auth_basic_module modules/mod_auth_basic.so
+LoadModule ldap_module modules/mod_ldap.so
+LoadModule authnz_ldap_module modules/mod_authnz_ldap.so
+LoadModule proxy_module modules/mod_proxy.so
+LoadModule proxy_http_module modules/mod_proxy_http.so
+
+User daemon
+Group daemon
+
+ErrorLog /proc/self/fd/2
+LogFormat "%h %l %u %t \"%r\" %>s %b" common
+CustomLog /proc/self/fd/1 common
+`)
+
+	if p.isTLS() {
+		if caCertPath := p.getCACertPath(); caCertPath != "" {
+			sb.WriteString("\nLDAPTrustedGlobalCert CA_BASE64 " + caCertPath + "\n")
+			sb.WriteString("LDAPVerifyServerCert On\n")
+		} else {
+			sb.WriteString("\nLDAPVerifyServerCert Off\n")
+		}
+	}
+
+	sb.WriteString(`
+<Location "/">
+    AuthType Basic
+    AuthName "Spark History Server"
+    AuthBasicProvider ldap
+    AuthLDAPURL "` + p.getLdapURL() + `"
+`)
+	if p.Provider.BindCredentials != nil {
+		sb.WriteString(`    AuthLDAPBindDN "${LDAP_BIND_USER}"
+    AuthLDAPBindPassword "${LDAP_BIND_PASSWORD}"
+`)
+	}
+	if p.UserHeader != "" {
+		sb.WriteString(`    RequestHeader set "` + p.UserHeader + `" "expr=%{REMOTE_USER}"
+`)
+	}
+	sb.WriteString(`    Require valid-user
+</Location>
+
+ProxyPreserveHost On
+ProxyPass "/" "http://127.0.0.1:` + strconv.Itoa(int(p.UpstreamPort)) + `/"
+ProxyPassReverse "/" "http://127.0.0.1:` + strconv.Itoa(int(p.UpstreamPort)) + `/"
+`)
+
+	return sb.String()
+}
+
+func (p *LdapProxy) getCommandArgs() string {
+	args := ""
+	if p.Provider.BindCredentials != nil {
+		args += `
+export LDAP_BIND_USER=$(cat ` + path.Join(p.getBindCredentialsMountPath(), "user") + `)
+export LDAP_BIND_PASSWORD=$(cat ` + path.Join(p.getBindCredentialsMountPath(), "password") + `)
+`
+	}
+	args += `
+exec httpd -DFOREGROUND -f ` + path.Join(constants.KubedoopConfigDirMount, LdapProxyConfigFileName) + `
+`
+	return oputil.IndentTab4Spaces(args)
+}
+
+func (p *LdapProxy) GetContainer() *corev1.Container {
+	volumeMounts := []corev1.VolumeMount{
+		{
+			Name:      ConfigVolumeName,
+			MountPath: constants.KubedoopConfigDirMount,
+		},
+	}
+
+	if p.Provider.BindCredentials != nil {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      LdapBindCredentialsVolumeName,
+			MountPath: p.getBindCredentialsMountPath(),
+		})
+	}
+
+	if p.getCACertSecretClass() != "" {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      LdapTlsVolumeName,
+			MountPath: path.Join(constants.KubedoopTlsDir, LdapTlsVolumeName),
+		})
+	}
+
+	return &corev1.Container{
+		Name:         LdapProxyContainerName,
+		Image:        LdapProxyImage,
+		Command:      []string{"/bin/bash", "-c"},
+		Args:         []string{p.getCommandArgs()},
+		Ports:        LdapPorts,
+		VolumeMounts: volumeMounts,
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("200m"),
+				corev1.ResourceMemory: resource.MustParse("128Mi"),
+			},
+		},
+		ReadinessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				TCPSocket: &corev1.TCPSocketAction{
+					Port: intstr.FromString(util.LdapPortName),
+				},
+			},
+			PeriodSeconds: 10,
+		},
+	}
+}
+
+// GetVolumes returns the volumes the proxy container mounts besides the config volume.
+func (p *LdapProxy) GetVolumes() []corev1.Volume {
+	volumes := []corev1.Volume{}
+
+	if p.Provider.BindCredentials != nil {
+		volumes = append(volumes, *newCredentialsVolume(LdapBindCredentialsVolumeName, p.Provider.BindCredentials))
+	}
+
+	if p.getCACertSecretClass() != "" {
+		volumes = append(volumes, *newSecretVolume(LdapTlsVolumeName, map[string]string{
+			constants.AnnotationSecretsClass:  p.getCACertSecretClass(),
+			constants.AnnotationSecretsScope:  fmt.Sprintf("%s,%s", constants.PodScope, constants.NodeScope),
+			constants.AnnotationSecretsFormat: string(constants.TLSPEM),
+		}))
+	}
+
+	return volumes
+}
@@ -0,0 +1,139 @@
+package historyserver
+
+import (
+	"path"
+	"strings"
+	"testing"
+
+	authv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/authentication/v1alpha1"
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	"github.com/zncdatadev/operator-go/pkg/constants"
+)
+
+func newTestLdapTLS(caCert *commonsv1alpha1.CACert) *authv1alpha1.LDAPTLS {
+	return &authv1alpha1.LDAPTLS{
+		Verification: &commonsv1alpha1.TLSVerificationSpec{
+			Server: &commonsv1alpha1.ServerVerification{CACert: caCert},
+		},
+	}
+}
+
+func TestLdapProxyURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider *authv1alpha1.LDAPProvider
+		want     string
+	}{
+		{
+			name:     "plain with the default port and uid field",
+			provider: &authv1alpha1.LDAPProvider{Hostname: "openldap", SearchBase: "ou=users,dc=example,dc=org"},
+			want:     "ldap://openldap:389/ou=users,dc=example,dc=org?uid?sub",
+		},
+		{
+			name: "tls with the default port",
+			provider: &authv1alpha1.LDAPProvider{
+				Hostname: "openldap",
+				TLS:      newTestLdapTLS(&commonsv1alpha1.CACert{WebPki: &commonsv1alpha1.WebPki{}}),
+			},
+			want: "ldaps://openldap:636/?uid?sub",
+		},
+		{
+			name: "custom port, uid field and filter",
+			provider: &authv1alpha1.LDAPProvider{
+				Hostname:       "openldap",
+				Port:           1389,
+				SearchBase:     "dc=example,dc=org",
+				SearchFilter:   "objectClass=person",
+				LDAPFieldNames: &authv1alpha1.LDAPFieldNames{Uid: "cn"},
+			},
+			want: "ldap://openldap:1389/dc=example,dc=org?cn?sub?(objectClass=person)",
+		},
+		{
+			name:     "filter in parentheses",
+			provider: &authv1alpha1.LDAPProvider{Hostname: "openldap", SearchFilter: "(&(objectClass=person)(ou=spark))"},
+			want:     "ldap://openldap:389/?uid?sub?(&(objectClass=person)(ou=spark))",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewLdapProxy(tt.provider, 18080, "").getLdapURL(); got != tt.want {
+				t.Errorf("getLdapURL() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLdapProxyTrustedCert(t *testing.T) {
+	tests := []struct {
+		name string
+		tls  *authv1alpha1.LDAPTLS
+		want string
+	}{
+		{name: "plain"},
+		{
+			name: "secret class",
+			tls:  newTestLdapTLS(&commonsv1alpha1.CACert{SecretClass: "tls"}),
+			want: "LDAPTrustedGlobalCert CA_BASE64 " + path.Join(constants.KubedoopTlsDir, LdapTlsVolumeName, "ca.crt") + "\nLDAPVerifyServerCert On\n",
+		},
+		{
+			name: "web pki",
+			tls:  newTestLdapTLS(&commonsv1alpha1.CACert{WebPki: &commonsv1alpha1.WebPki{}}),
+			want: "LDAPTrustedGlobalCert CA_BASE64 " + ldapWebPkiCACert + "\nLDAPVerifyServerCert On\n",
+		},
+		{
+			name: "no verification",
+			tls:  &authv1alpha1.LDAPTLS{Verification: &commonsv1alpha1.TLSVerificationSpec{None: &commonsv1alpha1.NoneVerification{}}},
+			want: "LDAPVerifyServerCert Off\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := NewLdapProxy(&authv1alpha1.LDAPProvider{Hostname: "openldap", TLS: tt.tls}, 18080, "").GetConfig()
+			if tt.want == "" {
+				if strings.Contains(config, "LDAPTrustedGlobalCert") || strings.Contains(config, "LDAPVerifyServerCert") {
+					t.Errorf("GetConfig() = %s, want no TLS directives", config)
+				}
+				return
+			}
+			if !strings.Contains(config, tt.want) {
+				t.Errorf("GetConfig() = %s, want %q", config, tt.want)
+			}
+		})
+	}
+}
+
+func TestLdapProxyBindCredentials(t *testing.T) {
+	provider := &authv1alpha1.LDAPProvider{Hostname: "openldap"}
+	proxy := NewLdapProxy(provider, 18080, "")
+	if volumes := proxy.GetVolumes(); len(volumes) != 0 {
+		t.Errorf("GetVolumes() = %v, want no volumes without bind credentials", volumes)
+	}
+	if config := proxy.GetConfig(); strings.Contains(config, "AuthLDAPBindDN") {
+		t.Errorf("GetConfig() = %s, want an anonymous bind", config)
+	}
+
+	provider.BindCredentials = &commonsv1alpha1.Credentials{SecretClass: "ldap-bind-credentials"}
+	volumes := proxy.GetVolumes()
+	if len(volumes) != 1 || volumes[0].Name != LdapBindCredentialsVolumeName {
+		t.Fatalf("GetVolumes() = %v, want the bind credentials volume", volumes)
+	}
+	annotations := volumes[0].Ephemeral.VolumeClaimTemplate.Annotations
+	if annotations[constants.AnnotationSecretsClass] != "ldap-bind-credentials" {
+		t.Errorf("annotations = %v, want the secret class of the bind credentials", annotations)
+	}
+
+	container := proxy.GetContainer()
+	mounted := false
+	for _, mount := range container.VolumeMounts {
+		mounted = mounted || (mount.Name == LdapBindCredentialsVolumeName && mount.MountPath == proxy.getBindCredentialsMountPath())
+	}
+	if !mounted {
+		t.Errorf("volume mounts = %v, want the bind credentials mounted", container.VolumeMounts)
+	}
+	if !strings.Contains(container.Args[0], "LDAP_BIND_PASSWORD=$(cat "+proxy.getBindCredentialsMountPath()+"/password)") {
+		t.Errorf("args = %s, want the bind password read from the volume", container.Args[0])
+	}
+	if config := proxy.GetConfig(); !strings.Contains(config, `AuthLDAPBindDN "${LDAP_BIND_USER}"`) {
+		t.Errorf("GetConfig() = %s, want the bind user", config)
+	}
+}
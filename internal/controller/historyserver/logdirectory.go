@@ -0,0 +1,225 @@
+package historyserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	"github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	"github.com/zncdatadev/operator-go/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+const (
+	ABFSAccountKeyName       = "ACCOUNT_KEY"
+	GCSServiceAccountKeyName = "service-account.json"
+
+	ABFSVolumeName = "abfs-credentials"
+	GCSVolumeName  = "gcs-credentials"
+
+	// the account key is read by hadoop from the environment, it is never written to the ConfigMap
+	abfsAccountKeyEnvName = "AZURE_STORAGE_ACCOUNT_KEY"
+	gcsEndpoint           = "https://storage.googleapis.com"
+)
+
+// ErrLogDirectoryValidation is returned when not exactly one storage of the event logs is set.
+var ErrLogDirectoryValidation = errors.New("invalid log file directory")
+
+// LogDirectory is the storage of the event logs. Its credentials are mounted from a secret-operator
+// volume into the history server and the cleanup job.
+type LogDirectory interface {
+	// GetLogDirectory returns the URL of the event logs, e.g. s3a://spark-history/events.
+	GetLogDirectory() string
+	// GetLogPath returns the prefix of the event logs in the bucket.
+	GetLogPath() string
+	// GetEgressEndpoint returns the endpoint of the storage allowed by the network policy.
+	GetEgressEndpoint() url.URL
+	// GetPartialProperties returns the spark properties of the storage, including spark.history.fs.logDirectory.
+	GetPartialProperties() map[string]string
+	// GetPartialCmdArgs returns the commands exporting the credentials before spark is started.
+	GetPartialCmdArgs() string
+	GetVolume() *corev1.Volume
+	GetVolumeMount() *corev1.VolumeMount
+}
+
+var (
+	_ LogDirectory = &S3Logconfig{}
+	_ LogDirectory = &ABFSLogconfig{}
+	_ LogDirectory = &GCSLogconfig{}
+)
+
+// NewLogDirectory returns the storage of the event logs, exactly one of the storages must be set.
+func NewLogDirectory(ctx context.Context, client *client.Client, directory *shsv1alpha1.LogFileDirectorySpec) (LogDirectory, error) {
+	if directory == nil {
+		return nil, fmt.Errorf("%w: the log file directory is required", ErrLogDirectoryValidation)
+	}
+
+	sources := 0
+	for _, set := range []bool{directory.S3 != nil, directory.ABFS != nil, directory.GCS != nil} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, fmt.Errorf("%w: exactly one of s3, abfs and gcs must be set", ErrLogDirectoryValidation)
+	}
+
+	switch {
+	case directory.ABFS != nil:
+		return NewABFSLogconfig(directory.ABFS)
+	case directory.GCS != nil:
+		return NewGCSLogconfig(directory.GCS)
+	}
+	return NewS3Logconfig(ctx, client, directory.S3)
+}
+
+// logDirectoryCredentials mounts the credentials of a storage from a secret-operator volume, it is
+// embedded by the storages of the event logs.
+type logDirectoryCredentials struct {
+	volumeName  string
+	credentials *commonsv1alpha1.Credentials
+}
+
+func (c *logDirectoryCredentials) GetVolumeName() string {
+	return c.volumeName
+}
+
+func (c *logDirectoryCredentials) GetMountPath() string {
+	return path.Join(constants.KubedoopSecretDir, c.volumeName)
+}
+
+func (c *logDirectoryCredentials) GetVolume() *corev1.Volume {
+	return newCredentialsVolume(c.volumeName, c.credentials)
+}
+
+func (c *logDirectoryCredentials) GetVolumeMount() *corev1.VolumeMount {
+	return &corev1.VolumeMount{
+		Name:      c.volumeName,
+		MountPath: c.GetMountPath(),
+	}
+}
+
+// ABFSLogconfig stores the event logs in an Azure storage account, it authenticates with the shared key.
+type ABFSLogconfig struct {
+	logDirectoryCredentials
+
+	Account        string
+	Container      string
+	EndpointSuffix string
+	LogPath        string
+}
+
+func NewABFSLogconfig(abfs *shsv1alpha1.ABFSSpec) (*ABFSLogconfig, error) {
+	if abfs.Credentials == nil {
+		return nil, fmt.Errorf("%w: the credentials of the storage account %s are required", ErrLogDirectoryValidation, abfs.Account)
+	}
+	endpointSuffix := abfs.EndpointSuffix
+	if endpointSuffix == "" {
+		endpointSuffix = "dfs.core.windows.net"
+	}
+
+	return &ABFSLogconfig{
+		logDirectoryCredentials: logDirectoryCredentials{volumeName: ABFSVolumeName, credentials: abfs.Credentials},
+		Account:                 abfs.Account,
+		Container:               abfs.Container,
+		EndpointSuffix:          endpointSuffix,
+		LogPath:                 abfs.Prefix,
+	}, nil
+}
+
+// getHost returns the DFS host of the storage account, the properties of the account are keyed by it.
+func (a *ABFSLogconfig) getHost() string {
+	return a.Account + "." + a.EndpointSuffix
+}
+
+func (a *ABFSLogconfig) GetLogDirectory() string {
+	abfsPath := url.URL{
+		Scheme: "abfss",
+		User:   url.User(a.Container),
+		Host:   a.getHost(),
+		Path:   a.LogPath,
+	}
+	return abfsPath.String()
+}
+
+func (a *ABFSLogconfig) GetLogPath() string {
+	return a.LogPath
+}
+
+func (a *ABFSLogconfig) GetEgressEndpoint() url.URL {
+	return url.URL{Scheme: "https", Host: a.getHost()}
+}
+
+func (a *ABFSLogconfig) GetPartialProperties() map[string]string {
+	return map[string]string{
+		"spark.history.fs.logDirectory":                          a.GetLogDirectory(),
+		"spark.hadoop.fs.azure.account.auth.type." + a.getHost(): "SharedKey",
+		"spark.hadoop.fs.azure.account.key." + a.getHost():       "${env." + abfsAccountKeyEnvName + "}",
+	}
+}
+
+func (a *ABFSLogconfig) GetPartialCmdArgs() string {
+	args := `
+export ` + abfsAccountKeyEnvName + `=$(cat ` + path.Join(a.GetMountPath(), ABFSAccountKeyName) + `)
+`
+
+	return util.IndentTab4Spaces(args)
+}
+
+// GCSLogconfig stores the event logs in a Google Cloud Storage bucket, it authenticates with the JSON key
+// of a service account.
+type GCSLogconfig struct {
+	logDirectoryCredentials
+
+	Bucket  string
+	LogPath string
+}
+
+func NewGCSLogconfig(gcs *shsv1alpha1.GCSSpec) (*GCSLogconfig, error) {
+	if gcs.Credentials == nil {
+		return nil, fmt.Errorf("%w: the credentials of the bucket %s are required", ErrLogDirectoryValidation, gcs.Bucket)
+	}
+
+	return &GCSLogconfig{
+		logDirectoryCredentials: logDirectoryCredentials{volumeName: GCSVolumeName, credentials: gcs.Credentials},
+		Bucket:                  gcs.Bucket,
+		LogPath:                 gcs.Prefix,
+	}, nil
+}
+
+func (g *GCSLogconfig) GetLogDirectory() string {
+	gcsPath := url.URL{
+		Scheme: "gs",
+		Host:   g.Bucket,
+		Path:   g.LogPath,
+	}
+	return gcsPath.String()
+}
+
+func (g *GCSLogconfig) GetLogPath() string {
+	return g.LogPath
+}
+
+func (g *GCSLogconfig) GetEgressEndpoint() url.URL {
+	endpoint, _ := url.Parse(gcsEndpoint)
+	return *endpoint
+}
+
+func (g *GCSLogconfig) GetPartialProperties() map[string]string {
+	return map[string]string{
+		"spark.history.fs.logDirectory":                        g.GetLogDirectory(),
+		"spark.hadoop.fs.gs.auth.type":                         "SERVICE_ACCOUNT_JSON_KEYFILE",
+		"spark.hadoop.fs.gs.auth.service.account.json.keyfile": path.Join(g.GetMountPath(), GCSServiceAccountKeyName),
+	}
+}
+
+// GetPartialCmdArgs returns no commands, the GCS connector reads the key file from the volume.
+func (g *GCSLogconfig) GetPartialCmdArgs() string {
+	return ""
+}
@@ -0,0 +1,48 @@
+package historyserver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+func TestNewLogDirectoryValidation(t *testing.T) {
+	credentials := &commonsv1alpha1.Credentials{SecretClass: "credentials"}
+	abfs := &shsv1alpha1.ABFSSpec{Account: "sparkhistory", Container: "events", Credentials: credentials}
+	gcs := &shsv1alpha1.GCSSpec{Bucket: "spark-history", Credentials: credentials}
+
+	tests := []struct {
+		name      string
+		directory *shsv1alpha1.LogFileDirectorySpec
+		wantErr   bool
+	}{
+		{name: "abfs", directory: &shsv1alpha1.LogFileDirectorySpec{ABFS: abfs}},
+		{name: "gcs", directory: &shsv1alpha1.LogFileDirectorySpec{GCS: gcs}},
+		{name: "no log file directory", wantErr: true},
+		{name: "no storage", directory: &shsv1alpha1.LogFileDirectorySpec{}, wantErr: true},
+		{name: "two storages", directory: &shsv1alpha1.LogFileDirectorySpec{ABFS: abfs, GCS: gcs}, wantErr: true},
+		{
+			name:      "no credentials",
+			directory: &shsv1alpha1.LogFileDirectorySpec{GCS: &shsv1alpha1.GCSSpec{Bucket: "spark-history"}},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logDirectory, err := NewLogDirectory(context.Background(), nil, tt.directory)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLogDirectory() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrLogDirectoryValidation) {
+				t.Errorf("NewLogDirectory() error = %v, want %v", err, ErrLogDirectoryValidation)
+			}
+			if err == nil && logDirectory.GetEgressEndpoint().Scheme != "https" {
+				t.Errorf("GetEgressEndpoint() = %v, want a HTTPS endpoint", logDirectory.GetEgressEndpoint())
+			}
+		})
+	}
+}
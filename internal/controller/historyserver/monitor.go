@@ -0,0 +1,214 @@
+package historyserver
+
+import (
+	"context"
+	"maps"
+
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	"github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+	"github.com/zncdatadev/spark-k8s-operator/internal/util"
+)
+
+const (
+	MonitoringGroup = "monitoring.coreos.com"
+)
+
+var (
+	ServiceMonitorGVK = schema.GroupVersionKind{Group: MonitoringGroup, Version: "v1", Kind: shsv1alpha1.MonitorKindServiceMonitor}
+	PodMonitorGVK     = schema.GroupVersionKind{Group: MonitoringGroup, Version: "v1", Kind: shsv1alpha1.MonitorKindPodMonitor}
+)
+
+// The following types mirror the endpoint of the Prometheus Operator monitors,
+// the monitors are built as unstructured objects to not depend on the Prometheus Operator API.
+
+type secretOrConfigMap struct {
+	Secret *corev1.SecretKeySelector `json:"secret,omitempty"`
+}
+
+type monitorTLSConfig struct {
+	CA                 *secretOrConfigMap        `json:"ca,omitempty"`
+	Cert               *secretOrConfigMap        `json:"cert,omitempty"`
+	KeySecret          *corev1.SecretKeySelector `json:"keySecret,omitempty"`
+	ServerName         string                    `json:"serverName,omitempty"`
+	InsecureSkipVerify bool                      `json:"insecureSkipVerify,omitempty"`
+}
+
+type monitorAuthorization struct {
+	Type        string                    `json:"type"`
+	Credentials *corev1.SecretKeySelector `json:"credentials"`
+}
+
+type monitorEndpoint struct {
+	Port              string                      `json:"port"`
+	Scheme            string                      `json:"scheme,omitempty"`
+	Interval          string                      `json:"interval,omitempty"`
+	ScrapeTimeout     string                      `json:"scrapeTimeout,omitempty"`
+	TLSConfig         *monitorTLSConfig           `json:"tlsConfig,omitempty"`
+	Authorization     *monitorAuthorization       `json:"authorization,omitempty"`
+	Relabelings       []shsv1alpha1.RelabelConfig `json:"relabelings,omitempty"`
+	MetricRelabelings []shsv1alpha1.RelabelConfig `json:"metricRelabelings,omitempty"`
+}
+
+var _ builder.ObjectBuilder = &MonitorBuilder{}
+
+// MonitorBuilder builds the ServiceMonitor or PodMonitor of a role group.
+// The ServiceMonitor targets the metrics service of the role group, the PodMonitor targets the pods.
+type MonitorBuilder struct {
+	builder.ObjectMeta
+
+	Spec          *shsv1alpha1.MonitorSpec
+	RoleGroupInfo *reconciler.RoleGroupInfo
+}
+
+func NewMonitorBuilder(
+	client *client.Client,
+	roleGroupInfo *reconciler.RoleGroupInfo,
+	spec *shsv1alpha1.MonitorSpec,
+	options ...builder.Option,
+) *MonitorBuilder {
+	return &MonitorBuilder{
+		ObjectMeta:    *builder.NewObjectMeta(client, roleGroupInfo.GetFullName(), options...),
+		Spec:          spec,
+		RoleGroupInfo: roleGroupInfo,
+	}
+}
+
+func (b *MonitorBuilder) GetGVK() schema.GroupVersionKind {
+	if b.Spec.Kind == shsv1alpha1.MonitorKindPodMonitor {
+		return PodMonitorGVK
+	}
+	return ServiceMonitorGVK
+}
+
+func (b *MonitorBuilder) getTLSConfig() *monitorTLSConfig {
+	tlsConfig := b.Spec.TLSConfig
+	if tlsConfig == nil {
+		return nil
+	}
+
+	config := &monitorTLSConfig{
+		KeySecret:          tlsConfig.KeySecret,
+		ServerName:         tlsConfig.ServerName,
+		InsecureSkipVerify: tlsConfig.InsecureSkipVerify,
+	}
+	if tlsConfig.CASecret != nil {
+		config.CA = &secretOrConfigMap{Secret: tlsConfig.CASecret}
+	}
+	if tlsConfig.CertSecret != nil {
+		config.Cert = &secretOrConfigMap{Secret: tlsConfig.CertSecret}
+	}
+	return config
+}
+
+func (b *MonitorBuilder) getEndpoint(port string) *monitorEndpoint {
+	endpoint := &monitorEndpoint{
+		Port:              port,
+		Scheme:            b.Spec.Scheme,
+		Interval:          b.Spec.Interval,
+		ScrapeTimeout:     b.Spec.ScrapeTimeout,
+		TLSConfig:         b.getTLSConfig(),
+		Relabelings:       b.Spec.Relabelings,
+		MetricRelabelings: b.Spec.MetricRelabelings,
+	}
+
+	if b.Spec.BearerTokenSecret != nil {
+		endpoint.Authorization = &monitorAuthorization{
+			Type:        "Bearer",
+			Credentials: b.Spec.BearerTokenSecret,
+		}
+	}
+
+	return endpoint
+}
+
+func (b *MonitorBuilder) getSpec() (map[string]any, error) {
+	selectorLabels := b.RoleGroupInfo.GetLabels()
+	endpointsField := "podMetricsEndpoints"
+	// the pod exposes the metrics on the metrics container port
+	port := util.MetricPortName
+
+	if b.GetGVK() == ServiceMonitorGVK {
+		// select the metrics service, not the service of the role group
+		selectorLabels["prometheus.io/scrape"] = trueValue
+		endpointsField = "endpoints"
+		// the metrics service exposes the metrics on the http port
+		port = util.HttpPortName
+	}
+
+	endpoint, err := runtime.DefaultUnstructuredConverter.ToUnstructured(b.getEndpoint(port))
+	if err != nil {
+		return nil, err
+	}
+
+	matchLabels := map[string]any{}
+	for k, v := range selectorLabels {
+		matchLabels[k] = v
+	}
+
+	return map[string]any{
+		"selector": map[string]any{
+			"matchLabels": matchLabels,
+		},
+		"namespaceSelector": map[string]any{
+			"matchNames": []any{b.Client.GetOwnerNamespace()},
+		},
+		endpointsField: []any{endpoint},
+	}, nil
+}
+
+func (b *MonitorBuilder) Build(_ context.Context) (ctrlclient.Object, error) {
+	spec, err := b.getSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	labels := b.GetLabels()
+	maps.Copy(labels, b.Spec.Labels)
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(b.GetGVK())
+	obj.SetName(b.GetName())
+	obj.SetNamespace(b.Client.GetOwnerNamespace())
+	obj.SetLabels(labels)
+	obj.SetAnnotations(b.GetAnnotations())
+	obj.Object["spec"] = spec
+
+	return obj, nil
+}
+
+// NewRoleGroupMonitorReconciler creates the monitor reconciler of a role group, the monitor is
+// only reconciled when the Prometheus Operator CRD is installed in the cluster.
+func NewRoleGroupMonitorReconciler(
+	client *client.Client,
+	roleGroupInfo *reconciler.RoleGroupInfo,
+	spec *shsv1alpha1.MonitorSpec,
+	options ...builder.Option,
+) reconciler.Reconciler {
+	b := NewMonitorBuilder(client, roleGroupInfo, spec, options...)
+	return NewOptionalResourceReconciler(client, b.GetGVK(), b)
+}
+
+// NewRoleGroupObsoleteMonitorReconcilers creates the reconcilers deleting the monitors of a role group which
+// are no longer configured, all monitors when the monitor is removed, or the other kind when the kind changes.
+func NewRoleGroupObsoleteMonitorReconcilers(
+	client *client.Client,
+	roleGroupInfo *reconciler.RoleGroupInfo,
+	spec *shsv1alpha1.MonitorSpec,
+) []reconciler.Reconciler {
+	reconcilers := []reconciler.Reconciler{}
+	for _, gvk := range []schema.GroupVersionKind{ServiceMonitorGVK, PodMonitorGVK} {
+		if spec != nil && NewMonitorBuilder(client, roleGroupInfo, spec).GetGVK() == gvk {
+			continue
+		}
+		reconcilers = append(reconcilers, newObsoleteUnstructuredReconciler(client, gvk, roleGroupInfo.GetFullName()))
+	}
+	return reconcilers
+}
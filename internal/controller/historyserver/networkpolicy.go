@@ -0,0 +1,307 @@
+package historyserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	"github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+	"github.com/zncdatadev/spark-k8s-operator/internal/util"
+)
+
+const (
+	DefaultMonitoringNamespace = "monitoring"
+
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+	dnsNamespace       = "kube-system"
+	dnsPort            = 53
+	kerberosPort       = 88
+
+	// vectorAggregatorAddressKey is the key of the address of the aggregator in its discovery ConfigMap.
+	vectorAggregatorAddressKey = "ADDRESS"
+)
+
+func newNetworkPolicyPort(protocol corev1.Protocol, port int32) networkingv1.NetworkPolicyPort {
+	return networkingv1.NetworkPolicyPort{
+		Protocol: ptr.To(protocol),
+		Port:     ptr.To(intstr.FromInt32(port)),
+	}
+}
+
+func newNamespacePeer(namespace string) networkingv1.NetworkPolicyPeer {
+	return networkingv1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{namespaceNameLabel: namespace},
+		},
+	}
+}
+
+// getHostPeers returns the peers of an endpoint host. NetworkPolicies can not select DNS names, so only IPs
+// and cluster services are restricted. For any other host no peer is returned, the rule then allows the
+// egress to any destination on the port of the endpoint. An external endpoint is only restricted to its
+// host when it is given by an IP.
+func getHostPeers(host string) []networkingv1.NetworkPolicyPeer {
+	if ip := net.ParseIP(host); ip != nil {
+		cidr := ip.String() + "/32"
+		if ip.To4() == nil {
+			cidr = ip.String() + "/128"
+		}
+		return []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: cidr}}}
+	}
+
+	// <service>.<namespace>.svc[.cluster.local]
+	if parts := strings.Split(host, "."); len(parts) >= 3 && parts[2] == "svc" {
+		return []networkingv1.NetworkPolicyPeer{newNamespacePeer(parts[1])}
+	}
+
+	return nil
+}
+
+func newEndpointEgressRule(host string, port int32) networkingv1.NetworkPolicyEgressRule {
+	return networkingv1.NetworkPolicyEgressRule{
+		To:    getHostPeers(host),
+		Ports: []networkingv1.NetworkPolicyPort{newNetworkPolicyPort(corev1.ProtocolTCP, port)},
+	}
+}
+
+// newURLEgressRule returns the egress rule of an endpoint URL, the port defaults to the port of the scheme.
+func newURLEgressRule(endpoint url.URL) networkingv1.NetworkPolicyEgressRule {
+	port := int32(80)
+	if endpoint.Scheme == "https" {
+		port = 443
+	}
+	if p, err := strconv.ParseInt(endpoint.Port(), 10, 32); err == nil {
+		port = int32(p)
+	}
+	return newEndpointEgressRule(endpoint.Hostname(), port)
+}
+
+var _ builder.ObjectBuilder = &NetworkPolicyBuilder{}
+
+// NetworkPolicyBuilder builds the NetworkPolicy of a role group. It allows the ingress to the UI and
+// metrics ports, and the egress to DNS, the storage of the event logs, the authentication provider, the
+// vector aggregator, the KDC and the sources of the extra jars.
+type NetworkPolicyBuilder struct {
+	builder.ObjectMeta
+
+	Spec           *shsv1alpha1.NetworkPolicySpec
+	ClusterConfig  *shsv1alpha1.ClusterConfigSpec
+	Authentication *Authentication
+	RoleGroupInfo  *reconciler.RoleGroupInfo
+}
+
+func NewNetworkPolicyBuilder(
+	client *client.Client,
+	roleGroupInfo *reconciler.RoleGroupInfo,
+	clusterConfig *shsv1alpha1.ClusterConfigSpec,
+	authentication *Authentication,
+	options ...builder.Option,
+) *NetworkPolicyBuilder {
+	return &NetworkPolicyBuilder{
+		ObjectMeta:     *builder.NewObjectMeta(client, roleGroupInfo.GetFullName(), options...),
+		Spec:           clusterConfig.NetworkPolicy,
+		ClusterConfig:  clusterConfig,
+		Authentication: authentication,
+		RoleGroupInfo:  roleGroupInfo,
+	}
+}
+
+func (b *NetworkPolicyBuilder) getMonitoringNamespace() string {
+	if b.Spec.MonitoringNamespace != "" {
+		return b.Spec.MonitoringNamespace
+	}
+	return DefaultMonitoringNamespace
+}
+
+func (b *NetworkPolicyBuilder) getIngressRules() []networkingv1.NetworkPolicyIngressRule {
+	return []networkingv1.NetworkPolicyIngressRule{
+		{
+			From:  b.Spec.UIFrom,
+			Ports: []networkingv1.NetworkPolicyPort{newNetworkPolicyPort(corev1.ProtocolTCP, getIngressBackendPort(b.Authentication))},
+		},
+		{
+			From:  []networkingv1.NetworkPolicyPeer{newNamespacePeer(b.getMonitoringNamespace())},
+			Ports: []networkingv1.NetworkPolicyPort{newNetworkPolicyPort(corev1.ProtocolTCP, util.MetricsPort)},
+		},
+	}
+}
+
+func (b *NetworkPolicyBuilder) getLogDirectoryEgressRule(ctx context.Context) (*networkingv1.NetworkPolicyEgressRule, error) {
+	logDirectory, err := NewLogDirectory(ctx, b.GetClient(), b.ClusterConfig.LogFileDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	rule := newURLEgressRule(logDirectory.GetEgressEndpoint())
+	return &rule, nil
+}
+
+// getVectorAggregatorEgressRule returns the egress to the vector aggregator, its address is read from the
+// discovery ConfigMap of the aggregator.
+func (b *NetworkPolicyBuilder) getVectorAggregatorEgressRule(ctx context.Context) (*networkingv1.NetworkPolicyEgressRule, error) {
+	name := b.ClusterConfig.VectorAggregatorConfigMapName
+	if name == "" {
+		return nil, nil
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := b.GetClient().GetWithOwnerNamespace(ctx, name, cm); err != nil {
+		return nil, fmt.Errorf("failed to get the discovery ConfigMap %s of the vector aggregator: %w", name, err)
+	}
+	address := cm.Data[vectorAggregatorAddressKey]
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q of the vector aggregator in the ConfigMap %s: %w", address, name, err)
+	}
+	portNumber, err := strconv.ParseInt(port, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q of the vector aggregator in the ConfigMap %s: %w", address, name, err)
+	}
+
+	rule := newEndpointEgressRule(host, int32(portNumber))
+	return &rule, nil
+}
+
+// getKerberosEgressRule returns the egress to the KDC. The KDC is configured in the SecretClass of the
+// secret-operator and only known from the krb5.conf in the pod, so the egress is only restricted by the port.
+func (b *NetworkPolicyBuilder) getKerberosEgressRule() *networkingv1.NetworkPolicyEgressRule {
+	if b.ClusterConfig.Kerberos == nil {
+		return nil
+	}
+	return &networkingv1.NetworkPolicyEgressRule{
+		Ports: []networkingv1.NetworkPolicyPort{
+			newNetworkPolicyPort(corev1.ProtocolUDP, kerberosPort),
+			newNetworkPolicyPort(corev1.ProtocolTCP, kerberosPort),
+		},
+	}
+}
+
+// getExtraJarsEgressRules returns the egress to the S3 endpoints and HTTP servers of the extra jars.
+func (b *NetworkPolicyBuilder) getExtraJarsEgressRules(ctx context.Context) ([]networkingv1.NetworkPolicyEgressRule, error) {
+	extraJars, err := NewExtraJars(ctx, b.GetClient(), b.ClusterConfig.ExtraJars)
+	if err != nil || extraJars == nil {
+		return nil, err
+	}
+
+	rules := []networkingv1.NetworkPolicyEgressRule{}
+	for _, endpoint := range extraJars.GetEgressEndpoints() {
+		rules = append(rules, newURLEgressRule(endpoint))
+	}
+	return rules, nil
+}
+
+func (b *NetworkPolicyBuilder) getAuthenticationEgressRule() *networkingv1.NetworkPolicyEgressRule {
+	if b.Authentication == nil {
+		return nil
+	}
+
+	var host string
+	var port int
+	if b.Authentication.IsLdap() {
+		provider := b.Authentication.GetLdapProvider()
+		host, port = provider.Hostname, provider.Port
+		if port == 0 {
+			port = 389
+			if provider.TLS != nil {
+				port = 636
+			}
+		}
+	} else {
+		provider := b.Authentication.GetOidcProvider()
+		host, port = provider.Hostname, provider.Port
+		if port == 0 {
+			port = 80
+			if provider.TLS != nil {
+				port = 443
+			}
+		}
+	}
+
+	rule := newEndpointEgressRule(host, int32(port))
+	return &rule
+}
+
+func (b *NetworkPolicyBuilder) getEgressRules(ctx context.Context) ([]networkingv1.NetworkPolicyEgressRule, error) {
+	rules := []networkingv1.NetworkPolicyEgressRule{
+		{
+			To: []networkingv1.NetworkPolicyPeer{newNamespacePeer(dnsNamespace)},
+			Ports: []networkingv1.NetworkPolicyPort{
+				newNetworkPolicyPort(corev1.ProtocolUDP, dnsPort),
+				newNetworkPolicyPort(corev1.ProtocolTCP, dnsPort),
+			},
+		},
+	}
+
+	logDirectoryRule, err := b.getLogDirectoryEgressRule(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rules = append(rules, *logDirectoryRule)
+
+	if authRule := b.getAuthenticationEgressRule(); authRule != nil {
+		rules = append(rules, *authRule)
+	}
+
+	vectorRule, err := b.getVectorAggregatorEgressRule(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if vectorRule != nil {
+		rules = append(rules, *vectorRule)
+	}
+
+	if kerberosRule := b.getKerberosEgressRule(); kerberosRule != nil {
+		rules = append(rules, *kerberosRule)
+	}
+
+	extraJarsRules, err := b.getExtraJarsEgressRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rules = append(rules, extraJarsRules...)
+
+	return append(rules, b.Spec.ExtraEgress...), nil
+}
+
+func (b *NetworkPolicyBuilder) Build(ctx context.Context) (ctrlclient.Object, error) {
+	egress, err := b.getEgressRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: b.GetObjectMeta(),
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: b.RoleGroupInfo.GetLabels(),
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+			Ingress:     b.getIngressRules(),
+			Egress:      egress,
+		},
+	}, nil
+}
+
+func NewRoleGroupNetworkPolicyReconciler(
+	client *client.Client,
+	roleGroupInfo *reconciler.RoleGroupInfo,
+	clusterConfig *shsv1alpha1.ClusterConfigSpec,
+	authentication *Authentication,
+	options ...builder.Option,
+) reconciler.Reconciler {
+	b := NewNetworkPolicyBuilder(client, roleGroupInfo, clusterConfig, authentication, options...)
+	return reconciler.NewGenericResourceReconciler(client, b)
+}
@@ -0,0 +1,131 @@
+package historyserver
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+func TestNetworkPolicyVectorAggregatorEgress(t *testing.T) {
+	ctx := context.Background()
+	c := newOptionalTestClient(t)
+	clusterConfig := &shsv1alpha1.ClusterConfigSpec{VectorAggregatorConfigMapName: "vector"}
+	b := NewNetworkPolicyBuilder(c, newOptionalTestRoleGroupInfo(c), clusterConfig, nil)
+
+	if _, err := b.getVectorAggregatorEgressRule(ctx); err == nil {
+		t.Fatal("getVectorAggregatorEgressRule() error = nil, want an error for a missing ConfigMap")
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "vector", Namespace: "default"},
+		Data:       map[string]string{vectorAggregatorAddressKey: "vector-aggregator.observability.svc.cluster.local:6000"},
+	}
+	if err := c.Client.Create(ctx, cm); err != nil {
+		t.Fatal(err)
+	}
+	rule, err := b.getVectorAggregatorEgressRule(ctx)
+	if err != nil {
+		t.Fatalf("getVectorAggregatorEgressRule() error = %v", err)
+	}
+	if len(rule.To) != 1 || rule.To[0].NamespaceSelector.MatchLabels[namespaceNameLabel] != "observability" {
+		t.Errorf("to = %v, want the namespace of the aggregator", rule.To)
+	}
+	if len(rule.Ports) != 1 || rule.Ports[0].Port.IntVal != 6000 {
+		t.Errorf("ports = %v, want the port of the aggregator", rule.Ports)
+	}
+
+	cm.Data[vectorAggregatorAddressKey] = "vector-aggregator"
+	if err := c.Client.Update(ctx, cm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.getVectorAggregatorEgressRule(ctx); err == nil {
+		t.Error("getVectorAggregatorEgressRule() error = nil, want an error for an address without port")
+	}
+}
+
+func TestNetworkPolicyKerberosEgress(t *testing.T) {
+	c := newOptionalTestClient(t)
+	clusterConfig := &shsv1alpha1.ClusterConfigSpec{}
+	b := NewNetworkPolicyBuilder(c, newOptionalTestRoleGroupInfo(c), clusterConfig, nil)
+	if rule := b.getKerberosEgressRule(); rule != nil {
+		t.Errorf("getKerberosEgressRule() = %v, want nil without kerberos", rule)
+	}
+
+	clusterConfig.Kerberos = &shsv1alpha1.KerberosSpec{SecretClass: "kerberos"}
+	rule := b.getKerberosEgressRule()
+	if rule == nil || rule.To != nil || len(rule.Ports) != 2 {
+		t.Fatalf("getKerberosEgressRule() = %v, want the KDC ports to any destination", rule)
+	}
+	for _, port := range rule.Ports {
+		if port.Port.IntVal != kerberosPort {
+			t.Errorf("port = %v, want %d", port.Port, kerberosPort)
+		}
+	}
+}
+
+func TestNetworkPolicyExtraJarsEgress(t *testing.T) {
+	c := newOptionalTestClient(t)
+	clusterConfig := &shsv1alpha1.ClusterConfigSpec{
+		ExtraJars: []shsv1alpha1.ExtraJarSpec{
+			{HTTP: &shsv1alpha1.ExtraJarHTTPSpec{URL: "https://repo.example.com/a.jar"}},
+			{HTTP: &shsv1alpha1.ExtraJarHTTPSpec{URL: "http://nexus.tools.svc:8081/b.jar"}},
+			{OCI: &shsv1alpha1.ExtraJarOCISpec{Reference: "quay.io/example/jars:1.0.0"}},
+		},
+	}
+	b := NewNetworkPolicyBuilder(c, newOptionalTestRoleGroupInfo(c), clusterConfig, nil)
+
+	rules, err := b.getExtraJarsEgressRules(context.Background())
+	if err != nil {
+		t.Fatalf("getExtraJarsEgressRules() error = %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("rules = %v, want a rule per HTTP jar", rules)
+	}
+	if rules[0].To != nil || rules[0].Ports[0].Port.IntVal != 443 {
+		t.Errorf("rule = %v, want the HTTPS port to any destination", rules[0])
+	}
+	if len(rules[1].To) != 1 || rules[1].To[0].NamespaceSelector.MatchLabels[namespaceNameLabel] != "tools" ||
+		rules[1].Ports[0].Port.IntVal != 8081 {
+		t.Errorf("rule = %v, want the port of the service in its namespace", rules[1])
+	}
+}
+
+func TestNetworkPolicyDeletedWhenRemoved(t *testing.T) {
+	ctx := context.Background()
+	c := newOptionalTestClient(t)
+	info := newOptionalTestRoleGroupInfo(c)
+
+	policy := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: info.GetFullName(), Namespace: "default"}}
+	if err := c.SetOwnerReference(policy, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Client.Create(ctx, policy); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &NodeRoleReconciler{ClusterConfig: &shsv1alpha1.ClusterConfigSpec{}}
+	r.Client = c
+	reconcilers, err := r.GetImageResourceWithRoleGroup(*info, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("GetImageResourceWithRoleGroup() error = %v", err)
+	}
+	for _, child := range reconcilers {
+		if obsolete, ok := child.(*ObsoleteResourceReconciler); ok {
+			if _, err := obsolete.Reconcile(ctx); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+		}
+	}
+
+	err = c.Client.Get(ctx, ctrlclient.ObjectKeyFromObject(policy), &networkingv1.NetworkPolicy{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("Get() error = %v, want the NetworkPolicy deleted when the networkPolicy section is removed", err)
+	}
+}
@@ -2,6 +2,7 @@ package historyserver
 
 import (
 	"context"
+	"slices"
 
 	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
 	"github.com/zncdatadev/operator-go/pkg/builder"
@@ -9,7 +10,11 @@ import (
 	"github.com/zncdatadev/operator-go/pkg/constants"
 	"github.com/zncdatadev/operator-go/pkg/reconciler"
 	oputil "github.com/zncdatadev/operator-go/pkg/util"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 
 	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
 	"github.com/zncdatadev/spark-k8s-operator/internal/util"
@@ -33,20 +38,28 @@ var (
 			ContainerPort: util.OidcPort,
 		},
 	}
+	LdapPorts = []corev1.ContainerPort{
+		{
+			Name:          util.LdapPortName,
+			ContainerPort: util.LdapPort,
+		},
+	}
 )
 
 var _ reconciler.Reconciler = &NodeRoleReconciler{}
 
 type NodeRoleReconciler struct {
 	reconciler.BaseRoleReconciler[*shsv1alpha1.RoleSpec]
-	ClusterConfig *shsv1alpha1.ClusterConfigSpec
-	Image         *oputil.Image
+	ClusterConfig  *shsv1alpha1.ClusterConfigSpec
+	Authentication *Authentication
+	Image          *oputil.Image
 }
 
 func NewNodeRoleReconciler(
 	client *resourceClient.Client,
 	clusterStopped bool,
 	clusterConfig *shsv1alpha1.ClusterConfigSpec,
+	authentication *Authentication,
 	roleInfo reconciler.RoleInfo,
 	image *oputil.Image,
 	spec *shsv1alpha1.RoleSpec,
@@ -58,8 +71,9 @@ func NewNodeRoleReconciler(
 			roleInfo,
 			spec,
 		),
-		ClusterConfig: clusterConfig,
-		Image:         image,
+		ClusterConfig:  clusterConfig,
+		Authentication: authentication,
+		Image:          image,
 	}
 }
 
@@ -80,15 +94,15 @@ func (r *NodeRoleReconciler) RegisterResources(ctx context.Context) error {
 			RoleGroupName: name,
 		}
 
-		reconcilers, err := r.GetImageResourceWithRoleGroup(info, roleGroup.Replicas, mergedRoleGroupConfig, mergedOverrides)
+		mergedOverrides, podOverrides := splitPodOverrides(mergedOverrides, r.Spec.OverridesSpec, roleGroup.OverridesSpec)
+
+		reconcilers, err := r.GetImageResourceWithRoleGroup(info, roleGroup.Replicas, mergedRoleGroupConfig, mergedOverrides, podOverrides)
 
 		if err != nil {
 			return err
 		}
 
-		for _, reconciler := range reconcilers {
-			r.AddResource(reconciler)
-		}
+		r.AddResource(NewRoleGroupReconciler(r.Client, info, reconcilers))
 	}
 	return nil
 }
@@ -98,9 +112,19 @@ func (r *NodeRoleReconciler) GetImageResourceWithRoleGroup(
 	replicas *int32,
 	config *shsv1alpha1.ConfigSpec,
 	overrides *commonsv1alpha1.OverridesSpec,
-
+	podOverrides []*runtime.RawExtension,
 ) ([]reconciler.Reconciler, error) {
 
+	if err := validateAutoscaling(&info, config); err != nil {
+		return nil, err
+	}
+	if err := validateSessionAffinity(&info, config); err != nil {
+		return nil, err
+	}
+	if err := validatePodOverridesFields(podOverrides); err != nil {
+		return nil, err
+	}
+
 	options := func(o *builder.Options) {
 		o.ClusterName = info.GetClusterName()
 		o.RoleName = info.GetRoleName()
@@ -110,14 +134,10 @@ func (r *NodeRoleReconciler) GetImageResourceWithRoleGroup(
 		o.Annotations = info.GetAnnotations()
 	}
 
-	var commonsRoleGroupConfig *commonsv1alpha1.RoleGroupConfigSpec
-	if config != nil {
-		commonsRoleGroupConfig = config.RoleGroupConfigSpec
-	}
-
 	cm := NewConfigMapReconciler(
 		r.Client,
 		r.ClusterConfig,
+		r.Authentication,
 		info,
 		config,
 		options,
@@ -127,30 +147,31 @@ func (r *NodeRoleReconciler) GetImageResourceWithRoleGroup(
 		r.Client,
 		info,
 		r.ClusterConfig,
+		r.Authentication,
 		SparkHistoryPorts,
 		r.Image,
 		replicas,
 		r.ClusterStopped(),
 		overrides,
-		commonsRoleGroupConfig,
+		podOverrides,
+		config,
 		options,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	svc := reconciler.NewServiceReconciler(
+	var sessionAffinity *shsv1alpha1.SessionAffinitySpec
+	if config != nil {
+		sessionAffinity = config.SessionAffinity
+	}
+
+	svc := NewRoleGroupServiceReconciler(
 		r.Client,
-		info.GetFullName(),
-		append(SparkHistoryPorts, OidcPorts...),
-		func(o *builder.ServiceBuilderOptions) {
-			o.ListenerClass = constants.ListenerClass(r.ClusterConfig.ListenerClass)
-			o.ClusterName = info.GetClusterName()
-			o.RoleName = info.GetRoleName()
-			o.RoleGroupName = info.GetGroupName()
-			o.Labels = info.GetLabels()
-			o.Annotations = info.GetAnnotations()
-		},
+		&info,
+		constants.ListenerClass(r.ClusterConfig.ListenerClass),
+		r.getServicePorts(),
+		sessionAffinity,
 	)
 
 	metricsService := NewRoleGroupMetricsService(
@@ -158,5 +179,103 @@ func (r *NodeRoleReconciler) GetImageResourceWithRoleGroup(
 		&info,
 	)
 
-	return []reconciler.Reconciler{cm, sts, svc, metricsService}, nil
+	reconcilers := []reconciler.Reconciler{cm, sts, svc, metricsService}
+
+	maxReplicas := getMaxReplicas(replicas, config)
+	for ordinal := range maxReplicas {
+		reconcilers = append(reconcilers, NewRoleGroupReplicaServiceReconciler(r.Client, &info, ordinal, r.getServicePorts()))
+	}
+	reconcilers = append(reconcilers, NewStaleReplicaServiceReconciler(r.Client, &info, maxReplicas))
+
+	var monitorSpec *shsv1alpha1.MonitorSpec
+	if r.ClusterConfig.Monitoring != nil {
+		monitorSpec = r.ClusterConfig.Monitoring.Monitor
+	}
+	if monitorSpec != nil {
+		monitor := NewRoleGroupMonitorReconciler(
+			r.Client,
+			&info,
+			monitorSpec,
+			options,
+		)
+		reconcilers = append(reconcilers, monitor)
+	}
+	// the leftover monitors would keep scraping the role group after the monitor is removed or its kind changed
+	reconcilers = append(reconcilers, NewRoleGroupObsoleteMonitorReconcilers(r.Client, &info, monitorSpec)...)
+
+	if r.ClusterConfig.NetworkPolicy != nil {
+		networkPolicy := NewRoleGroupNetworkPolicyReconciler(
+			r.Client,
+			&info,
+			r.ClusterConfig,
+			r.Authentication,
+			options,
+		)
+		reconcilers = append(reconcilers, networkPolicy)
+	} else {
+		// the leftover policy would keep restricting the traffic of the role group
+		networkPolicy := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: info.GetFullName()}}
+		reconcilers = append(reconcilers, NewObsoleteResourceReconciler(r.Client, networkPolicy))
+	}
+
+	var ingressSpec *shsv1alpha1.IngressSpec
+	if config != nil {
+		ingressSpec = config.Ingress
+	}
+	if ingressSpec != nil {
+		ingress := NewRoleGroupIngressReconciler(
+			r.Client,
+			&info,
+			ingressSpec,
+			sessionAffinity,
+			r.Authentication,
+			options,
+		)
+		reconcilers = append(reconcilers, ingress)
+	}
+	// the leftover Ingress or HTTPRoute would keep routing traffic to the UI
+	reconcilers = append(reconcilers, NewRoleGroupObsoleteIngressReconcilers(r.Client, &info, ingressSpec)...)
+
+	if config != nil && config.Autoscaling != nil {
+		hpa := NewRoleGroupHorizontalPodAutoscalerReconciler(
+			r.Client,
+			&info,
+			config.Autoscaling,
+			options,
+		)
+		reconcilers = append(reconcilers, hpa)
+	} else {
+		// the autoscaler would keep scaling the StatefulSet against the replicas of the role group
+		hpa := &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: info.GetFullName()}}
+		reconcilers = append(reconcilers, NewObsoleteResourceReconciler(r.Client, hpa))
+	}
+
+	return reconcilers, nil
+}
+
+// getMaxReplicas returns the number of replicas the role group can be scaled to.
+func getMaxReplicas(replicas *int32, config *shsv1alpha1.ConfigSpec) int32 {
+	if config != nil && config.Autoscaling != nil {
+		return config.Autoscaling.MaxReplicas
+	}
+	if replicas != nil {
+		return *replicas
+	}
+	return 1
+}
+
+// getServicePorts returns the ports of the role group service. When authentication is enabled the
+// UI is only exposed through the authentication proxy, the history server port is not exposed.
+func (r *NodeRoleReconciler) getServicePorts() []corev1.ContainerPort {
+	metricsPorts := slices.DeleteFunc(slices.Clone(SparkHistoryPorts), func(port corev1.ContainerPort) bool {
+		return port.Name == util.HttpPortName
+	})
+	switch {
+	case r.Authentication == nil:
+		return slices.Clone(SparkHistoryPorts)
+	case r.Authentication.IsLdap():
+		return append(slices.Clone(LdapPorts), metricsPorts...)
+	default:
+		return append(slices.Clone(OidcPorts), metricsPorts...)
+	}
 }
@@ -0,0 +1,114 @@
+package historyserver
+
+import (
+	"context"
+
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	"github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ reconciler.Reconciler = &OptionalResourceReconciler[builder.ObjectBuilder]{}
+
+// OptionalResourceReconciler reconciles a resource of an API which may not be installed in the cluster,
+// e.g. a CRD of the Prometheus Operator. The resource is skipped when the API is not served.
+// The resources built as unstructured objects are patched by the reconciler, the CreateOrUpdate of the
+// operator-go client only supports typed objects on update.
+type OptionalResourceReconciler[T builder.ObjectBuilder] struct {
+	reconciler.GenericResourceReconciler[T]
+
+	GVK schema.GroupVersionKind
+}
+
+func NewOptionalResourceReconciler[T builder.ObjectBuilder](
+	client *client.Client,
+	gvk schema.GroupVersionKind,
+	builder T,
+) *OptionalResourceReconciler[T] {
+	return &OptionalResourceReconciler[T]{
+		GenericResourceReconciler: *reconciler.NewGenericResourceReconciler(client, builder),
+		GVK:                       gvk,
+	}
+}
+
+// IsServed checks with the discovery backed RESTMapper that the API of the resource is served.
+func (r *OptionalResourceReconciler[T]) IsServed() (bool, error) {
+	_, err := r.Client.Client.RESTMapper().RESTMapping(r.GVK.GroupKind(), r.GVK.Version)
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *OptionalResourceReconciler[T]) Reconcile(ctx context.Context) (ctrl.Result, error) {
+	served, err := r.IsServed()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !served {
+		logger.V(1).Info("API is not served in the cluster, skip the resource", "gvk", r.GVK, "name", r.GetName())
+		return ctrl.Result{}, nil
+	}
+
+	resource, err := r.GetBuilder().Build(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	obj, ok := resource.(*unstructured.Unstructured)
+	if !ok {
+		return r.ResourceReconcile(ctx, resource)
+	}
+
+	mutation, err := r.createOrPatch(ctx, obj)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if mutation {
+		logger.Info("Resource created or updated", "gvk", r.GVK, "namespace", obj.GetNamespace(), "name", obj.GetName())
+		return ctrl.Result{RequeueAfter: r.RequeueAfter}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// createOrPatch creates the unstructured object or merge patches the metadata and the spec of the
+// existing object, the fields set by other controllers, e.g. the status, are kept.
+func (r *OptionalResourceReconciler[T]) createOrPatch(ctx context.Context, obj *unstructured.Unstructured) (bool, error) {
+	if err := r.Client.SetOwnerReference(obj, &r.GVK); err != nil {
+		return false, err
+	}
+
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(obj.GroupVersionKind())
+	err := r.Client.Client.Get(ctx, ctrlclient.ObjectKeyFromObject(obj), current)
+	if apierrors.IsNotFound(err) {
+		return true, r.Client.Client.Create(ctx, obj)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	desired := current.DeepCopy()
+	desired.SetLabels(obj.GetLabels())
+	desired.SetAnnotations(obj.GetAnnotations())
+	desired.SetOwnerReferences(obj.GetOwnerReferences())
+	desired.Object["spec"] = obj.Object["spec"]
+
+	patch := ctrlclient.MergeFrom(current)
+	data, err := patch.Data(desired)
+	if err != nil {
+		return false, err
+	}
+	if string(data) == "{}" {
+		return false, nil
+	}
+	return true, r.Client.Client.Patch(ctx, desired, patch)
+}
@@ -0,0 +1,144 @@
+package historyserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+// newOptionalTestClient returns a client of a cluster serving the given APIs of the optional resources.
+func newOptionalTestClient(t *testing.T, gvks ...schema.GroupVersionKind) *client.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := shsv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, gvk := range gvks {
+		mapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+	return &client.Client{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithRESTMapper(mapper).Build(),
+		OwnerReference: &shsv1alpha1.SparkHistoryServer{
+			TypeMeta:   metav1.TypeMeta{APIVersion: shsv1alpha1.GroupVersion.String(), Kind: "SparkHistoryServer"},
+			ObjectMeta: metav1.ObjectMeta{Name: "shs", Namespace: "default", UID: "uid"},
+		},
+	}
+}
+
+func newOptionalTestRoleGroupInfo(c *client.Client) *reconciler.RoleGroupInfo {
+	return &reconciler.RoleGroupInfo{
+		RoleInfo: reconciler.RoleInfo{
+			ClusterInfo: getClusterInfo(c.OwnerReference.(*shsv1alpha1.SparkHistoryServer)),
+			RoleName:    RoleName,
+		},
+		RoleGroupName: "default",
+	}
+}
+
+func TestOptionalResourceReconcilerUpdatesUnstructured(t *testing.T) {
+	ctx := context.Background()
+	c := newOptionalTestClient(t, ServiceMonitorGVK)
+	info := newOptionalTestRoleGroupInfo(c)
+
+	for _, interval := range []string{"30s", "10s", "10s"} {
+		r := NewRoleGroupMonitorReconciler(c, info, &shsv1alpha1.MonitorSpec{Interval: interval})
+		if _, err := r.Reconcile(ctx); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+
+		monitor := &unstructured.Unstructured{}
+		monitor.SetGroupVersionKind(ServiceMonitorGVK)
+		key := ctrlclient.ObjectKey{Namespace: "default", Name: info.GetFullName()}
+		if err := c.Client.Get(ctx, key, monitor); err != nil {
+			t.Fatal(err)
+		}
+		endpoints, _, _ := unstructured.NestedSlice(monitor.Object, "spec", "endpoints")
+		if len(endpoints) != 1 || endpoints[0].(map[string]any)["interval"] != interval {
+			t.Errorf("endpoints = %v, want the interval %s", endpoints, interval)
+		}
+		if len(monitor.GetOwnerReferences()) != 1 {
+			t.Errorf("owner references = %v, want the history server", monitor.GetOwnerReferences())
+		}
+	}
+}
+
+func TestOptionalResourceReconcilerSkipsUnservedAPI(t *testing.T) {
+	c := newOptionalTestClient(t)
+	info := newOptionalTestRoleGroupInfo(c)
+	r := NewRoleGroupMonitorReconciler(c, info, &shsv1alpha1.MonitorSpec{})
+	if _, err := r.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+}
+
+func TestOptionalResourceReconcilerUpdatesPrometheusRule(t *testing.T) {
+	ctx := context.Background()
+	c := newOptionalTestClient(t, PrometheusRuleGVK)
+	info := newOptionalTestRoleGroupInfo(c)
+
+	for _, severity := range []string{"warning", "critical"} {
+		spec := &shsv1alpha1.PrometheusRuleSpec{Severity: severity}
+		r := NewPrometheusRuleReconciler(c, info.ClusterInfo, spec, nil, []*reconciler.RoleGroupInfo{info})
+		if _, err := r.Reconcile(ctx); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+
+		rule := &unstructured.Unstructured{}
+		rule.SetGroupVersionKind(PrometheusRuleGVK)
+		key := ctrlclient.ObjectKey{Namespace: "default", Name: info.ClusterInfo.GetFullName()}
+		if err := c.Client.Get(ctx, key, rule); err != nil {
+			t.Fatal(err)
+		}
+		groups, _, _ := unstructured.NestedSlice(rule.Object, "spec", "groups")
+		rules := groups[0].(map[string]any)["rules"].([]any)
+		got, _, _ := unstructured.NestedString(rules[0].(map[string]any), "labels", "severity")
+		if got != severity {
+			t.Errorf("severity = %q, want %q", got, severity)
+		}
+	}
+}
+
+func TestOptionalResourceReconcilerUpdatesHTTPRoute(t *testing.T) {
+	ctx := context.Background()
+	c := newOptionalTestClient(t, HTTPRouteGVK)
+	info := newOptionalTestRoleGroupInfo(c)
+
+	for _, host := range []string{"spark.example.com", "history.example.com"} {
+		spec := &shsv1alpha1.IngressSpec{
+			Kind:       shsv1alpha1.IngressKindHTTPRoute,
+			Hosts:      []string{host},
+			ParentRefs: []shsv1alpha1.GatewayParentRef{{Name: "gateway"}},
+		}
+		r := NewRoleGroupIngressReconciler(c, info, spec, nil, nil)
+		if _, err := r.Reconcile(ctx); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+
+		route := &unstructured.Unstructured{}
+		route.SetGroupVersionKind(HTTPRouteGVK)
+		key := ctrlclient.ObjectKey{Namespace: "default", Name: info.GetFullName()}
+		if err := c.Client.Get(ctx, key, route); err != nil {
+			t.Fatal(err)
+		}
+		hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+		if len(hostnames) != 1 || hostnames[0] != host {
+			t.Errorf("hostnames = %v, want %s", hostnames, host)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package historyserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+var ErrPodOverridesValidation = errors.New("invalid pod overrides")
+
+// splitPodOverrides returns the overrides without the pod overrides, and the pod overrides of the role
+// and of the role group in order. The pod overrides are merged by applyPodOverrides, the builder of the
+// workload would apply the merged overrides, where the pod overrides of the role group replace the ones
+// of the role.
+func splitPodOverrides(
+	overrides *commonsv1alpha1.OverridesSpec,
+	role *commonsv1alpha1.OverridesSpec,
+	roleGroup *commonsv1alpha1.OverridesSpec,
+) (*commonsv1alpha1.OverridesSpec, []*runtime.RawExtension) {
+	podOverrides := []*runtime.RawExtension{}
+	for _, spec := range []*commonsv1alpha1.OverridesSpec{role, roleGroup} {
+		if spec != nil && spec.PodOverrides != nil {
+			podOverrides = append(podOverrides, spec.PodOverrides)
+		}
+	}
+	if overrides == nil {
+		return nil, podOverrides
+	}
+	overrides = overrides.DeepCopy()
+	overrides.PodOverrides = nil
+	return overrides, podOverrides
+}
+
+// applyPodOverrides merges the pod overrides into the pod template with a strategic merge patch. The
+// overrides are applied in order, the role before the role group.
+func applyPodOverrides(template *corev1.PodTemplateSpec, overrides ...*runtime.RawExtension) (*corev1.PodTemplateSpec, error) {
+	merged := template
+	for _, override := range overrides {
+		if override == nil || len(override.Raw) == 0 {
+			continue
+		}
+		podOverrides, err := decodePodOverrides(override)
+		if err != nil {
+			return nil, err
+		}
+		if err := validatePodOverrides(merged, podOverrides); err != nil {
+			return nil, err
+		}
+
+		original, err := json.Marshal(merged)
+		if err != nil {
+			return nil, err
+		}
+		data, err := strategicpatch.StrategicMergePatch(original, override.Raw, corev1.PodTemplateSpec{})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrPodOverridesValidation, err)
+		}
+
+		merged = &corev1.PodTemplateSpec{}
+		if err := json.Unmarshal(data, merged); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validateOperatorContainers(template, merged); err != nil {
+		return nil, err
+	}
+	if err := validateOperatorLabels(template, merged); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// decodePodOverrides decodes the pod overrides into a pod template. Unknown fields are rejected, they
+// would be dropped silently from the pod template, e.g. a misspelled field. The directives of the
+// strategic merge patch, e.g. $patch, are not fields of the pod template and are ignored.
+func decodePodOverrides(override *runtime.RawExtension) (*corev1.PodTemplateSpec, error) {
+	var value any
+	if err := json.Unmarshal(override.Raw, &value); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPodOverridesValidation, err)
+	}
+	data, err := json.Marshal(removePatchDirectives(value))
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	podOverrides := &corev1.PodTemplateSpec{}
+	if err := decoder.Decode(podOverrides); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPodOverridesValidation, err)
+	}
+	return podOverrides, nil
+}
+
+// validatePodOverridesFields checks the fields of the pod overrides when the resources are registered, so
+// that the errors are reported in the status of the history server.
+func validatePodOverridesFields(overrides []*runtime.RawExtension) error {
+	for _, override := range overrides {
+		if override == nil || len(override.Raw) == 0 {
+			continue
+		}
+		if _, err := decodePodOverrides(override); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removePatchDirectives(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, item := range value {
+			if strings.HasPrefix(key, "$") {
+				delete(value, key)
+				continue
+			}
+			value[key] = removePatchDirectives(item)
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = removePatchDirectives(item)
+		}
+	}
+	return value
+}
+
+// validatePodOverrides checks that the containers without an image override a container of the pod
+// template, a misspelled name would add a container which can not start.
+func validatePodOverrides(template, override *corev1.PodTemplateSpec) error {
+	if err := validateContainerOverrides("container", template.Spec.Containers, override.Spec.Containers); err != nil {
+		return err
+	}
+	return validateContainerOverrides("init container", template.Spec.InitContainers, override.Spec.InitContainers)
+}
+
+func validateContainerOverrides(kind string, containers, overrides []corev1.Container) error {
+	for _, override := range overrides {
+		if override.Image != "" || containsContainer(containers, override.Name) {
+			continue
+		}
+		return fmt.Errorf("%w: the %s %q is not managed by the operator and has no image",
+			ErrPodOverridesValidation, kind, override.Name)
+	}
+	return nil
+}
+
+// validateOperatorContainers checks that the containers and volumes of the operator are kept by the overrides.
+func validateOperatorContainers(template, merged *corev1.PodTemplateSpec) error {
+	for _, container := range template.Spec.Containers {
+		if !containsContainer(merged.Spec.Containers, container.Name) {
+			return fmt.Errorf("%w: the container %q of the operator can not be removed", ErrPodOverridesValidation, container.Name)
+		}
+	}
+	for _, container := range template.Spec.InitContainers {
+		if !containsContainer(merged.Spec.InitContainers, container.Name) {
+			return fmt.Errorf("%w: the init container %q of the operator can not be removed", ErrPodOverridesValidation, container.Name)
+		}
+	}
+	for _, volume := range template.Spec.Volumes {
+		if !containsVolume(merged.Spec.Volumes, volume.Name) {
+			return fmt.Errorf("%w: the volume %q of the operator can not be removed", ErrPodOverridesValidation, volume.Name)
+		}
+	}
+	return nil
+}
+
+// validateOperatorLabels checks that the labels of the operator are kept by the overrides, they select
+// the pods of the StatefulSet and of the Services. Other labels can be added.
+func validateOperatorLabels(template, merged *corev1.PodTemplateSpec) error {
+	for name, value := range template.Labels {
+		if merged.Labels[name] != value {
+			return fmt.Errorf("%w: the label %q of the operator can not be overridden", ErrPodOverridesValidation, name)
+		}
+	}
+	return nil
+}
+
+func containsContainer(containers []corev1.Container, name string) bool {
+	return slices.ContainsFunc(containers, func(container corev1.Container) bool { return container.Name == name })
+}
+
+func containsVolume(volumes []corev1.Volume, name string) bool {
+	return slices.ContainsFunc(volumes, func(volume corev1.Volume) bool { return volume.Name == name })
+}
@@ -0,0 +1,166 @@
+package historyserver
+
+import (
+	"errors"
+	"testing"
+
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+func newPodTemplate() *corev1.PodTemplateSpec {
+	return &corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"app.kubernetes.io/instance": "shs", "app.kubernetes.io/role-group": "default"},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: SparkHistoryContainerName, Image: "spark"}},
+			Volumes:    []corev1.Volume{{Name: ConfigVolumeName}},
+		},
+	}
+}
+
+func newPodOverrides(raw string) *runtime.RawExtension {
+	return &runtime.RawExtension{Raw: []byte(raw)}
+}
+
+func TestApplyPodOverrides(t *testing.T) {
+	role := newPodOverrides(`{"spec": {
+		"nodeSelector": {"disk": "hdd", "zone": "a"},
+		"containers": [{"name": "sidecar", "image": "busybox"}]
+	}}`)
+	// the sidecar of the role is known to the role group
+	roleGroup := newPodOverrides(`{"spec": {
+		"nodeSelector": {"disk": "ssd"},
+		"containers": [{"name": "sidecar", "args": ["sleep"]}]
+	}}`)
+
+	template := newPodTemplate()
+	got, err := applyPodOverrides(template, role, nil, roleGroup)
+	if err != nil {
+		t.Fatalf("applyPodOverrides() error = %v", err)
+	}
+
+	if got.Spec.NodeSelector["disk"] != "ssd" || got.Spec.NodeSelector["zone"] != "a" {
+		t.Errorf("NodeSelector = %v, want the role group to override the role", got.Spec.NodeSelector)
+	}
+	if len(got.Spec.Containers) != 2 {
+		t.Fatalf("Containers = %v, want the container of the operator and the sidecar", got.Spec.Containers)
+	}
+	for _, container := range got.Spec.Containers {
+		if container.Name == "sidecar" && (container.Image != "busybox" || len(container.Args) != 1) {
+			t.Errorf("sidecar = %+v, want the overrides merged", container)
+		}
+	}
+	if len(template.Spec.Containers) != 1 {
+		t.Errorf("the pod template was modified")
+	}
+}
+
+func TestApplyPodOverridesValidation(t *testing.T) {
+	// a misspelled container of the operator is not added as a container without image
+	override := newPodOverrides(`{"spec": {"containers": [{"name": "nodee", "env": [{"name": "A", "value": "B"}]}]}}`)
+	if _, err := applyPodOverrides(newPodTemplate(), override); !errors.Is(err, ErrPodOverridesValidation) {
+		t.Errorf("applyPodOverrides() error = %v, want %v", err, ErrPodOverridesValidation)
+	}
+
+	merged := newPodTemplate()
+	merged.Spec.Volumes = nil
+	if err := validateOperatorContainers(newPodTemplate(), merged); !errors.Is(err, ErrPodOverridesValidation) {
+		t.Errorf("validateOperatorContainers() error = %v, want the removed volume rejected", err)
+	}
+
+	// the selector labels of the operator can not be changed, other labels can be added
+	for _, labels := range []string{
+		`{"app.kubernetes.io/instance": "other"}`,
+		`{"app.kubernetes.io/role-group": ""}`,
+	} {
+		override = newPodOverrides(`{"metadata": {"labels": ` + labels + `}}`)
+		if _, err := applyPodOverrides(newPodTemplate(), override); !errors.Is(err, ErrPodOverridesValidation) {
+			t.Errorf("applyPodOverrides() of labels %v error = %v, want %v", labels, err, ErrPodOverridesValidation)
+		}
+	}
+	override = newPodOverrides(`{"metadata": {"labels": {"team": "data"}}}`)
+	if _, err := applyPodOverrides(newPodTemplate(), override); err != nil {
+		t.Errorf("applyPodOverrides() of a new label error = %v", err)
+	}
+}
+
+func TestPodOverridesUnknownFields(t *testing.T) {
+	for _, raw := range []string{
+		`{"spec": {"afinity": {}}}`,
+		`{"spec": {"containers": [{"name": "node", "resource": {}}]}}`,
+	} {
+		err := validatePodOverridesFields([]*runtime.RawExtension{newPodOverrides(raw)})
+		if !errors.Is(err, ErrPodOverridesValidation) {
+			t.Errorf("validatePodOverridesFields() of %s error = %v, want %v", raw, err, ErrPodOverridesValidation)
+		}
+	}
+
+	// the directives of the strategic merge patch are not unknown fields
+	override := newPodOverrides(`{"spec": {"tolerations": [], "volumes": [{"name": "scratch", "$patch": "delete"}]}}`)
+	if err := validatePodOverridesFields([]*runtime.RawExtension{override}); err != nil {
+		t.Errorf("validatePodOverridesFields() error = %v, want the directives ignored", err)
+	}
+
+	c := newOptionalTestClient(t)
+	r := &NodeRoleReconciler{ClusterConfig: &shsv1alpha1.ClusterConfigSpec{}}
+	r.Client = c
+	override = newPodOverrides(`{"spec": {"afinity": {}}}`)
+	_, err := r.GetImageResourceWithRoleGroup(*newOptionalTestRoleGroupInfo(c), nil, nil, nil, []*runtime.RawExtension{override})
+	if !errors.Is(err, ErrPodOverridesValidation) {
+		t.Errorf("GetImageResourceWithRoleGroup() error = %v, want the unknown field reported", err)
+	}
+}
+
+func TestSplitPodOverrides(t *testing.T) {
+	role := &commonsv1alpha1.OverridesSpec{PodOverrides: newPodOverrides(`{"spec": {"nodeSelector": {"disk": "hdd"}}}`)}
+	roleGroup := &commonsv1alpha1.OverridesSpec{
+		EnvOverrides: map[string]string{"A": "B"},
+		PodOverrides: newPodOverrides(`{"spec": {"priorityClassName": "high"}}`),
+	}
+
+	overrides, podOverrides := splitPodOverrides(roleGroup, role, roleGroup)
+	if overrides.PodOverrides != nil || overrides.EnvOverrides["A"] != "B" {
+		t.Errorf("overrides = %+v, want the overrides without the pod overrides", overrides)
+	}
+	if roleGroup.PodOverrides == nil {
+		t.Error("the overrides of the role group were modified")
+	}
+	if len(podOverrides) != 2 || podOverrides[0] != role.PodOverrides || podOverrides[1] != roleGroup.PodOverrides {
+		t.Errorf("pod overrides = %v, want the role before the role group", podOverrides)
+	}
+}
+
+// TestPodOverridesAffinity checks that a field of the pod spec the operator does not set reaches the StatefulSet.
+func TestPodOverridesAffinity(t *testing.T) {
+	sts := renderFixtureStatefulSet(t, "overrides", func(instance *shsv1alpha1.SparkHistoryServer) {
+		instance.Spec.Node.RoleGroups["default"].PodOverrides = newPodOverrides(`{"spec": {
+			"affinity": {"nodeAffinity": {"requiredDuringSchedulingIgnoredDuringExecution": {"nodeSelectorTerms": [
+				{"matchExpressions": [{"key": "disk", "operator": "In", "values": ["ssd"]}]}
+			]}}},
+			"hostAliases": [{"ip": "10.0.0.1", "hostnames": ["minio"]}]
+		}}`)
+	})
+
+	spec := sts.Spec.Template.Spec
+	if spec.Affinity == nil || spec.Affinity.NodeAffinity == nil ||
+		spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		t.Fatalf("affinity = %v, want the node affinity of the overrides", spec.Affinity)
+	}
+	terms := spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) != 1 || terms[0].MatchExpressions[0].Key != "disk" {
+		t.Errorf("node selector terms = %v, want the terms of the overrides", terms)
+	}
+	if len(spec.HostAliases) != 1 || spec.HostAliases[0].IP != "10.0.0.1" {
+		t.Errorf("host aliases = %v, want the host aliases of the overrides", spec.HostAliases)
+	}
+	// the overrides of the role are still applied
+	if spec.SecurityContext == nil || spec.SecurityContext.FSGroup == nil || *spec.SecurityContext.FSGroup != 1000 {
+		t.Errorf("security context = %v, want the overrides of the role", spec.SecurityContext)
+	}
+}
@@ -0,0 +1,145 @@
+package historyserver
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+const (
+	// ReadinessProbePath lists the applications loaded by the history server, the
+	// limit keeps the response small for large log directories.
+	ReadinessProbePath = "/api/v1/applications?limit=1"
+)
+
+var (
+	// The startup probe allows 10 minutes to replay the event logs before the liveness probe starts.
+	defaultStartupProbe = shsv1alpha1.ProbeSpec{
+		InitialDelaySeconds: ptr.To[int32](0),
+		PeriodSeconds:       ptr.To[int32](10),
+		TimeoutSeconds:      ptr.To[int32](5),
+		FailureThreshold:    ptr.To[int32](60),
+	}
+	defaultReadinessProbe = shsv1alpha1.ProbeSpec{
+		InitialDelaySeconds: ptr.To[int32](0),
+		PeriodSeconds:       ptr.To[int32](10),
+		TimeoutSeconds:      ptr.To[int32](5),
+		FailureThreshold:    ptr.To[int32](3),
+	}
+	defaultLivenessProbe = shsv1alpha1.ProbeSpec{
+		InitialDelaySeconds: ptr.To[int32](0),
+		PeriodSeconds:       ptr.To[int32](10),
+		TimeoutSeconds:      ptr.To[int32](5),
+		FailureThreshold:    ptr.To[int32](6),
+	}
+)
+
+func valueOr(v *int32, defaultValue *int32) int32 {
+	if v != nil {
+		return *v
+	}
+	return *defaultValue
+}
+
+// newProbe returns a probe with the given handler, the thresholds of spec override the defaults.
+func newProbe(handler corev1.ProbeHandler, spec *shsv1alpha1.ProbeSpec, defaults shsv1alpha1.ProbeSpec) *corev1.Probe {
+	if spec == nil {
+		spec = &shsv1alpha1.ProbeSpec{}
+	}
+	return &corev1.Probe{
+		ProbeHandler:        handler,
+		InitialDelaySeconds: valueOr(spec.InitialDelaySeconds, defaults.InitialDelaySeconds),
+		PeriodSeconds:       valueOr(spec.PeriodSeconds, defaults.PeriodSeconds),
+		TimeoutSeconds:      valueOr(spec.TimeoutSeconds, defaults.TimeoutSeconds),
+		FailureThreshold:    valueOr(spec.FailureThreshold, defaults.FailureThreshold),
+		SuccessThreshold:    1,
+	}
+}
+
+func newHTTPGetHandler(path string, port int32, scheme corev1.URIScheme) corev1.ProbeHandler {
+	return corev1.ProbeHandler{
+		HTTPGet: &corev1.HTTPGetAction{
+			Path:   path,
+			Port:   intstr.FromInt32(port),
+			Scheme: scheme,
+		},
+	}
+}
+
+// newLocalHTTPGetHandler checks the path from inside the container, it is used when the
+// history server only listens on the loopback interface and the kubelet can not reach it.
+func newLocalHTTPGetHandler(host string, path string, port int32, scheme corev1.URIScheme) corev1.ProbeHandler {
+	return corev1.ProbeHandler{
+		Exec: &corev1.ExecAction{
+			Command: []string{
+				"curl", "--fail", "--silent", "--output", "/dev/null",
+				fmt.Sprintf("%s://%s:%d%s", strings.ToLower(string(scheme)), host, port, path),
+			},
+		},
+	}
+}
+
+// HistoryServerProbes builds the probes of the history server container.
+type HistoryServerProbes struct {
+	Spec   *shsv1alpha1.ProbesSpec
+	Port   int32
+	Scheme corev1.URIScheme
+	// Host is the address the history server listens on when it is not reachable from outside
+	// the pod, the probes are executed in the container in this case.
+	Host string
+	// PortOnly is set when the UI is guarded by the SPNEGO filter, the kubelet can not authenticate
+	// to it and all probes only check the port is open.
+	PortOnly bool
+}
+
+func (p *HistoryServerProbes) getSpec() *shsv1alpha1.ProbesSpec {
+	if p.Spec == nil {
+		return &shsv1alpha1.ProbesSpec{}
+	}
+	return p.Spec
+}
+
+func (p *HistoryServerProbes) getHTTPGetHandler(path string) corev1.ProbeHandler {
+	if p.PortOnly {
+		return p.getPortHandler()
+	}
+	if p.Host != "" {
+		return newLocalHTTPGetHandler(p.Host, path, p.Port, p.Scheme)
+	}
+	return newHTTPGetHandler(path, p.Port, p.Scheme)
+}
+
+func (p *HistoryServerProbes) GetStartupProbe() *corev1.Probe {
+	return newProbe(p.getHTTPGetHandler(ReadinessProbePath), p.getSpec().Startup, defaultStartupProbe)
+}
+
+func (p *HistoryServerProbes) GetReadinessProbe() *corev1.Probe {
+	return newProbe(p.getHTTPGetHandler(ReadinessProbePath), p.getSpec().Readiness, defaultReadinessProbe)
+}
+
+// getPortHandler checks the port is open, from inside the container when the history server is
+// not reachable from outside the pod.
+func (p *HistoryServerProbes) getPortHandler() corev1.ProbeHandler {
+	if p.Host != "" {
+		return corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{
+				Command: []string{"bash", "-c", fmt.Sprintf("exec 3<>/dev/tcp/%s/%d", p.Host, p.Port)},
+			},
+		}
+	}
+	return corev1.ProbeHandler{
+		TCPSocket: &corev1.TCPSocketAction{
+			Port: intstr.FromInt32(p.Port),
+		},
+	}
+}
+
+// GetLivenessProbe only checks the port is open, a busy history server should not be restarted.
+func (p *HistoryServerProbes) GetLivenessProbe() *corev1.Probe {
+	return newProbe(p.getPortHandler(), p.getSpec().Liveness, defaultLivenessProbe)
+}
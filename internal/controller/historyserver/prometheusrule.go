@@ -0,0 +1,256 @@
+package historyserver
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	"github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+const (
+	PrometheusRuleKind = "PrometheusRule"
+
+	// Metrics exported by the JMX exporter of the history server, see defaultJmxExporterRules. The alerts
+	// of a role group select the series by the namespace and the pod names of the role group statefulset.
+	jvmHeapUsedMetric          = `jvm_memory_used_bytes{area="heap",%s}`
+	jvmHeapMaxMetric           = `jvm_memory_max_bytes{area="heap",%s}`
+	replayFailuresMetric       = `spark_history_cache_lookup_failure_total{%s}`
+	s3ListRequestsMetric       = `spark_history_s3a_object_list_request_total{%s}`
+	s3RequestRetriesMetric     = `spark_history_s3a_store_io_retry_total{%s}`
+	statefulsetReadyMetric     = `kube_statefulset_status_replicas_ready{%s}`
+	statefulsetReplicasMetric  = `kube_statefulset_replicas{%s}`
+	scrapeTargetUpMetric       = `up{%s}`
+	replayFailuresWindow       = "15m"
+	s3RequestErrorsWindow      = "5m"
+	defaultPrometheusRuleFor   = "5m"
+	defaultAlertSeverity       = "warning"
+	defaultHeapUsagePercent    = 90
+	defaultListingStaleAfter   = "30m"
+	defaultReplayFailures      = 1
+	defaultS3RequestErrorCount = 10
+)
+
+var (
+	PrometheusRuleGVK = schema.GroupVersionKind{Group: MonitoringGroup, Version: "v1", Kind: PrometheusRuleKind}
+
+	invalidLabelNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// toAlertLabelName converts a kubernetes label key to a valid prometheus label name,
+// e.g. app.kubernetes.io/instance to app_kubernetes_io_instance.
+func toAlertLabelName(key string) string {
+	return invalidLabelNameChars.ReplaceAllString(key, "_")
+}
+
+var _ builder.ObjectBuilder = &PrometheusRuleBuilder{}
+
+// PrometheusRuleBuilder builds the PrometheusRule of a SparkHistoryServer with an alert group per role group.
+// The listing and request alerts use the S3A metrics of hadoop, they are only added for an S3 log directory.
+type PrometheusRuleBuilder struct {
+	builder.ObjectMeta
+
+	Spec             *shsv1alpha1.PrometheusRuleSpec
+	LogFileDirectory *shsv1alpha1.LogFileDirectorySpec
+	RoleGroupInfos   []*reconciler.RoleGroupInfo
+}
+
+func NewPrometheusRuleBuilder(
+	client *client.Client,
+	name string,
+	spec *shsv1alpha1.PrometheusRuleSpec,
+	logFileDirectory *shsv1alpha1.LogFileDirectorySpec,
+	roleGroupInfos []*reconciler.RoleGroupInfo,
+	options ...builder.Option,
+) *PrometheusRuleBuilder {
+	return &PrometheusRuleBuilder{
+		ObjectMeta:       *builder.NewObjectMeta(client, name, options...),
+		Spec:             spec,
+		LogFileDirectory: logFileDirectory,
+		RoleGroupInfos:   roleGroupInfos,
+	}
+}
+
+func (b *PrometheusRuleBuilder) isS3() bool {
+	return b.LogFileDirectory != nil && b.LogFileDirectory.S3 != nil
+}
+
+func (b *PrometheusRuleBuilder) getSeverity() string {
+	if b.Spec.Severity != "" {
+		return b.Spec.Severity
+	}
+	return defaultAlertSeverity
+}
+
+func (b *PrometheusRuleBuilder) getPodDownFor() string {
+	if b.Spec.PodDownFor != "" {
+		return b.Spec.PodDownFor
+	}
+	return defaultPrometheusRuleFor
+}
+
+func (b *PrometheusRuleBuilder) getHeapUsagePercent() int32 {
+	if b.Spec.HeapUsagePercent > 0 {
+		return b.Spec.HeapUsagePercent
+	}
+	return defaultHeapUsagePercent
+}
+
+func (b *PrometheusRuleBuilder) getListingStaleAfter() string {
+	if b.Spec.ListingStaleAfter != "" {
+		return b.Spec.ListingStaleAfter
+	}
+	return defaultListingStaleAfter
+}
+
+func (b *PrometheusRuleBuilder) getReplayFailures() int32 {
+	if b.Spec.ReplayFailures > 0 {
+		return b.Spec.ReplayFailures
+	}
+	return defaultReplayFailures
+}
+
+func (b *PrometheusRuleBuilder) getS3RequestErrors() int32 {
+	if b.Spec.S3RequestErrors > 0 {
+		return b.Spec.S3RequestErrors
+	}
+	return defaultS3RequestErrorCount
+}
+
+// getAlertLabels returns the labels of the role group alerts, the labels of the role group are
+// converted to valid prometheus label names and the user labels take precedence.
+func (b *PrometheusRuleBuilder) getAlertLabels(info *reconciler.RoleGroupInfo) map[string]any {
+	labels := map[string]any{
+		"severity": b.getSeverity(),
+	}
+	for k, v := range info.GetLabels() {
+		labels[toAlertLabelName(k)] = v
+	}
+	for k, v := range b.Spec.AlertLabels {
+		labels[k] = v
+	}
+	return labels
+}
+
+func newAlert(name, expr, duration, summary string, labels map[string]any) map[string]any {
+	return map[string]any{
+		"alert":  name,
+		"expr":   expr,
+		"for":    duration,
+		"labels": labels,
+		"annotations": map[string]any{
+			"summary": summary,
+		},
+	}
+}
+
+func (b *PrometheusRuleBuilder) getRoleGroupRules(info *reconciler.RoleGroupInfo) []any {
+	namespace := b.Client.GetOwnerNamespace()
+	name := info.GetFullName()
+	podSelector := fmt.Sprintf(`namespace=%q,pod=~"%s-[0-9]+"`, namespace, name)
+	statefulsetSelector := fmt.Sprintf(`namespace=%q,statefulset=%q`, namespace, name)
+	labels := b.getAlertLabels(info)
+	podDownFor := b.getPodDownFor()
+
+	podDownExpr := fmt.Sprintf(scrapeTargetUpMetric, podSelector) + " == 0 or " +
+		fmt.Sprintf(statefulsetReadyMetric, statefulsetSelector) + " < " +
+		fmt.Sprintf(statefulsetReplicasMetric, statefulsetSelector)
+
+	heapExpr := fmt.Sprintf(jvmHeapUsedMetric, podSelector) + " / " +
+		fmt.Sprintf(jvmHeapMaxMetric, podSelector) + " * 100 > " +
+		strconv.Itoa(int(b.getHeapUsagePercent()))
+
+	replayFailuresExpr := fmt.Sprintf("increase(%s[%s]) >= %d",
+		fmt.Sprintf(replayFailuresMetric, podSelector), replayFailuresWindow, b.getReplayFailures())
+
+	rules := []any{
+		newAlert("SparkHistoryServerDown", podDownExpr, podDownFor,
+			"Spark history server "+name+" has unavailable pods.", labels),
+		newAlert("SparkHistoryServerHeapUsageHigh", heapExpr, podDownFor,
+			"Spark history server "+name+" heap usage is near the limit.", labels),
+		newAlert("SparkHistoryServerReplayFailures", replayFailuresExpr, "0m",
+			"Spark history server "+name+" failed to replay application event logs.", labels),
+	}
+	if !b.isS3() {
+		return rules
+	}
+
+	listingStale := b.getListingStaleAfter()
+	listingStaleExpr := fmt.Sprintf("increase(%s[%s]) == 0", fmt.Sprintf(s3ListRequestsMetric, podSelector), listingStale)
+
+	s3ErrorsExpr := fmt.Sprintf("increase(%s[%s]) >= %d",
+		fmt.Sprintf(s3RequestRetriesMetric, podSelector), s3RequestErrorsWindow, b.getS3RequestErrors())
+
+	return append(rules,
+		newAlert("SparkHistoryServerListingStale", listingStaleExpr, "0m",
+			"Spark history server "+name+" has not listed the event log directory for "+listingStale+".", labels),
+		newAlert("SparkHistoryServerS3RequestErrors", s3ErrorsExpr, podDownFor,
+			"Spark history server "+name+" retries failed S3 requests.", labels),
+	)
+}
+
+func (b *PrometheusRuleBuilder) getGroups() []any {
+	infos := slices.SortedFunc(slices.Values(b.RoleGroupInfos), func(a, b *reconciler.RoleGroupInfo) int {
+		return strings.Compare(a.RoleGroupName, b.RoleGroupName)
+	})
+
+	groups := make([]any, 0, len(infos))
+	for _, info := range infos {
+		groups = append(groups, map[string]any{
+			"name":  info.GetFullName(),
+			"rules": b.getRoleGroupRules(info),
+		})
+	}
+	return groups
+}
+
+func (b *PrometheusRuleBuilder) Build(_ context.Context) (ctrlclient.Object, error) {
+	labels := b.GetLabels()
+	maps.Copy(labels, b.Spec.Labels)
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(PrometheusRuleGVK)
+	obj.SetName(b.GetName())
+	obj.SetNamespace(b.Client.GetOwnerNamespace())
+	obj.SetLabels(labels)
+	obj.SetAnnotations(b.GetAnnotations())
+	obj.Object["spec"] = map[string]any{
+		"groups": b.getGroups(),
+	}
+
+	return obj, nil
+}
+
+// NewPrometheusRuleReconciler creates the PrometheusRule reconciler of the cluster, the rule is
+// only reconciled when the Prometheus Operator CRD is installed in the cluster.
+func NewPrometheusRuleReconciler(
+	client *client.Client,
+	clusterInfo reconciler.ClusterInfo,
+	spec *shsv1alpha1.PrometheusRuleSpec,
+	logFileDirectory *shsv1alpha1.LogFileDirectorySpec,
+	roleGroupInfos []*reconciler.RoleGroupInfo,
+) reconciler.Reconciler {
+	b := NewPrometheusRuleBuilder(
+		client,
+		clusterInfo.GetFullName(),
+		spec,
+		logFileDirectory,
+		roleGroupInfos,
+		func(o *builder.Options) {
+			o.Labels = clusterInfo.GetLabels()
+			o.Annotations = clusterInfo.GetAnnotations()
+		},
+	)
+	return NewOptionalResourceReconciler(client, PrometheusRuleGVK, b)
+}
@@ -0,0 +1,88 @@
+package historyserver
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+func getTestAlertNames(t *testing.T, logFileDirectory *shsv1alpha1.LogFileDirectorySpec) []string {
+	t.Helper()
+	c := newOptionalTestClient(t)
+	info := newOptionalTestRoleGroupInfo(c)
+	b := NewPrometheusRuleBuilder(c, "shs", &shsv1alpha1.PrometheusRuleSpec{}, logFileDirectory, []*reconciler.RoleGroupInfo{info})
+	obj, err := b.Build(context.Background())
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	groups, _, _ := unstructured.NestedSlice(obj.(*unstructured.Unstructured).Object, "spec", "groups")
+	names := []string{}
+	for _, rule := range groups[0].(map[string]any)["rules"].([]any) {
+		names = append(names, rule.(map[string]any)["alert"].(string))
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestPrometheusRuleAlertsByLogDirectory(t *testing.T) {
+	common := []string{"SparkHistoryServerDown", "SparkHistoryServerHeapUsageHigh", "SparkHistoryServerReplayFailures"}
+	s3 := append(slices.Clone(common), "SparkHistoryServerListingStale", "SparkHistoryServerS3RequestErrors")
+	slices.Sort(s3)
+
+	tests := []struct {
+		name             string
+		logFileDirectory *shsv1alpha1.LogFileDirectorySpec
+		want             []string
+	}{
+		{name: "s3", logFileDirectory: &shsv1alpha1.LogFileDirectorySpec{S3: &shsv1alpha1.S3Spec{}}, want: s3},
+		{name: "abfs", logFileDirectory: &shsv1alpha1.LogFileDirectorySpec{ABFS: &shsv1alpha1.ABFSSpec{}}, want: common},
+		{name: "gcs", logFileDirectory: &shsv1alpha1.LogFileDirectorySpec{GCS: &shsv1alpha1.GCSSpec{}}, want: common},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getTestAlertNames(t, tt.logFileDirectory); !slices.Equal(got, tt.want) {
+				t.Errorf("alerts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// exportJmxAttribute returns the metric name the first matching rule exports an MBean attribute as, the
+// same way the JMX exporter applies the rules.
+func exportJmxAttribute(t *testing.T, rules []shsv1alpha1.JmxExporterRule, attribute string) string {
+	t.Helper()
+	for _, rule := range rules {
+		pattern := regexp.MustCompile("^(?:" + rule.Pattern + ")$")
+		match := pattern.FindStringSubmatchIndex(attribute)
+		if match == nil {
+			continue
+		}
+		name := strings.NewReplacer("$1", "${1}", "$2", "${2}").Replace(rule.Name)
+		return strings.ToLower(string(pattern.ExpandString(nil, name, attribute, match)))
+	}
+	return ""
+}
+
+// TestPrometheusRuleMetricsExported checks the history server metrics of the alerts are exported by
+// the default JMX exporter rules, the alerts can not fire otherwise.
+func TestPrometheusRuleMetricsExported(t *testing.T) {
+	metrics := map[string]string{
+		replayFailuresMetric:   "metrics<name=history.cache.lookup.failure.count, type=counters><>Count",
+		s3ListRequestsMetric:   "Hadoop<service=s3a-file-system, name=S3AMetrics1-spark-history><>object_list_request",
+		s3RequestRetriesMetric: "Hadoop<service=s3a-file-system, name=S3AMetrics1-spark-history><>store_io_retry",
+	}
+	for metric, attribute := range metrics {
+		want := strings.TrimSuffix(metric, "{%s}")
+		if got := exportJmxAttribute(t, defaultJmxExporterRules, attribute); got != want {
+			t.Errorf("%s is exported as %q, want %q", attribute, got, want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package historyserver
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ reconciler.Reconciler = &ObsoleteResourceReconciler{}
+
+// ObsoleteResourceReconciler deletes a resource of a role group which is no longer configured, e.g. the
+// HorizontalPodAutoscaler when autoscaling is removed. Only the resources controlled by the history server
+// are deleted, the resources created by users with the same name are kept. The resources of an API which
+// is not served in the cluster, e.g. a CRD of the Prometheus Operator, are skipped.
+type ObsoleteResourceReconciler struct {
+	reconciler.BaseReconciler[any]
+
+	Object ctrlclient.Object
+}
+
+// NewObsoleteResourceReconciler creates the reconciler deleting the given resource, the name of the object
+// must be set, the namespace defaults to the namespace of the history server.
+func NewObsoleteResourceReconciler(client *client.Client, obj ctrlclient.Object) *ObsoleteResourceReconciler {
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace(client.GetOwnerNamespace())
+	}
+	return &ObsoleteResourceReconciler{
+		BaseReconciler: reconciler.BaseReconciler[any]{Client: client},
+		Object:         obj,
+	}
+}
+
+// newObsoleteUnstructuredReconciler creates the reconciler deleting a resource which is built as an
+// unstructured object, e.g. a monitor of the Prometheus Operator.
+func newObsoleteUnstructuredReconciler(client *client.Client, gvk schema.GroupVersionKind, name string) *ObsoleteResourceReconciler {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetName(name)
+	return NewObsoleteResourceReconciler(client, obj)
+}
+
+func (r *ObsoleteResourceReconciler) GetName() string {
+	return r.Object.GetName()
+}
+
+func (r *ObsoleteResourceReconciler) Reconcile(ctx context.Context) (ctrl.Result, error) {
+	if err := r.Client.Client.Get(ctx, ctrlclient.ObjectKeyFromObject(r.Object), r.Object); err != nil {
+		if meta.IsNoMatchError(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, ctrlclient.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(r.Object, r.Client.GetOwnerReference()) {
+		return ctrl.Result{}, nil
+	}
+	if err := r.Client.Client.Delete(ctx, r.Object); ctrlclient.IgnoreNotFound(err) != nil {
+		return ctrl.Result{}, err
+	}
+	logger.Info("Obsolete resource deleted", "namespace", r.Object.GetNamespace(), "name", r.Object.GetName())
+	return ctrl.Result{}, nil
+}
+
+func (r *ObsoleteResourceReconciler) Ready(_ context.Context) (ctrl.Result, error) {
+	return ctrl.Result{}, nil
+}
+
+var _ reconciler.Reconciler = &StaleReplicaServiceReconciler{}
+
+// StaleReplicaServiceReconciler deletes the Services of the replicas a role group was scaled down from,
+// the Services of the ordinals below the maximum replicas of the role group are kept.
+type StaleReplicaServiceReconciler struct {
+	reconciler.BaseReconciler[any]
+
+	RoleGroupInfo *reconciler.RoleGroupInfo
+	MaxReplicas   int32
+}
+
+func NewStaleReplicaServiceReconciler(
+	client *client.Client,
+	roleGroupInfo *reconciler.RoleGroupInfo,
+	maxReplicas int32,
+) *StaleReplicaServiceReconciler {
+	return &StaleReplicaServiceReconciler{
+		BaseReconciler: reconciler.BaseReconciler[any]{Client: client},
+		RoleGroupInfo:  roleGroupInfo,
+		MaxReplicas:    maxReplicas,
+	}
+}
+
+func (r *StaleReplicaServiceReconciler) GetName() string {
+	return r.RoleGroupInfo.GetFullName()
+}
+
+// getOrdinal returns the ordinal of the replica of a Service, false when the Service is not a replica Service.
+func (r *StaleReplicaServiceReconciler) getOrdinal(name string) (int32, bool) {
+	suffix, ok := strings.CutPrefix(name, r.RoleGroupInfo.GetFullName()+"-")
+	if !ok {
+		return 0, false
+	}
+	ordinal, err := strconv.ParseInt(suffix, 10, 32)
+	if err != nil || ordinal < 0 {
+		return 0, false
+	}
+	return int32(ordinal), true
+}
+
+func (r *StaleReplicaServiceReconciler) Reconcile(ctx context.Context) (ctrl.Result, error) {
+	list := &corev1.ServiceList{}
+	if err := r.Client.Client.List(ctx, list,
+		ctrlclient.InNamespace(r.Client.GetOwnerNamespace()),
+		ctrlclient.MatchingLabels(r.RoleGroupInfo.GetLabels()),
+	); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	for i := range list.Items {
+		svc := &list.Items[i]
+		ordinal, ok := r.getOrdinal(svc.Name)
+		if !ok || ordinal < r.MaxReplicas || !metav1.IsControlledBy(svc, r.Client.GetOwnerReference()) {
+			continue
+		}
+		if err := r.Client.Client.Delete(ctx, svc); ctrlclient.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+		logger.Info("Replica service of a scaled down role group deleted", "namespace", svc.Namespace, "name", svc.Name)
+	}
+	return ctrl.Result{}, nil
+}
+
+func (r *StaleReplicaServiceReconciler) Ready(_ context.Context) (ctrl.Result, error) {
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,136 @@
+package historyserver
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+func TestObsoleteResourceReconcilerDeletesControlledResource(t *testing.T) {
+	ctx := context.Background()
+	c := newOptionalTestClient(t, autoscalingv2.SchemeGroupVersion.WithKind("HorizontalPodAutoscaler"))
+
+	owned := &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "shs-node-default", Namespace: "default"}}
+	if err := c.SetOwnerReference(owned, nil); err != nil {
+		t.Fatal(err)
+	}
+	foreign := &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "shs-node-other", Namespace: "default"}}
+	for _, obj := range []ctrlclient.Object{owned, foreign} {
+		if err := c.Client.Create(ctx, obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"shs-node-default", "shs-node-other", "shs-node-missing"} {
+		r := NewObsoleteResourceReconciler(c, &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: name}})
+		if _, err := r.Reconcile(ctx); err != nil {
+			t.Fatalf("Reconcile() of %s error = %v", name, err)
+		}
+	}
+
+	err := c.Client.Get(ctx, ctrlclient.ObjectKeyFromObject(owned), &autoscalingv2.HorizontalPodAutoscaler{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("Get() of the controlled autoscaler error = %v, want not found", err)
+	}
+	if err := c.Client.Get(ctx, ctrlclient.ObjectKeyFromObject(foreign), &autoscalingv2.HorizontalPodAutoscaler{}); err != nil {
+		t.Errorf("Get() of the foreign autoscaler error = %v, want it kept", err)
+	}
+}
+
+func TestStaleReplicaServiceReconcilerPrunesScaledDownReplicas(t *testing.T) {
+	ctx := context.Background()
+	c := newOptionalTestClient(t, corev1.SchemeGroupVersion.WithKind("Service"))
+	info := newOptionalTestRoleGroupInfo(c)
+
+	names := []string{"shs-node-default", "shs-node-default-metrics", "shs-node-default-0", "shs-node-default-1", "shs-node-default-2"}
+	for _, name := range names {
+		svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: info.GetLabels()}}
+		if err := c.SetOwnerReference(svc, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Client.Create(ctx, svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := NewStaleReplicaServiceReconciler(c, info, 1).Reconcile(ctx); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	list := &corev1.ServiceList{}
+	if err := c.Client.List(ctx, list); err != nil {
+		t.Fatal(err)
+	}
+	kept := []string{}
+	for _, svc := range list.Items {
+		kept = append(kept, svc.Name)
+	}
+	slices.Sort(kept)
+	if want := []string{"shs-node-default", "shs-node-default-0", "shs-node-default-metrics"}; !slices.Equal(kept, want) {
+		t.Errorf("services = %v, want %v", kept, want)
+	}
+}
+
+func TestObsoleteResourceReconcilerSkipsUnservedAPI(t *testing.T) {
+	c := newOptionalTestClient(t)
+	r := newObsoleteUnstructuredReconciler(c, ServiceMonitorGVK, "shs-node-default")
+	if _, err := r.Reconcile(context.Background()); err != nil {
+		t.Errorf("Reconcile() error = %v, want the resource of an unserved API skipped", err)
+	}
+}
+
+func TestObsoleteMonitorReconcilersDeleteOtherKinds(t *testing.T) {
+	ctx := context.Background()
+	c := newOptionalTestClient(t, ServiceMonitorGVK, PodMonitorGVK)
+	info := newOptionalTestRoleGroupInfo(c)
+
+	for _, gvk := range []schema.GroupVersionKind{ServiceMonitorGVK, PodMonitorGVK} {
+		monitor := &unstructured.Unstructured{}
+		monitor.SetGroupVersionKind(gvk)
+		monitor.SetName(info.GetFullName())
+		monitor.SetNamespace("default")
+		if err := c.SetOwnerReference(monitor, &gvk); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Client.Create(ctx, monitor); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exists := func(gvk schema.GroupVersionKind) bool {
+		monitor := &unstructured.Unstructured{}
+		monitor.SetGroupVersionKind(gvk)
+		err := c.Client.Get(ctx, ctrlclient.ObjectKey{Namespace: "default", Name: info.GetFullName()}, monitor)
+		if err != nil && !apierrors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		return err == nil
+	}
+	reconcile := func(spec *shsv1alpha1.MonitorSpec) {
+		for _, r := range NewRoleGroupObsoleteMonitorReconcilers(c, info, spec) {
+			if _, err := r.Reconcile(ctx); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+		}
+	}
+
+	reconcile(&shsv1alpha1.MonitorSpec{Kind: shsv1alpha1.MonitorKindPodMonitor})
+	if exists(ServiceMonitorGVK) || !exists(PodMonitorGVK) {
+		t.Errorf("ServiceMonitor exists = %v, PodMonitor exists = %v, want only the PodMonitor kept", exists(ServiceMonitorGVK), exists(PodMonitorGVK))
+	}
+
+	reconcile(nil)
+	if exists(PodMonitorGVK) {
+		t.Error("the PodMonitor exists, want it deleted when the monitor is removed")
+	}
+}
@@ -0,0 +1,76 @@
+package historyserver
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	"github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	"k8s.io/utils/ptr"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+// resourceGroup is a reconciler of nested resources, e.g. a role or a role group.
+type resourceGroup interface {
+	GetResources() []reconciler.Reconciler
+}
+
+// getObjectBuilder returns the builder of a resource reconciler. The resource reconcilers are generic
+// over the type of their builder, so the builder is looked up by the GetBuilder method.
+func getObjectBuilder(r reconciler.Reconciler) (builder.ObjectBuilder, bool) {
+	method := reflect.ValueOf(r).MethodByName("GetBuilder")
+	if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 1 {
+		return nil, false
+	}
+	b, ok := method.Call(nil)[0].Interface().(builder.ObjectBuilder)
+	return b, ok
+}
+
+// renderResource builds the objects of a resource reconciler and of its nested resources.
+func renderResource(ctx context.Context, r reconciler.Reconciler) ([]ctrlclient.Object, error) {
+	if group, ok := r.(resourceGroup); ok {
+		objects := []ctrlclient.Object{}
+		for _, resource := range group.GetResources() {
+			objs, err := renderResource(ctx, resource)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, objs...)
+		}
+		return objects, nil
+	}
+
+	b, ok := getObjectBuilder(r)
+	if !ok {
+		return nil, nil
+	}
+	// the StatefulSet reconciler scales the StatefulSet of a stopped cluster on reconcile
+	if sts, ok := r.(*reconciler.StatefulSet); ok && sts.Stopped {
+		sts.GetBuilder().SetReplicas(ptr.To[int32](0))
+	}
+	obj, err := b.Build(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []ctrlclient.Object{obj}, nil
+}
+
+// RenderResources builds the objects the controller reconciles for a history server without applying
+// them. The referenced objects, e.g. the S3 bucket or the AuthenticationClass, are read with the client,
+// so the objects can be rendered offline with a fake client. Optional resources are rendered even when
+// their API is not served.
+func RenderResources(
+	ctx context.Context,
+	client *client.Client,
+	instance *shsv1alpha1.SparkHistoryServer,
+) ([]ctrlclient.Object, error) {
+	cluster := NewClusterReconciler(client, getClusterInfo(instance), &instance.Spec)
+	if err := cluster.RegisterResource(ctx); err != nil {
+		return nil, err
+	}
+
+	return renderResource(ctx, cluster)
+}
@@ -0,0 +1,85 @@
+package historyserver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	"go.opentelemetry.io/otel/attribute"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/zncdatadev/spark-k8s-operator/internal/tracing"
+)
+
+var _ reconciler.Reconciler = &RoleGroupReconciler{}
+
+// RoleGroupReconciler reconciles the resources of a role group in order and traces the role group
+// with a span, every resource is traced with a child span covering its build and apply.
+type RoleGroupReconciler struct {
+	Client        *client.Client
+	RoleGroupInfo reconciler.RoleGroupInfo
+	Resources     []reconciler.Reconciler
+}
+
+func NewRoleGroupReconciler(
+	client *client.Client,
+	info reconciler.RoleGroupInfo,
+	resources []reconciler.Reconciler,
+) *RoleGroupReconciler {
+	return &RoleGroupReconciler{
+		Client:        client,
+		RoleGroupInfo: info,
+		Resources:     resources,
+	}
+}
+
+func (r *RoleGroupReconciler) GetName() string {
+	return r.RoleGroupInfo.GetFullName()
+}
+
+func (r *RoleGroupReconciler) GetNamespace() string {
+	return r.Client.GetOwnerNamespace()
+}
+
+func (r *RoleGroupReconciler) GetClient() *client.Client {
+	return r.Client
+}
+
+func (r *RoleGroupReconciler) GetResources() []reconciler.Reconciler {
+	return r.Resources
+}
+
+func (r *RoleGroupReconciler) Reconcile(ctx context.Context) (result ctrl.Result, err error) {
+	ctx, span := tracing.Start(ctx, "RoleGroup.Reconcile",
+		attribute.String("role", r.RoleGroupInfo.GetRoleName()),
+		attribute.String("roleGroup", r.RoleGroupInfo.GetGroupName()),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	for _, resource := range r.Resources {
+		if result, err = r.reconcileResource(ctx, resource); !result.IsZero() || err != nil {
+			return result, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+func (r *RoleGroupReconciler) reconcileResource(ctx context.Context, resource reconciler.Reconciler) (result ctrl.Result, err error) {
+	ctx, span := tracing.Start(ctx, "Resource.Reconcile",
+		attribute.String("resource.type", fmt.Sprintf("%T", resource)),
+		attribute.String("resource.name", resource.GetName()),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	return resource.Reconcile(ctx)
+}
+
+func (r *RoleGroupReconciler) Ready(ctx context.Context) (ctrl.Result, error) {
+	for _, resource := range r.Resources {
+		if result, err := resource.Ready(ctx); !result.IsZero() || err != nil {
+			return result, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
@@ -2,21 +2,20 @@ package historyserver
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/url"
 	"path"
 	"strconv"
-	"strings"
 
 	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
 	"github.com/zncdatadev/operator-go/pkg/apis/s3/v1alpha1"
 	"github.com/zncdatadev/operator-go/pkg/client"
-	"github.com/zncdatadev/operator-go/pkg/constants"
 	"github.com/zncdatadev/operator-go/pkg/util"
-	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"go.opentelemetry.io/otel/attribute"
 
 	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+	"github.com/zncdatadev/spark-k8s-operator/internal/tracing"
 )
 
 const (
@@ -26,6 +25,9 @@ const (
 	S3VolumeName = "s3-credentials"
 )
 
+// ErrS3Resolution is returned when the S3 bucket or connection of the event logs can not be resolved.
+var ErrS3Resolution = errors.New("failed to resolve s3 bucket")
+
 // TODO: Add the tls verification
 type S3BucketConnect struct {
 	Endpoint   url.URL
@@ -48,8 +50,11 @@ func GetS3BucketConnect(ctx context.Context, client *client.Client, s3 *shsv1alp
 }
 
 func GetReferenceS3Bucket(ctx context.Context, client *client.Client, name string) (*S3BucketConnect, error) {
+	ctx, span := tracing.Start(ctx, "S3Bucket.Get", attribute.String("name", name))
 	s3Bucket := &v1alpha1.S3Bucket{}
-	if err := client.GetWithOwnerNamespace(ctx, name, s3Bucket); err != nil {
+	err := client.GetWithOwnerNamespace(ctx, name, s3Bucket)
+	tracing.End(span, err)
+	if err != nil {
 		return nil, err
 	}
 
@@ -85,14 +90,20 @@ func GetInlineS3Bucket(ctx context.Context, client *client.Client, s3Bucket *v1a
 }
 
 func GetRefreenceS3Connection(ctx context.Context, client *client.Client, name string) (*v1alpha1.S3Connection, error) {
+	ctx, span := tracing.Start(ctx, "S3Connection.Get", attribute.String("name", name))
 	s3Connection := &v1alpha1.S3Connection{}
-	if err := client.GetWithOwnerNamespace(ctx, name, s3Connection); err != nil {
+	err := client.GetWithOwnerNamespace(ctx, name, s3Connection)
+	tracing.End(span, err)
+	if err != nil {
 		return nil, err
 	}
 	return s3Connection, nil
 }
 
+// S3Logconfig stores the event logs in a S3 bucket, the credentials are exported for the s3a connector.
 type S3Logconfig struct {
+	logDirectoryCredentials
+
 	S3BucketConnect *S3BucketConnect
 	LogPath         string
 }
@@ -104,23 +115,19 @@ func NewS3Logconfig(
 ) (*S3Logconfig, error) {
 	s3BucketConnect, err := GetS3BucketConnect(ctx, client, s3.Bucket)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrS3Resolution, err)
+	}
+	if s3BucketConnect == nil {
+		return nil, fmt.Errorf("%w: the bucket is neither inline nor a reference", ErrS3Resolution)
 	}
 
 	return &S3Logconfig{
-		S3BucketConnect: s3BucketConnect,
-		LogPath:         s3.Prefix,
+		logDirectoryCredentials: logDirectoryCredentials{volumeName: S3VolumeName, credentials: s3BucketConnect.credential},
+		S3BucketConnect:         s3BucketConnect,
+		LogPath:                 s3.Prefix,
 	}, nil
 }
 
-func (s *S3Logconfig) GetMountPath() string {
-	return path.Join(constants.KubedoopSecretDir, S3VolumeName)
-}
-
-func (s *S3Logconfig) GetVolumeName() string {
-	return S3VolumeName
-}
-
 func (s *S3Logconfig) GetLogDirectory() string {
 	s3path := url.URL{
 		Scheme: "s3a",
@@ -130,10 +137,18 @@ func (s *S3Logconfig) GetLogDirectory() string {
 	return s3path.String()
 }
 
+func (s *S3Logconfig) GetLogPath() string {
+	return s.LogPath
+}
+
 func (s *S3Logconfig) GetEndpoint() string {
 	return s.S3BucketConnect.Endpoint.String()
 }
 
+func (s *S3Logconfig) GetEgressEndpoint() url.URL {
+	return s.S3BucketConnect.Endpoint
+}
+
 func (s *S3Logconfig) GetPartialProperties() map[string]string {
 
 	sslEnabled := s.S3BucketConnect.Endpoint.Scheme == "https"
@@ -147,61 +162,6 @@ func (s *S3Logconfig) GetPartialProperties() map[string]string {
 	return properties
 }
 
-func (s *S3Logconfig) GetVolume() *corev1.Volume {
-
-	credential := s.S3BucketConnect.credential
-
-	secretClass := credential.SecretClass
-
-	annotations := map[string]string{
-		constants.AnnotationSecretsClass: secretClass,
-	}
-
-	if credential.Scope != nil {
-		scopes := []string{}
-		if credential.Scope.Node {
-			scopes = append(scopes, string(constants.NodeScope))
-		}
-		if credential.Scope.Pod {
-			scopes = append(scopes, string(constants.PodScope))
-		}
-		scopes = append(scopes, credential.Scope.Services...)
-
-		annotations[constants.AnnotationSecretsScope] = strings.Join(scopes, constants.CommonDelimiter)
-	}
-	secretVolume := &corev1.Volume{
-		Name: s.GetVolumeName(),
-		VolumeSource: corev1.VolumeSource{
-			Ephemeral: &corev1.EphemeralVolumeSource{
-				VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
-					ObjectMeta: metav1.ObjectMeta{
-						Annotations: annotations,
-					},
-					Spec: corev1.PersistentVolumeClaimSpec{
-						AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
-						StorageClassName: constants.SecretStorageClassPtr(),
-						Resources: corev1.VolumeResourceRequirements{
-							Requests: corev1.ResourceList{
-								corev1.ResourceStorage: resource.MustParse("1Mi"),
-							},
-						},
-					},
-				},
-			},
-		},
-	}
-	return secretVolume
-}
-
-func (s *S3Logconfig) GetVolumeMount() *corev1.VolumeMount {
-	secretVolumeMount := &corev1.VolumeMount{
-		Name:      s.GetVolumeName(),
-		MountPath: s.GetMountPath(),
-	}
-
-	return secretVolumeMount
-}
-
 func (s *S3Logconfig) GetPartialCmdArgs() string {
 	args := `
 export AWS_ACCESS_KEY_ID=$(cat ` + path.Join(s.GetMountPath(), S3AccessKeyName) + `)
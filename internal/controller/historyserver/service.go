@@ -1,14 +1,21 @@
 package historyserver
 
 import (
+	"context"
+	"fmt"
+	"maps"
 	"strconv"
 
 	"github.com/zncdatadev/operator-go/pkg/builder"
 	"github.com/zncdatadev/operator-go/pkg/client"
 	opconstants "github.com/zncdatadev/operator-go/pkg/constants"
 	"github.com/zncdatadev/operator-go/pkg/reconciler"
-	"github.com/zncdatadev/spark-k8s-operator/internal/util"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+	"github.com/zncdatadev/spark-k8s-operator/internal/util"
 )
 
 // NewRoleGroupMetricsService creates a metrics service reconciler using a simple function approach
@@ -69,3 +76,146 @@ func NewRoleGroupMetricsService(
 		baseBuilder,
 	)
 }
+
+const (
+	DefaultSessionAffinityTimeoutSeconds int32 = 10800
+	DefaultSessionAffinityCookieName           = "spark-history-affinity"
+
+	// PodNameLabel is set by the StatefulSet controller on every pod.
+	PodNameLabel = "statefulset.kubernetes.io/pod-name"
+)
+
+func getSessionAffinityMode(spec *shsv1alpha1.SessionAffinitySpec) string {
+	if spec.Mode != "" {
+		return spec.Mode
+	}
+	return shsv1alpha1.SessionAffinityModeClientIP
+}
+
+func getSessionAffinityTimeoutSeconds(spec *shsv1alpha1.SessionAffinitySpec) int32 {
+	if spec.TimeoutSeconds != nil {
+		return *spec.TimeoutSeconds
+	}
+	return DefaultSessionAffinityTimeoutSeconds
+}
+
+func getSessionAffinityCookieName(spec *shsv1alpha1.SessionAffinitySpec) string {
+	if spec.CookieName != "" {
+		return spec.CookieName
+	}
+	return DefaultSessionAffinityCookieName
+}
+
+// isCookieSessionAffinity returns true when the affinity is handled by the Ingress or Gateway of the role group.
+func isCookieSessionAffinity(spec *shsv1alpha1.SessionAffinitySpec) bool {
+	return spec != nil && getSessionAffinityMode(spec) == shsv1alpha1.SessionAffinityModeCookie
+}
+
+// validateSessionAffinity rejects the cookie affinity without an ingress, the cookie is set by the
+// Ingress or Gateway and the role group Service can not route on it.
+func validateSessionAffinity(info *reconciler.RoleGroupInfo, config *shsv1alpha1.ConfigSpec) error {
+	if config == nil || !isCookieSessionAffinity(config.SessionAffinity) || config.Ingress != nil {
+		return nil
+	}
+	return fmt.Errorf("session affinity mode %s requires an ingress. ClusterName: %s, RoleName: %s, RoleGroupName: %s",
+		shsv1alpha1.SessionAffinityModeCookie, info.GetClusterName(), info.GetRoleName(), info.GetGroupName(),
+	)
+}
+
+var _ builder.ServiceBuilder = &RoleGroupServiceBuilder{}
+
+// RoleGroupServiceBuilder builds the Service of a role group, it pins the clients to a replica
+// when the ClientIP session affinity is configured.
+type RoleGroupServiceBuilder struct {
+	builder.BaseServiceBuilder
+
+	SessionAffinity *shsv1alpha1.SessionAffinitySpec
+}
+
+func (b *RoleGroupServiceBuilder) Build(_ context.Context) (ctrlclient.Object, error) {
+	obj := b.GetObject()
+	if b.SessionAffinity != nil && getSessionAffinityMode(b.SessionAffinity) == shsv1alpha1.SessionAffinityModeClientIP {
+		obj.Spec.SessionAffinity = corev1.ServiceAffinityClientIP
+		obj.Spec.SessionAffinityConfig = &corev1.SessionAffinityConfig{
+			ClientIP: &corev1.ClientIPConfig{
+				TimeoutSeconds: ptr.To(getSessionAffinityTimeoutSeconds(b.SessionAffinity)),
+			},
+		}
+	}
+	return obj, nil
+}
+
+// NewRoleGroupServiceReconciler creates the reconciler of the Service exposing the UI of a role group.
+func NewRoleGroupServiceReconciler(
+	client *client.Client,
+	roleGroupInfo *reconciler.RoleGroupInfo,
+	listenerClass opconstants.ListenerClass,
+	ports []corev1.ContainerPort,
+	sessionAffinity *shsv1alpha1.SessionAffinitySpec,
+) reconciler.Reconciler {
+	b := &RoleGroupServiceBuilder{
+		BaseServiceBuilder: *builder.NewServiceBuilder(
+			client,
+			roleGroupInfo.GetFullName(),
+			ports,
+			func(o *builder.ServiceBuilderOptions) {
+				o.ListenerClass = listenerClass
+				o.ClusterName = roleGroupInfo.GetClusterName()
+				o.RoleName = roleGroupInfo.GetRoleName()
+				o.RoleGroupName = roleGroupInfo.GetGroupName()
+				o.Labels = roleGroupInfo.GetLabels()
+				o.Annotations = roleGroupInfo.GetAnnotations()
+			},
+		),
+		SessionAffinity: sessionAffinity,
+	}
+	return reconciler.NewGenericResourceReconciler(client, b)
+}
+
+// getReplicaServiceName returns the name of the Service of a replica, it is the name of the pod.
+func getReplicaServiceName(roleGroupInfo *reconciler.RoleGroupInfo, ordinal int32) string {
+	return roleGroupInfo.GetFullName() + "-" + strconv.Itoa(int(ordinal))
+}
+
+var _ builder.ServiceBuilder = &ReplicaServiceBuilder{}
+
+// ReplicaServiceBuilder builds the headless Service of a single replica, so a pod of the role group
+// can be addressed directly, e.g. to debug its application cache. Not ready pods are published too.
+type ReplicaServiceBuilder struct {
+	builder.BaseServiceBuilder
+}
+
+func (b *ReplicaServiceBuilder) Build(_ context.Context) (ctrlclient.Object, error) {
+	obj := b.GetObject()
+	obj.Spec.PublishNotReadyAddresses = true
+	return obj, nil
+}
+
+// NewRoleGroupReplicaServiceReconciler creates the reconciler of the headless Service of the replica
+// with the given ordinal.
+func NewRoleGroupReplicaServiceReconciler(
+	client *client.Client,
+	roleGroupInfo *reconciler.RoleGroupInfo,
+	ordinal int32,
+	ports []corev1.ContainerPort,
+) reconciler.Reconciler {
+	name := getReplicaServiceName(roleGroupInfo, ordinal)
+	matchingLabels := maps.Clone(roleGroupInfo.GetLabels())
+	matchingLabels[PodNameLabel] = name
+
+	b := &ReplicaServiceBuilder{
+		BaseServiceBuilder: *builder.NewServiceBuilder(
+			client,
+			name,
+			ports,
+			func(o *builder.ServiceBuilderOptions) {
+				o.Headless = true
+				o.ListenerClass = opconstants.ClusterInternal
+				o.Labels = roleGroupInfo.GetLabels()
+				o.Annotations = roleGroupInfo.GetAnnotations()
+				o.MatchingLabels = matchingLabels
+			},
+		),
+	}
+	return reconciler.NewGenericResourceReconciler(client, b)
+}
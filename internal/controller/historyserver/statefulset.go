@@ -10,6 +10,7 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	authv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/authentication/v1alpha1"
 	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
@@ -21,7 +22,8 @@ import (
 	oputil "github.com/zncdatadev/operator-go/pkg/util"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
-	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 
 	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
@@ -36,6 +38,17 @@ const (
 	ConfigVolumeName = "config"
 
 	MaxLogFileSize = "10Mi"
+
+	HistoryServerClass = "org.apache.spark.deploy.history.HistoryServer"
+
+	DefaultGracefulShutdownTimeout = 5 * time.Minute
+
+	// PreStopDelaySeconds delays the SIGTERM of the containers, so the pod is
+	// removed from the service endpoints before the UI stops serving requests.
+	PreStopDelaySeconds = 5
+
+	// LoopbackAddress is the address the history server listens on when an authentication proxy fronts it.
+	LoopbackAddress = "127.0.0.1"
 )
 
 var _ builder.StatefulSetBuilder = &StatefulSetBuilder{}
@@ -44,21 +57,32 @@ type StatefulSetBuilder struct {
 	builder.StatefulSet
 	Ports          []corev1.ContainerPort
 	ClusteerConfig *shsv1alpha1.ClusterConfigSpec
-	ClusterName    string
-	RoleName       string
+	Authentication *Authentication
+	Config         *shsv1alpha1.ConfigSpec
+	// PodOverrides are merged into the pod template in order, the role before the role group.
+	PodOverrides []*runtime.RawExtension
+	ClusterName  string
+	RoleName     string
 }
 
 func NewStatefulSetBuilder(
 	client *resourceClient.Client,
 	name string,
 	clusterConfig *shsv1alpha1.ClusterConfigSpec,
+	authentication *Authentication,
 	replicas *int32,
 	ports []corev1.ContainerPort,
 	image *oputil.Image,
 	overrides *commonsv1alpha1.OverridesSpec,
-	roleGroupConfig *commonsv1alpha1.RoleGroupConfigSpec,
+	podOverrides []*runtime.RawExtension,
+	config *shsv1alpha1.ConfigSpec,
 	options ...builder.Option,
 ) *StatefulSetBuilder {
+	var roleGroupConfig *commonsv1alpha1.RoleGroupConfigSpec
+	if config != nil {
+		roleGroupConfig = config.RoleGroupConfigSpec
+	}
+
 	return &StatefulSetBuilder{
 		StatefulSet: *builder.NewStatefulSetBuilder(
 			client,
@@ -71,38 +95,56 @@ func NewStatefulSetBuilder(
 		),
 		Ports:          ports,
 		ClusteerConfig: clusterConfig,
+		Authentication: authentication,
+		Config:         config,
+		PodOverrides:   podOverrides,
 	}
 }
 
-func (b *StatefulSetBuilder) getS3LogConfig(ctx context.Context) (*S3Logconfig, error) {
-	if b.ClusteerConfig.LogFileDirectory.S3 == nil {
-		return nil, nil
-	}
-	s3Logconfig, err := NewS3Logconfig(
-		ctx,
-		b.GetClient(),
-		b.ClusteerConfig.LogFileDirectory.S3,
-	)
-	if err != nil {
-		return nil, err
-	}
-	return s3Logconfig, nil
+func (b *StatefulSetBuilder) getLogDirectory(ctx context.Context) (LogDirectory, error) {
+	return NewLogDirectory(ctx, b.GetClient(), b.ClusteerConfig.LogFileDirectory)
 }
 
-func (b *StatefulSetBuilder) getMainContainerCmdArgs(s3LogConfig *S3Logconfig) string {
-	s3LogCmdArgs := ""
+func (b *StatefulSetBuilder) getKerberos() *Kerberos {
+	return getKerberos(b.ClusteerConfig, b.Name, b.Client.GetOwnerNamespace())
+}
+
+func (b *StatefulSetBuilder) getMainContainerCmdArgs(logDirectory LogDirectory) string {
+	logDirectoryCmdArgs := logDirectory.GetPartialCmdArgs()
 
-	if s3LogConfig != nil {
-		s3LogCmdArgs = s3LogConfig.GetPartialCmdArgs()
+	kerberosCmdArgs := ""
+	if kerberos := b.getKerberos(); kerberos != nil {
+		kerberosCmdArgs = kerberos.GetPartialCmdArgs()
 	}
 
+	startCmd := path.Join(constants.KubedoopRoot, "spark/bin/spark-class") + " " + HistoryServerClass +
+		" --properties-file " + path.Join(constants.KubedoopConfigDir, SparkConfigDefauleFileName)
+
 	args := `
 
 mkdir -p ` + constants.KubedoopConfigDir + `
 cp ` + path.Join(constants.KubedoopConfigDirMount, `*`) + " " + constants.KubedoopConfigDir + `
-` + s3LogCmdArgs + `
+` + logDirectoryCmdArgs + `
+` + kerberosCmdArgs + `
 echo ""
-` + path.Join(constants.KubedoopRoot, "spark/sbin/start-history-server.sh") + ` --properties-file ` + path.Join(constants.KubedoopConfigDir, SparkConfigDefauleFileName) + `
+`
+
+	if !b.isVectorEnabled() {
+		// exec the JVM, so it receives the SIGTERM sent to the container
+		args += `exec ` + startCmd + `
+`
+		return oputil.IndentTab4Spaces(args)
+	}
+
+	// The vector sidecar is stopped with a shutdown file once the JVM exited,
+	// so bash stays the parent process and forwards SIGTERM to the JVM.
+	args = `
+` + oputil.CommonBashTrapFunctions + `
+` + oputil.RemoveVectorShutdownFileCommand() + `
+` + oputil.InvokePrepareSignalHandlers + `
+` + args + startCmd + ` &
+` + oputil.InvokeWaitForTermination + `
+` + oputil.CreateVectorShutdownFileCommand() + `
 `
 	return oputil.IndentTab4Spaces(args)
 }
@@ -110,7 +152,12 @@ echo ""
 func (b *StatefulSetBuilder) getMainContainerEnvVars() []corev1.EnvVar {
 	jvmOpts := []string{
 		"-Dlog4j.configurationFile=" + path.Join(constants.KubedoopConfigDir, "log4j2.properties"),
-		"-javaagent:" + path.Join(constants.KubedoopJmxDir, fmt.Sprintf("jmx_prometheus_javaagent.jar=%d:%s", util.MetricsPort, path.Join(constants.KubedoopJmxDir, "config.yaml"))),
+		"-javaagent:" + path.Join(constants.KubedoopJmxDir, fmt.Sprintf("jmx_prometheus_javaagent.jar=%d:%s", util.MetricsPort, JmxExporterConfigPath)),
+	}
+
+	kerberos := b.getKerberos()
+	if kerberos != nil {
+		jvmOpts = append(jvmOpts, kerberos.GetJvmOpts()...)
 	}
 
 	envVars := []corev1.EnvVar{
@@ -120,7 +167,7 @@ func (b *StatefulSetBuilder) getMainContainerEnvVars() []corev1.EnvVar {
 		},
 		{
 			Name:  "SPARK_DAEMON_CLASSPATH",
-			Value: "/kubedoop/spark/extra-jars/*",
+			Value: ExtraJarsDir + "/*",
 		},
 		{
 			Name:  "SPARK_HISTORY_OPTS",
@@ -128,30 +175,61 @@ func (b *StatefulSetBuilder) getMainContainerEnvVars() []corev1.EnvVar {
 		},
 	}
 
+	if kerberos != nil {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "KRB5_CONFIG",
+			Value: Krb5ConfPath,
+		})
+	}
+
+	// The authentication proxy is the only entrypoint of the UI, the history server must not be reachable
+	// from outside the pod, otherwise the proxy can be bypassed.
+	if b.Authentication != nil {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "SPARK_LOCAL_IP",
+			Value: LoopbackAddress,
+		})
+	}
+
 	return envVars
 }
 
-func (b *StatefulSetBuilder) getMainContainer(s3LogConfig *S3Logconfig) *builder.Container {
+// getUIScheme returns the scheme the history server UI is served with, the probes use it.
+// The history server does not serve the UI with TLS, a TLS secret of the Ingress is terminated by the
+// Ingress controller, so the scheme is always HTTP. HTTPS probes are out of scope until the UI serves TLS.
+func (b *StatefulSetBuilder) getUIScheme() corev1.URIScheme {
+	return corev1.URISchemeHTTP
+}
+
+func (b *StatefulSetBuilder) getProbes() *HistoryServerProbes {
+	probes := &HistoryServerProbes{
+		Port:   b.getHttpPort(),
+		Scheme: b.getUIScheme(),
+	}
+	if b.Authentication != nil {
+		probes.Host = LoopbackAddress
+	} else if b.getKerberos() != nil {
+		// the SPNEGO filter guards the whole UI, see ConfigMapBuilder.getUIFilters
+		probes.PortOnly = true
+	}
+	if b.Config != nil {
+		probes.Spec = b.Config.Probes
+	}
+	return probes
+}
+
+func (b *StatefulSetBuilder) getMainContainer(logDirectory LogDirectory) *builder.Container {
 	containerBuilder := builder.NewContainer(SparkHistoryContainerName, b.GetImage())
 	containerBuilder.SetCommand([]string{"/bin/bash", "-c"})
-	containerBuilder.SetArgs([]string{b.getMainContainerCmdArgs(s3LogConfig)})
+	containerBuilder.SetArgs([]string{b.getMainContainerCmdArgs(logDirectory)})
 	containerBuilder.AddPorts(b.Ports)
 	containerBuilder.AddEnvVars(b.getMainContainerEnvVars())
 	containerBuilder.SetSecurityContext(0, 0, false)
 
-	probe := &corev1.Probe{
-		ProbeHandler: corev1.ProbeHandler{
-			TCPSocket: &corev1.TCPSocketAction{
-				Port: intstr.FromInt(18080),
-			},
-		},
-		InitialDelaySeconds: 10,
-		TimeoutSeconds:      5,
-		PeriodSeconds:       10,
-		SuccessThreshold:    1,
-	}
-	containerBuilder.SetReadinessProbe(probe)
-	containerBuilder.SetLivenessProbe(probe)
+	probes := b.getProbes()
+	containerBuilder.SetStartupProbe(probes.GetStartupProbe())
+	containerBuilder.SetReadinessProbe(probes.GetReadinessProbe())
+	containerBuilder.SetLivenessProbe(probes.GetLivenessProbe())
 
 	return containerBuilder
 }
@@ -178,18 +256,38 @@ func (b *StatefulSetBuilder) addSparkDefaultConfigVolume(containerBuilder *build
 	containerBuilder.AddVolumeMount(volumeMount)
 }
 
-func (b *StatefulSetBuilder) addS3CrenditialVolume(containerBuilder *builder.Container, s3LogConfig *S3Logconfig) {
-	if s3LogConfig == nil {
-		return
-	}
-
-	volume := s3LogConfig.GetVolume()
+// addLogDirectoryCredentialsVolume mounts the credentials of the storage of the event logs.
+func (b *StatefulSetBuilder) addLogDirectoryCredentialsVolume(containerBuilder *builder.Container, logDirectory LogDirectory) {
+	volume := logDirectory.GetVolume()
 	b.AddVolume(volume)
 
-	volumeMount := s3LogConfig.GetVolumeMount()
+	volumeMount := logDirectory.GetVolumeMount()
 	containerBuilder.AddVolumeMount(volumeMount)
 }
 
+// addExtraJars adds the init container downloading the extra jars into the classpath of the history server.
+func (b *StatefulSetBuilder) addExtraJars(ctx context.Context, containerBuilder *builder.Container) error {
+	extraJars, err := NewExtraJars(ctx, b.GetClient(), b.ClusteerConfig.ExtraJars)
+	if err != nil || extraJars == nil {
+		return err
+	}
+
+	b.AddInitContainer(extraJars.GetInitContainer(b.GetImage()))
+	b.AddVolumes(extraJars.GetVolumes())
+	containerBuilder.AddVolumeMount(extraJars.GetVolumeMount())
+	return nil
+}
+
+func (b *StatefulSetBuilder) addKerberosVolume(containerBuilder *builder.Container) {
+	kerberos := b.getKerberos()
+	if kerberos == nil {
+		return
+	}
+
+	b.AddVolume(kerberos.GetVolume())
+	containerBuilder.AddVolumeMount(kerberos.GetVolumeMount())
+}
+
 // add log volume to container
 func (b *StatefulSetBuilder) addLogVolume(containerBuilder *builder.Container) {
 	volume := &corev1.Volume{
@@ -213,18 +311,32 @@ func (b *StatefulSetBuilder) addLogVolume(containerBuilder *builder.Container) {
 	containerBuilder.AddVolumeMount(volumeMount)
 }
 
-func (b *StatefulSetBuilder) getOidcContainer(ctx context.Context) (*corev1.Container, error) {
-	authClass := &authv1alpha1.AuthenticationClass{}
-	if err := b.Client.GetWithOwnerNamespace(ctx, b.ClusteerConfig.Authentication.AuthenticationClass, authClass); err != nil {
-		return nil, err
+func (b *StatefulSetBuilder) getHttpPort() int32 {
+	for _, port := range b.Ports {
+		if port.Name == util.HttpPortName {
+			return port.ContainerPort
+		}
 	}
+	return util.HttpPort
+}
 
-	if authClass.Spec.AuthenticationProvider.OIDC == nil {
-		return nil, nil
-	}
+func (b *StatefulSetBuilder) isVectorEnabled() bool {
+	return b.ClusteerConfig != nil && b.ClusteerConfig.VectorAggregatorConfigMapName != ""
+}
 
-	oidcProvider := authClass.Spec.AuthenticationProvider.OIDC
+// getPreStopLifecycle returns the preStop hook delaying the SIGTERM of a container. The hook execs sleep,
+// the sleep action of the API requires the PodLifecycleSleepAction feature of Kubernetes 1.30.
+func getPreStopLifecycle() *corev1.Lifecycle {
+	return &corev1.Lifecycle{
+		PreStop: &corev1.LifecycleHandler{
+			Exec: &corev1.ExecAction{
+				Command: []string{"sleep", strconv.Itoa(PreStopDelaySeconds)},
+			},
+		},
+	}
+}
 
+func (b *StatefulSetBuilder) getOidcContainer(oidcProvider *authv1alpha1.OIDCProvider) *corev1.Container {
 	scopes := []string{"openid", "email", "profile"}
 
 	if b.ClusteerConfig.Authentication.Oidc.ExtraScopes != nil {
@@ -256,15 +368,22 @@ func (b *StatefulSetBuilder) getOidcContainer(ctx context.Context) (*corev1.Cont
 
 	cookieSecret := base64.StdEncoding.EncodeToString([]byte(base64.StdEncoding.EncodeToString(tokenBytes)))
 
-	var sparkHistoryPorts int32
-
-	for _, port := range b.Ports {
-		if port.Name == util.HttpPortName {
-			sparkHistoryPorts = port.ContainerPort
-			break
-		}
+	envVars := []corev1.EnvVar{}
+	if b.ClusteerConfig.Authorization != nil {
+		// forward the authenticated user to spark, it is read by the authorization filter
+		envVars = append(envVars,
+			corev1.EnvVar{
+				Name:  "OAUTH2_PROXY_PASS_USER_HEADERS",
+				Value: trueValue,
+			},
+			corev1.EnvVar{
+				Name:  "OAUTH2_PROXY_SET_XAUTHREQUEST",
+				Value: trueValue,
+			},
+		)
 	}
 
+	// The oauth2-proxy image is distroless, it has no preStop hook as there is no sleep to exec.
 	oidcContainer := &corev1.Container{
 		Name:  "oidc",
 		Image: "quay.io/oauth2-proxy/oauth2-proxy:latest",
@@ -309,7 +428,7 @@ func (b *StatefulSetBuilder) getOidcContainer(ctx context.Context) (*corev1.Cont
 			},
 			{
 				Name:  "OAUTH2_PROXY_UPSTREAMS",
-				Value: "http://localhost:" + strconv.Itoa(int(sparkHistoryPorts)),
+				Value: "http://" + LoopbackAddress + ":" + strconv.Itoa(int(b.getHttpPort())),
 			},
 			{
 				Name:  "OAUTH2_PROXY_HTTP_ADDRESS",
@@ -340,32 +459,59 @@ func (b *StatefulSetBuilder) getOidcContainer(ctx context.Context) (*corev1.Cont
 		},
 		Ports: OidcPorts,
 	}
+	oidcContainer.Env = append(oidcContainer.Env, envVars...)
+
+	return oidcContainer
+}
+
+func (b *StatefulSetBuilder) addAuthenticationContainer() {
+	if b.Authentication == nil {
+		return
+	}
 
-	return oidcContainer, nil
+	switch {
+	case b.Authentication.IsOidc():
+		b.AddContainer(b.getOidcContainer(b.Authentication.GetOidcProvider()))
+	case b.Authentication.IsLdap():
+		ldapProxy := NewLdapProxy(b.Authentication.GetLdapProvider(), b.getHttpPort(), getForwardedUserHeader(b.ClusteerConfig))
+		ldapProxyContainer := ldapProxy.GetContainer()
+		ldapProxyContainer.Lifecycle = getPreStopLifecycle()
+		b.AddContainer(ldapProxyContainer)
+		b.AddVolumes(ldapProxy.GetVolumes())
+	}
 }
 
 func (b *StatefulSetBuilder) Build(ctx context.Context) (ctrlclient.Object, error) {
-	s3LogConfig, err := b.getS3LogConfig(ctx)
+	logDirectory, err := b.getLogDirectory(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	mainContainer := b.getMainContainer(s3LogConfig)
-	b.addS3CrenditialVolume(mainContainer, s3LogConfig)
+	mainContainer := b.getMainContainer(logDirectory)
+	b.addLogDirectoryCredentialsVolume(mainContainer, logDirectory)
+	if err := b.addExtraJars(ctx, mainContainer); err != nil {
+		return nil, err
+	}
+	b.addKerberosVolume(mainContainer)
 	b.addLogVolume(mainContainer)
 	b.addSparkDefaultConfigVolume(mainContainer)
 
-	b.AddContainer(mainContainer.Build())
+	container := mainContainer.Build()
+	container.Lifecycle = getPreStopLifecycle()
+	b.AddContainer(container)
+
+	b.addAuthenticationContainer()
 
-	if b.ClusteerConfig.Authentication != nil && b.ClusteerConfig.Authentication.Oidc != nil {
-		oidcContainer, err := b.getOidcContainer(ctx)
+	// the replicas of a stopped cluster are zero, they are not managed by the autoscaler
+	if b.Config != nil && b.Config.Autoscaling != nil && *b.GetReplicas() != 0 {
+		replicas, err := getAutoscaledReplicas(ctx, b.GetClient(), b.GetName(), b.Config.Autoscaling)
 		if err != nil {
 			return nil, err
 		}
-		b.AddContainer(oidcContainer)
+		b.SetReplicas(replicas)
 	}
 
-	if b.ClusteerConfig != nil && b.ClusteerConfig.VectorAggregatorConfigMapName != "" {
+	if b.isVectorEnabled() {
 		vectorBuilder := builder.NewVector(
 			ConfigVolumeName,
 			LogVolumeName,
@@ -380,6 +526,17 @@ func (b *StatefulSetBuilder) Build(ctx context.Context) (ctrlclient.Object, erro
 	if err != nil {
 		return nil, err
 	}
+
+	if obj.Spec.Template.Spec.TerminationGracePeriodSeconds == nil {
+		obj.Spec.Template.Spec.TerminationGracePeriodSeconds = ptr.To(int64(DefaultGracefulShutdownTimeout.Seconds()))
+	}
+
+	template, err := applyPodOverrides(&obj.Spec.Template, b.PodOverrides...)
+	if err != nil {
+		return nil, err
+	}
+	obj.Spec.Template = *template
+
 	return obj, nil
 }
 
@@ -387,12 +544,14 @@ func NewStatefulSetReconciler(
 	client *resourceClient.Client,
 	roleGroupInfo reconciler.RoleGroupInfo,
 	clusterConfig *shsv1alpha1.ClusterConfigSpec,
+	authentication *Authentication,
 	ports []corev1.ContainerPort,
 	image *oputil.Image,
 	replicas *int32,
 	stopped bool,
 	overrides *commonsv1alpha1.OverridesSpec,
-	roleGroupConfig *commonsv1alpha1.RoleGroupConfigSpec,
+	podOverrides []*runtime.RawExtension,
+	config *shsv1alpha1.ConfigSpec,
 	options ...builder.Option,
 ) (*reconciler.StatefulSet, error) {
 
@@ -400,11 +559,13 @@ func NewStatefulSetReconciler(
 		client,
 		roleGroupInfo.GetFullName(),
 		clusterConfig,
+		authentication,
 		replicas,
 		ports,
 		image,
 		overrides,
-		roleGroupConfig,
+		podOverrides,
+		config,
 		options...,
 	)
 
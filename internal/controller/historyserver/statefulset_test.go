@@ -0,0 +1,99 @@
+package historyserver
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+// renderFixtureStatefulSet returns the StatefulSet of the role group of a golden fixture.
+func renderFixtureStatefulSet(t *testing.T, fixture string, mutate func(*shsv1alpha1.SparkHistoryServer)) *appsv1.StatefulSet {
+	t.Helper()
+	for _, obj := range renderFixture(t, filepath.Join(goldenDir, fixture, goldenInputFile), mutate) {
+		if sts, ok := obj.(*appsv1.StatefulSet); ok {
+			return sts
+		}
+	}
+	t.Fatalf("the fixture %s has no StatefulSet", fixture)
+	return nil
+}
+
+func TestStatefulSetGracefulShutdown(t *testing.T) {
+	for _, fixture := range []string{"reference-bucket", "ldap", "oidc"} {
+		t.Run(fixture, func(t *testing.T) {
+			spec := renderFixtureStatefulSet(t, fixture, nil).Spec.Template.Spec
+
+			want := int64(DefaultGracefulShutdownTimeout.Seconds())
+			if got := spec.TerminationGracePeriodSeconds; got == nil || *got != want {
+				t.Errorf("terminationGracePeriodSeconds = %v, want %d", got, want)
+			}
+
+			for _, container := range spec.Containers {
+				lifecycle := container.Lifecycle
+				switch container.Name {
+				case SparkHistoryContainerName, LdapProxyContainerName:
+					if lifecycle == nil || lifecycle.PreStop == nil || lifecycle.PreStop.Exec == nil {
+						t.Fatalf("container %s lifecycle = %v, want an exec preStop hook", container.Name, lifecycle)
+					}
+					if lifecycle.PreStop.Sleep != nil {
+						t.Errorf("container %s uses the sleep action, it is not served before Kubernetes 1.30", container.Name)
+					}
+					if command := lifecycle.PreStop.Exec.Command; len(command) != 2 || command[0] != "sleep" || command[1] != "5" {
+						t.Errorf("container %s preStop command = %v, want sleep 5", container.Name, command)
+					}
+				case "oidc":
+					if lifecycle != nil {
+						t.Errorf("container %s lifecycle = %v, want none in the distroless image", container.Name, lifecycle)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestStatefulSetProbeScheme pins the HTTP probes, the UI is not served with TLS. The TLS of an Ingress is
+// terminated by the Ingress controller and does not change the scheme of the probes.
+func TestStatefulSetProbeScheme(t *testing.T) {
+	tests := []struct {
+		fixture string
+		mutate  func(*shsv1alpha1.SparkHistoryServer)
+	}{
+		{fixture: "reference-bucket"},
+		{
+			fixture: "ingress-path",
+			mutate: func(instance *shsv1alpha1.SparkHistoryServer) {
+				instance.Spec.Node.Config.Ingress.TLSSecretName = "spark-tls"
+			},
+		},
+		{fixture: "ldap"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			sts := renderFixtureStatefulSet(t, tt.fixture, tt.mutate)
+			for _, container := range sts.Spec.Template.Spec.Containers {
+				if container.Name != SparkHistoryContainerName {
+					continue
+				}
+				for name, probe := range map[string]*corev1.Probe{"startup": container.StartupProbe, "readiness": container.ReadinessProbe} {
+					switch {
+					case probe.HTTPGet != nil:
+						if probe.HTTPGet.Scheme != corev1.URISchemeHTTP {
+							t.Errorf("%s probe scheme = %s, want HTTP", name, probe.HTTPGet.Scheme)
+						}
+					case probe.Exec != nil:
+						if url := probe.Exec.Command[len(probe.Exec.Command)-1]; !strings.HasPrefix(url, "http://") {
+							t.Errorf("%s probe URL = %s, want HTTP", name, url)
+						}
+					default:
+						t.Errorf("%s probe = %v, want an HTTP probe", name, probe)
+					}
+				}
+			}
+		})
+	}
+}
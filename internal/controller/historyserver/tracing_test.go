@@ -0,0 +1,133 @@
+package historyserver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	s3v1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/s3/v1alpha1"
+	"github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	shsv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+	"github.com/zncdatadev/spark-k8s-operator/internal/tracing"
+)
+
+func useInMemoryExporter(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(tracing.NewTracerProvider(sdktrace.NewSimpleSpanProcessor(exporter), 1, resource.Empty()))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return exporter
+}
+
+func newTestClient(t *testing.T) *client.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := shsv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := s3v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return &client.Client{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+		OwnerReference: &shsv1alpha1.SparkHistoryServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "shs", Namespace: "default"},
+		},
+	}
+}
+
+// fakeResource is a resource of a role group recording the span context it is reconciled with.
+type fakeResource struct {
+	reconciler.BaseReconciler[any]
+	err error
+}
+
+func (r *fakeResource) Reconcile(ctx context.Context) (ctrl.Result, error) {
+	_, span := tracing.Start(ctx, "Build")
+	span.End()
+	return ctrl.Result{}, r.err
+}
+
+func spanNames(spans tracetest.SpanStubs) []string {
+	names := make([]string, 0, len(spans))
+	for _, span := range spans {
+		names = append(names, span.Name)
+	}
+	return names
+}
+
+func TestRoleGroupReconcilerSpans(t *testing.T) {
+	exporter := useInMemoryExporter(t)
+	c := newTestClient(t)
+	info := reconciler.RoleGroupInfo{
+		RoleInfo:      reconciler.RoleInfo{ClusterInfo: reconciler.ClusterInfo{ClusterName: "shs"}, RoleName: RoleName},
+		RoleGroupName: "default",
+	}
+	lookupErr := errors.New("lookup failed")
+	r := NewRoleGroupReconciler(c, info, []reconciler.Reconciler{
+		&fakeResource{BaseReconciler: reconciler.BaseReconciler[any]{Client: c}},
+		&fakeResource{BaseReconciler: reconciler.BaseReconciler[any]{Client: c}, err: lookupErr},
+		&fakeResource{BaseReconciler: reconciler.BaseReconciler[any]{Client: c}},
+	})
+
+	if _, err := r.Reconcile(context.Background()); !errors.Is(err, lookupErr) {
+		t.Fatalf("Reconcile() error = %v, want %v", err, lookupErr)
+	}
+
+	spans := exporter.GetSpans()
+	want := []string{"Build", "Resource.Reconcile", "Build", "Resource.Reconcile", "RoleGroup.Reconcile"}
+	got := spanNames(spans)
+	if len(got) != len(want) {
+		t.Fatalf("spans = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("spans = %v, want %v", got, want)
+		}
+	}
+
+	roleGroup := spans[4]
+	for _, i := range []int{1, 3} {
+		if spans[i].Parent.SpanID() != roleGroup.SpanContext.SpanID() {
+			t.Errorf("resource span %d is not a child of the role group span", i)
+		}
+		if spans[i-1].Parent.SpanID() != spans[i].SpanContext.SpanID() {
+			t.Errorf("build span %d is not a child of the resource span", i-1)
+		}
+	}
+	if spans[3].Status.Code != codes.Error || roleGroup.Status.Code != codes.Error {
+		t.Errorf("failed resource and role group spans must have the error status")
+	}
+}
+
+func TestS3BucketLookupSpan(t *testing.T) {
+	exporter := useInMemoryExporter(t)
+	c := newTestClient(t)
+
+	_, err := NewS3Logconfig(context.Background(), c, &shsv1alpha1.S3Spec{
+		Bucket: &shsv1alpha1.BucketSpec{Reference: "missing"},
+	})
+	if !errors.Is(err, ErrS3Resolution) {
+		t.Fatalf("NewS3Logconfig() error = %v, want %v", err, ErrS3Resolution)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "S3Bucket.Get" {
+		t.Fatalf("spans = %v, want S3Bucket.Get", spanNames(spans))
+	}
+	if spans[0].Status.Code != codes.Error {
+		t.Errorf("S3Bucket.Get status = %v, want error", spans[0].Status)
+	}
+}
@@ -0,0 +1,65 @@
+package historyserver
+
+import (
+	"strings"
+
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// getCredentialsAnnotations returns the secret-operator annotations used to request
+// the secret of the given credentials.
+func getCredentialsAnnotations(credentials *commonsv1alpha1.Credentials) map[string]string {
+	annotations := map[string]string{
+		constants.AnnotationSecretsClass: credentials.SecretClass,
+	}
+
+	if credentials.Scope != nil {
+		scopes := []string{}
+		if credentials.Scope.Node {
+			scopes = append(scopes, string(constants.NodeScope))
+		}
+		if credentials.Scope.Pod {
+			scopes = append(scopes, string(constants.PodScope))
+		}
+		scopes = append(scopes, credentials.Scope.Services...)
+
+		annotations[constants.AnnotationSecretsScope] = strings.Join(scopes, constants.CommonDelimiter)
+	}
+
+	return annotations
+}
+
+// newSecretVolume returns an ephemeral volume provisioned by the secret-operator
+// with the given annotations.
+func newSecretVolume(name string, annotations map[string]string) *corev1.Volume {
+	return &corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			Ephemeral: &corev1.EphemeralVolumeSource{
+				VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
+					ObjectMeta: metav1.ObjectMeta{
+						Annotations: annotations,
+					},
+					Spec: corev1.PersistentVolumeClaimSpec{
+						AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+						StorageClassName: constants.SecretStorageClassPtr(),
+						Resources: corev1.VolumeResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceStorage: resource.MustParse("1Mi"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// newCredentialsVolume returns a secret-operator volume which mounts the secret of the given credentials.
+func newCredentialsVolume(name string, credentials *commonsv1alpha1.Credentials) *corev1.Volume {
+	return newSecretVolume(name, getCredentialsAnnotations(credentials))
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2023 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package crd maintains the CustomResourceDefinition of SparkHistoryServer at runtime: the conversion
+// webhook between the API versions and the migration of the stored objects to the storage version.
+package crd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const (
+	// SparkHistoryServerCRDName is the name of the CustomResourceDefinition of SparkHistoryServer.
+	SparkHistoryServerCRDName = "sparkhistoryservers.spark.kubedoop.dev"
+
+	// ConversionPath is the path of the conversion webhook served by controller-runtime.
+	ConversionPath = "/convert"
+
+	// DefaultResyncInterval is the interval at which the conversion webhook is configured again, the
+	// CA is renewed by cert-manager.
+	DefaultResyncInterval = 10 * time.Minute
+
+	retryInterval = 10 * time.Second
+)
+
+var logger = logf.Log.WithName("crd")
+
+var _ manager.LeaderElectionRunnable = &ConversionInjector{}
+
+// ConversionInjector configures the conversion webhook in the CustomResourceDefinition. The service and
+// the CA of the webhook are only known once the operator is deployed, the CRDs of the helm chart are
+// installed as they are. The CRDs are installed with the old version as storage version and the new version
+// not served, the new version is only served and stored once the objects can be converted.
+type ConversionInjector struct {
+	Client  client.Client
+	CRDName string
+	// ServiceNamespace, ServiceName and ServicePort address the Service of the webhook server.
+	ServiceNamespace string
+	ServiceName      string
+	ServicePort      int32
+	// CAFile is the PEM encoded CA of the serving certificate of the webhook server.
+	CAFile         string
+	ResyncInterval time.Duration
+	// StorageVersion is served and made the storage version of the CRD with the conversion webhook.
+	StorageVersion string
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, only the leader patches the CRD.
+func (i *ConversionInjector) NeedLeaderElection() bool {
+	return true
+}
+
+// Start configures the conversion webhook and keeps it up to date until the context is done.
+func (i *ConversionInjector) Start(ctx context.Context) error {
+	interval := i.ResyncInterval
+	if interval <= 0 {
+		interval = DefaultResyncInterval
+	}
+
+	for {
+		// the errors are retried, the certificate may not be mounted yet
+		next := interval
+		if err := i.Inject(ctx); err != nil {
+			logger.Error(err, "failed to configure the conversion webhook", "crd", i.CRDName)
+			next = retryInterval
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(next):
+		}
+	}
+}
+
+// Inject sets the conversion webhook of the CRD, the CRD is only updated when it changed.
+func (i *ConversionInjector) Inject(ctx context.Context) error {
+	caBundle, err := os.ReadFile(i.CAFile)
+	if err != nil {
+		return fmt.Errorf("failed to read the CA of the webhook: %w", err)
+	}
+	if len(bytes.TrimSpace(caBundle)) == 0 {
+		return fmt.Errorf("the CA of the webhook %s is empty", i.CAFile)
+	}
+
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := i.Client.Get(ctx, client.ObjectKey{Name: i.CRDName}, crd); err != nil {
+		return err
+	}
+
+	conversion := i.getConversion(caBundle)
+	versions, err := i.getVersions(crd.Spec.Versions)
+	if err != nil {
+		return err
+	}
+	if crd.Spec.Conversion != nil && equalConversion(crd.Spec.Conversion, conversion) &&
+		equality.Semantic.DeepEqual(crd.Spec.Versions, versions) {
+		return nil
+	}
+
+	// the versions are a list, they are replaced as a whole by the merge patch together with the webhook
+	patch := client.MergeFrom(crd.DeepCopy())
+	crd.Spec.Conversion = conversion
+	crd.Spec.Versions = versions
+	logger.Info("Configuring the conversion webhook", "crd", i.CRDName,
+		"service", i.ServiceNamespace+"/"+i.ServiceName, "storageVersion", i.StorageVersion)
+	return i.Client.Patch(ctx, crd, patch)
+}
+
+// getVersions returns the versions of the CRD with the storage version served and stored, the other
+// versions are kept served but no longer stored.
+func (i *ConversionInjector) getVersions(current []apiextensionsv1.CustomResourceDefinitionVersion) ([]apiextensionsv1.CustomResourceDefinitionVersion, error) {
+	if i.StorageVersion == "" {
+		return current, nil
+	}
+	versions := make([]apiextensionsv1.CustomResourceDefinitionVersion, 0, len(current))
+	found := false
+	for _, version := range current {
+		version = *version.DeepCopy()
+		version.Storage = version.Name == i.StorageVersion
+		if version.Storage {
+			version.Served = true
+			found = true
+		}
+		versions = append(versions, version)
+	}
+	if !found {
+		return nil, fmt.Errorf("the CRD %s has no version %s", i.CRDName, i.StorageVersion)
+	}
+	return versions, nil
+}
+
+func (i *ConversionInjector) getConversion(caBundle []byte) *apiextensionsv1.CustomResourceConversion {
+	return &apiextensionsv1.CustomResourceConversion{
+		Strategy: apiextensionsv1.WebhookConverter,
+		Webhook: &apiextensionsv1.WebhookConversion{
+			ClientConfig: &apiextensionsv1.WebhookClientConfig{
+				Service: &apiextensionsv1.ServiceReference{
+					Namespace: i.ServiceNamespace,
+					Name:      i.ServiceName,
+					Path:      ptr.To(ConversionPath),
+					Port:      ptr.To(i.ServicePort),
+				},
+				CABundle: caBundle,
+			},
+			ConversionReviewVersions: []string{"v1"},
+		},
+	}
+}
+
+func equalConversion(a, b *apiextensionsv1.CustomResourceConversion) bool {
+	if a.Strategy != b.Strategy || a.Webhook == nil || a.Webhook.ClientConfig == nil || a.Webhook.ClientConfig.Service == nil {
+		return false
+	}
+	current, desired := a.Webhook.ClientConfig, b.Webhook.ClientConfig
+	return current.Service.Namespace == desired.Service.Namespace &&
+		current.Service.Name == desired.Service.Name &&
+		ptr.Deref(current.Service.Path, "") == ptr.Deref(desired.Service.Path, "") &&
+		ptr.Deref(current.Service.Port, 443) == ptr.Deref(desired.Service.Port, 443) &&
+		bytes.Equal(current.CABundle, desired.CABundle)
+}
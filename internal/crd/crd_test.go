@@ -0,0 +1,183 @@
+/*
+Copyright 2023 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	sparkv1beta1 "github.com/zncdatadev/spark-k8s-operator/api/v1beta1"
+)
+
+func newCRD(storedVersions ...string) *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: SparkHistoryServerCRDName},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: sparkv1beta1.GroupVersion.Group,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Kind:     "SparkHistoryServer",
+				ListKind: "SparkHistoryServerList",
+			},
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1alpha1", Served: true},
+				{Name: "v1beta1", Served: true, Storage: true},
+			},
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{StoredVersions: storedVersions},
+	}
+}
+
+func newClient(t *testing.T, objs ...client.Object) client.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := apiextensionsv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := sparkv1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objs...).
+		WithStatusSubresource(&apiextensionsv1.CustomResourceDefinition{}).
+		Build()
+}
+
+func TestConversionInjector(t *testing.T) {
+	ctx := context.Background()
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, []byte("ca-1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the CRD is installed with the new version not served
+	crd := newCRD("v1alpha1")
+	crd.Spec.Versions = []apiextensionsv1.CustomResourceDefinitionVersion{
+		{Name: "v1alpha1", Served: true, Storage: true},
+		{Name: "v1beta1", Served: false},
+	}
+	c := newClient(t, crd)
+	injector := &ConversionInjector{
+		Client:           c,
+		CRDName:          SparkHistoryServerCRDName,
+		ServiceNamespace: "kubedoop-operators",
+		ServiceName:      "spark-k8s-operator-webhook",
+		ServicePort:      443,
+		CAFile:           caFile,
+		StorageVersion:   "v1beta1",
+	}
+
+	assertCABundle := func(want string) {
+		t.Helper()
+		if err := injector.Inject(ctx); err != nil {
+			t.Fatalf("Inject() error = %v", err)
+		}
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		if err := c.Get(ctx, client.ObjectKey{Name: SparkHistoryServerCRDName}, crd); err != nil {
+			t.Fatal(err)
+		}
+		conversion := crd.Spec.Conversion
+		if conversion == nil || conversion.Strategy != apiextensionsv1.WebhookConverter {
+			t.Fatalf("Conversion = %+v, want the webhook strategy", conversion)
+		}
+		service := conversion.Webhook.ClientConfig.Service
+		if service.Namespace != "kubedoop-operators" || service.Name != "spark-k8s-operator-webhook" ||
+			*service.Path != ConversionPath {
+			t.Errorf("Service = %+v, want the webhook service", service)
+		}
+		if got := string(conversion.Webhook.ClientConfig.CABundle); got != want {
+			t.Errorf("CABundle = %q, want %q", got, want)
+		}
+		// the new version is only served and stored with the conversion webhook
+		for _, version := range crd.Spec.Versions {
+			if !version.Served || version.Storage != (version.Name == "v1beta1") {
+				t.Errorf("Version %s served = %v storage = %v, want v1beta1 stored and all versions served",
+					version.Name, version.Served, version.Storage)
+			}
+		}
+	}
+
+	assertCABundle("ca-1")
+	// the renewed CA is injected again
+	if err := os.WriteFile(caFile, []byte("ca-2"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	assertCABundle("ca-2")
+
+	injector.CAFile = filepath.Join(t.TempDir(), "missing.crt")
+	if err := injector.Inject(ctx); err == nil {
+		t.Errorf("Inject() succeeded without the CA")
+	}
+}
+
+func TestStorageVersionMigrator(t *testing.T) {
+	ctx := context.Background()
+	instance := &sparkv1beta1.SparkHistoryServer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "history"},
+	}
+
+	crd := newCRD("v1alpha1", "v1beta1")
+	c := newClient(t, crd, instance)
+	migrator := &StorageVersionMigrator{Client: c, Reader: c, CRDName: SparkHistoryServerCRDName}
+
+	// the objects stored in v1alpha1 can not be converted yet
+	if err := migrator.Migrate(ctx); err == nil {
+		t.Fatalf("Migrate() succeeded without the conversion webhook")
+	}
+
+	stored := &sparkv1beta1.SparkHistoryServer{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(instance), stored); err != nil {
+		t.Fatal(err)
+	}
+
+	crd.Spec.Conversion = &apiextensionsv1.CustomResourceConversion{Strategy: apiextensionsv1.WebhookConverter}
+	if err := c.Update(ctx, crd); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	if err := c.Get(ctx, client.ObjectKeyFromObject(crd), crd); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(crd.Status.StoredVersions, []string{"v1beta1"}) {
+		t.Errorf("StoredVersions = %v, want [v1beta1]", crd.Status.StoredVersions)
+	}
+
+	updated := &sparkv1beta1.SparkHistoryServer{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(instance), updated); err != nil {
+		t.Fatal(err)
+	}
+	if updated.ResourceVersion == stored.ResourceVersion {
+		t.Errorf("the history server was not rewritten")
+	}
+
+	// the migration is done once
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Errorf("Migrate() error = %v", err)
+	}
+}
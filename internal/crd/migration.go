@@ -0,0 +1,132 @@
+/*
+Copyright 2023 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const migrationPageSize = 500
+
+var _ manager.LeaderElectionRunnable = &StorageVersionMigrator{}
+
+// StorageVersionMigrator rewrites the stored objects of a CRD in its storage version and then drops the
+// other versions from the stored versions of the CRD, so that they can be removed in a later release.
+type StorageVersionMigrator struct {
+	Client client.Client
+	// Reader lists the objects from the API server, the cache of the manager is not populated for all versions.
+	Reader  client.Reader
+	CRDName string
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, only the leader migrates the objects.
+func (m *StorageVersionMigrator) NeedLeaderElection() bool {
+	return true
+}
+
+// Start migrates the objects, the migration is retried until it succeeds or the context is done.
+func (m *StorageVersionMigrator) Start(ctx context.Context) error {
+	for {
+		err := m.Migrate(ctx)
+		if err == nil {
+			return nil
+		}
+		logger.Error(err, "failed to migrate the storage version", "crd", m.CRDName)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// Migrate rewrites the objects stored in another version than the storage version.
+func (m *StorageVersionMigrator) Migrate(ctx context.Context) error {
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := m.Client.Get(ctx, client.ObjectKey{Name: m.CRDName}, crd); err != nil {
+		return err
+	}
+
+	storageVersion := getStorageVersion(crd)
+	if storageVersion == "" {
+		return fmt.Errorf("the CRD %s has no storage version", m.CRDName)
+	}
+	if slices.Equal(crd.Status.StoredVersions, []string{storageVersion}) {
+		return nil
+	}
+	// the stored objects of the other versions are only valid in the storage version once converted
+	if len(crd.Spec.Versions) > 1 &&
+		(crd.Spec.Conversion == nil || crd.Spec.Conversion.Strategy != apiextensionsv1.WebhookConverter) {
+		return errors.New("the conversion webhook of the CRD is not configured yet")
+	}
+
+	gvk := schema.GroupVersionKind{Group: crd.Spec.Group, Version: storageVersion, Kind: crd.Spec.Names.ListKind}
+	count, err := m.rewriteObjects(ctx, gvk)
+	if err != nil {
+		return err
+	}
+
+	crd.Status.StoredVersions = []string{storageVersion}
+	if err := m.Client.Status().Update(ctx, crd); err != nil {
+		return err
+	}
+	logger.Info("Migrated the storage version", "crd", m.CRDName, "version", storageVersion, "objects", count)
+	return nil
+}
+
+// rewriteObjects updates all objects without changes, the API server writes them in the storage version.
+func (m *StorageVersionMigrator) rewriteObjects(ctx context.Context, listGVK schema.GroupVersionKind) (int, error) {
+	count := 0
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(listGVK)
+	for {
+		if err := m.Reader.List(ctx, list, client.Limit(migrationPageSize), client.Continue(list.GetContinue())); err != nil {
+			return count, err
+		}
+		for i := range list.Items {
+			// a conflict means the object was written since it was listed, it is in the storage version
+			if err := m.Client.Update(ctx, &list.Items[i]); err != nil &&
+				!apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+				return count, err
+			}
+			count++
+		}
+		if list.GetContinue() == "" {
+			return count, nil
+		}
+	}
+}
+
+func getStorageVersion(crd *apiextensionsv1.CustomResourceDefinition) string {
+	for _, version := range crd.Spec.Versions {
+		if version.Storage {
+			return version.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2023 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package manager configures the namespaces, the cache and the work queue of the controller
+// manager from the command line flags.
+package manager
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	DefaultMaxConcurrentReconciles = 1
+	// DefaultRequeueBaseDelay and DefaultRequeueMaxDelay are the defaults of controller-runtime.
+	DefaultRequeueBaseDelay = 5 * time.Millisecond
+	DefaultRequeueMaxDelay  = 1000 * time.Second
+	DefaultSyncPeriod       = 10 * time.Hour
+
+	// the overall rate limit of the work queue, the same as the default of controller-runtime
+	queueQPS   = 10
+	queueBurst = 100
+)
+
+// Options configures the scope and the throughput of the controller.
+type Options struct {
+	// WatchNamespaces is a comma separated list of the namespaces watched, all namespaces when empty.
+	WatchNamespaces string
+	// WatchNamespaceSelector selects the namespaces by label, the history servers of the other
+	// namespaces are ignored. It can not be combined with WatchNamespaces.
+	WatchNamespaceSelector  string
+	MaxConcurrentReconciles int
+	RequeueBaseDelay        time.Duration
+	RequeueMaxDelay         time.Duration
+	// CacheLabelSelector restricts the cached objects owned by the history servers, e.g. the StatefulSets
+	// and Services. The objects created by the operator must match it. Secrets and ConfigMaps are not
+	// restricted, the users provide objects of these kinds too.
+	CacheLabelSelector string
+	SyncPeriod         time.Duration
+}
+
+// BindFlags binds the options to the command line flags.
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.WatchNamespaces, "watch-namespaces", "",
+		"Comma separated list of the namespaces watched by the operator. All namespaces are watched when empty.")
+	fs.StringVar(&o.WatchNamespaceSelector, "watch-namespace-selector", "",
+		"Label selector of the namespaces watched by the operator, e.g. team=data. "+
+			"Can not be combined with --watch-namespaces.")
+	fs.IntVar(&o.MaxConcurrentReconciles, "max-concurrent-reconciles", DefaultMaxConcurrentReconciles,
+		"The maximum number of SparkHistoryServers reconciled concurrently.")
+	fs.DurationVar(&o.RequeueBaseDelay, "requeue-base-delay", DefaultRequeueBaseDelay,
+		"The delay of the first requeue of a failed reconcile, doubled on every failure.")
+	fs.DurationVar(&o.RequeueMaxDelay, "requeue-max-delay", DefaultRequeueMaxDelay,
+		"The maximum delay of the requeue of a failed reconcile.")
+	fs.StringVar(&o.CacheLabelSelector, "cache-label-selector", "",
+		"Label selector of the cached objects owned by the history servers, "+
+			"e.g. app.kubernetes.io/managed-by=spark.kubedoop.dev. All objects are cached when empty. "+
+			"Secrets and ConfigMaps are always cached, they are also provided by the users.")
+	fs.DurationVar(&o.SyncPeriod, "sync-period", DefaultSyncPeriod,
+		"The minimum interval at which the watched SparkHistoryServers are reconciled.")
+}
+
+// Validate checks the combination and the values of the options.
+func (o *Options) Validate() error {
+	if o.WatchNamespaces != "" && o.WatchNamespaceSelector != "" {
+		return errors.New("--watch-namespaces and --watch-namespace-selector can not be combined")
+	}
+	if o.MaxConcurrentReconciles < 1 {
+		return fmt.Errorf("--max-concurrent-reconciles must be at least 1, got %d", o.MaxConcurrentReconciles)
+	}
+	if o.RequeueBaseDelay <= 0 || o.RequeueMaxDelay < o.RequeueBaseDelay {
+		return fmt.Errorf("--requeue-base-delay must be positive and not greater than --requeue-max-delay, got %s and %s",
+			o.RequeueBaseDelay, o.RequeueMaxDelay)
+	}
+	if o.SyncPeriod <= 0 {
+		return fmt.Errorf("--sync-period must be positive, got %s", o.SyncPeriod)
+	}
+	if _, err := o.GetNamespaceSelector(); err != nil {
+		return err
+	}
+	if _, err := parseSelector("--cache-label-selector", o.CacheLabelSelector); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetWatchNamespaces returns the namespaces watched, nil when all namespaces are watched.
+func (o *Options) GetWatchNamespaces() []string {
+	var namespaces []string
+	for namespace := range strings.SplitSeq(o.WatchNamespaces, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// GetNamespaceSelector returns the selector of the watched namespaces, nil when not set.
+func (o *Options) GetNamespaceSelector() (labels.Selector, error) {
+	return parseSelector("--watch-namespace-selector", o.WatchNamespaceSelector)
+}
+
+// CacheOptions returns the cache options of the manager.
+func (o *Options) CacheOptions() (cache.Options, error) {
+	opts := cache.Options{
+		SyncPeriod: &o.SyncPeriod,
+	}
+
+	if namespaces := o.GetWatchNamespaces(); len(namespaces) > 0 {
+		opts.DefaultNamespaces = make(map[string]cache.Config, len(namespaces))
+		for _, namespace := range namespaces {
+			opts.DefaultNamespaces[namespace] = cache.Config{}
+		}
+	}
+
+	selector, err := parseSelector("--cache-label-selector", o.CacheLabelSelector)
+	if err != nil {
+		return cache.Options{}, err
+	}
+	if selector != nil {
+		opts.ByObject = make(map[ctrlclient.Object]cache.ByObject)
+		for _, obj := range getOwnedObjects() {
+			opts.ByObject[obj] = cache.ByObject{Label: selector}
+		}
+	}
+	return opts, nil
+}
+
+// ControllerOptions returns the options of the SparkHistoryServer controller.
+func (o *Options) ControllerOptions() controller.Options {
+	return controller.Options{
+		MaxConcurrentReconciles: o.MaxConcurrentReconciles,
+		RateLimiter: workqueue.NewTypedMaxOfRateLimiter(
+			workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](o.RequeueBaseDelay, o.RequeueMaxDelay),
+			&workqueue.TypedBucketRateLimiter[reconcile.Request]{Limiter: rate.NewLimiter(rate.Limit(queueQPS), queueBurst)},
+		),
+	}
+}
+
+// getOwnedObjects returns the kinds of the objects created for the history servers. The kinds the users
+// also provide objects of are not restricted, they do not carry the labels of the operator: the Secrets,
+// and the ConfigMaps, e.g. the discovery ConfigMap of the vector aggregator.
+func getOwnedObjects() []ctrlclient.Object {
+	return []ctrlclient.Object{
+		&appsv1.StatefulSet{},
+		&batchv1.Job{},
+		&corev1.Service{},
+		&policyv1.PodDisruptionBudget{},
+		&autoscalingv2.HorizontalPodAutoscaler{},
+		&networkingv1.Ingress{},
+		&networkingv1.NetworkPolicy{},
+	}
+}
+
+func parseSelector(flagName, value string) (labels.Selector, error) {
+	if value == "" {
+		return nil, nil
+	}
+	selector, err := labels.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %w", flagName, value, err)
+	}
+	return selector, nil
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2023 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"flag"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// parseOptions parses the flags into options with the defaults of the flags.
+func parseOptions(t *testing.T, args ...string) *Options {
+	t.Helper()
+	opts := &Options{}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	opts.BindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	return opts
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{name: "defaults"},
+		{name: "namespaces", args: []string{"--watch-namespaces=team-a,team-b"}},
+		{name: "namespace selector", args: []string{"--watch-namespace-selector=team in (a,b)"}},
+		{
+			name:    "namespaces and selector",
+			args:    []string{"--watch-namespaces=team-a", "--watch-namespace-selector=team=a"},
+			wantErr: true,
+		},
+		{name: "invalid namespace selector", args: []string{"--watch-namespace-selector=team in (a"}, wantErr: true},
+		{name: "invalid cache selector", args: []string{"--cache-label-selector=!!"}, wantErr: true},
+		{name: "no concurrent reconciles", args: []string{"--max-concurrent-reconciles=0"}, wantErr: true},
+		{
+			name:    "base delay greater than max delay",
+			args:    []string{"--requeue-base-delay=1m", "--requeue-max-delay=1s"},
+			wantErr: true,
+		},
+		{name: "no sync period", args: []string{"--sync-period=0"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseOptions(t, tt.args...).Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetWatchNamespaces(t *testing.T) {
+	opts := parseOptions(t, "--watch-namespaces= team-a, ,team-b")
+	if got, want := opts.GetWatchNamespaces(), []string{"team-a", "team-b"}; !slices.Equal(got, want) {
+		t.Errorf("GetWatchNamespaces() = %v, want %v", got, want)
+	}
+
+	if got := parseOptions(t).GetWatchNamespaces(); got != nil {
+		t.Errorf("GetWatchNamespaces() = %v, want all namespaces", got)
+	}
+}
+
+func TestCacheOptions(t *testing.T) {
+	opts := parseOptions(t,
+		"--watch-namespaces=team-a",
+		"--cache-label-selector=app.kubernetes.io/managed-by=spark.kubedoop.dev",
+		"--sync-period=1h",
+	)
+	cacheOpts, err := opts.CacheOptions()
+	if err != nil {
+		t.Fatalf("CacheOptions() error = %v", err)
+	}
+
+	if _, ok := cacheOpts.DefaultNamespaces["team-a"]; !ok || len(cacheOpts.DefaultNamespaces) != 1 {
+		t.Errorf("DefaultNamespaces = %v, want team-a", cacheOpts.DefaultNamespaces)
+	}
+	if cacheOpts.SyncPeriod == nil || cacheOpts.SyncPeriod.String() != "1h0m0s" {
+		t.Errorf("SyncPeriod = %v, want 1h", cacheOpts.SyncPeriod)
+	}
+
+	managed := labels.Set{"app.kubernetes.io/managed-by": "spark.kubedoop.dev"}
+	for obj, byObject := range cacheOpts.ByObject {
+		switch obj.(type) {
+		case *corev1.Secret, *corev1.ConfigMap:
+			t.Errorf("the %T objects provided by the users must not be restricted", obj)
+		}
+		if byObject.Label == nil || !byObject.Label.Matches(managed) {
+			t.Errorf("ByObject[%T].Label = %v, want the cache label selector", obj, byObject.Label)
+		}
+	}
+	if len(cacheOpts.ByObject) != len(getOwnedObjects()) {
+		t.Errorf("got %d restricted kinds, want %d", len(cacheOpts.ByObject), len(getOwnedObjects()))
+	}
+
+	cacheOpts, err = parseOptions(t).CacheOptions()
+	if err != nil {
+		t.Fatalf("CacheOptions() error = %v", err)
+	}
+	if cacheOpts.DefaultNamespaces != nil || cacheOpts.ByObject != nil {
+		t.Errorf("CacheOptions() = %+v, want all namespaces and objects", cacheOpts)
+	}
+}
+
+func TestControllerOptions(t *testing.T) {
+	opts := parseOptions(t, "--max-concurrent-reconciles=4", "--requeue-base-delay=1s", "--requeue-max-delay=10s")
+	ctrlOpts := opts.ControllerOptions()
+	if ctrlOpts.MaxConcurrentReconciles != 4 {
+		t.Errorf("MaxConcurrentReconciles = %d, want 4", ctrlOpts.MaxConcurrentReconciles)
+	}
+
+	// the failures of an item are backed off exponentially up to the max delay
+	item := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "sparkhistory"}}
+	for _, want := range []string{"1s", "2s", "4s", "8s", "10s", "10s"} {
+		if got := ctrlOpts.RateLimiter.When(item).String(); got != want {
+			t.Errorf("When() = %s, want %s", got, want)
+		}
+	}
+	ctrlOpts.RateLimiter.Forget(item)
+	if got := ctrlOpts.RateLimiter.NumRequeues(item); got != 0 {
+		t.Errorf("NumRequeues() = %d after Forget(), want 0", got)
+	}
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2023 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics provides the business metrics of the operator, they are served together
+// with the controller-runtime metrics on the metrics endpoint of the manager.
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	sparkv1alpha1 "github.com/zncdatadev/spark-k8s-operator/api/v1alpha1"
+)
+
+const (
+	metricsNamespace = "spark_operator"
+
+	StateRunning = "running"
+	StateStopped = "stopped"
+	StatePaused  = "paused"
+
+	ReasonS3             = "s3"
+	ReasonAuthentication = "authentication"
+	ReasonCleaner        = "cleaner"
+	ReasonOther          = "other"
+
+	// listTimeout bounds the list of the history servers during a scrape.
+	listTimeout = 10 * time.Second
+)
+
+var (
+	logger = ctrl.Log.WithName("metrics")
+
+	// ReconcileFailures counts the failed reconciles of history servers by reason.
+	ReconcileFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "reconcile_failures_total",
+			Help:      "Total number of failed SparkHistoryServer reconciles by reason.",
+		},
+		[]string{"reason"},
+	)
+
+	// LastSuccessfulReconcile is the time of the last successful reconcile per history server.
+	LastSuccessfulReconcile = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "last_successful_reconcile_timestamp_seconds",
+			Help:      "Unix time of the last successful reconcile of a SparkHistoryServer.",
+		},
+		[]string{"namespace", "name"},
+	)
+
+	// ImageInfo exposes the image resolved for a history server, the value is always 1.
+	ImageInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "history_server_image_info",
+			Help:      "Image resolved for a SparkHistoryServer.",
+		},
+		[]string{"namespace", "name", "image", "product_version"},
+	)
+)
+
+// RecordReconcileFailure increments the failures of the given reason.
+func RecordReconcileFailure(reason string) {
+	ReconcileFailures.WithLabelValues(reason).Inc()
+}
+
+// RecordReconcileSuccess records the current time as last successful reconcile of the history server.
+func RecordReconcileSuccess(namespace, name string) {
+	LastSuccessfulReconcile.WithLabelValues(namespace, name).SetToCurrentTime()
+}
+
+// SetImage replaces the image of the history server.
+func SetImage(namespace, name, image, productVersion string) {
+	ImageInfo.DeletePartialMatch(prometheus.Labels{"namespace": namespace, "name": name})
+	ImageInfo.WithLabelValues(namespace, name, image, productVersion).Set(1)
+}
+
+// Forget removes the series of a deleted history server.
+func Forget(namespace, name string) {
+	labels := prometheus.Labels{"namespace": namespace, "name": name}
+	LastSuccessfulReconcile.DeletePartialMatch(labels)
+	ImageInfo.DeletePartialMatch(labels)
+}
+
+// GetState returns the state of the history server derived from its cluster operation.
+func GetState(instance *sparkv1alpha1.SparkHistoryServer) string {
+	operation := instance.Spec.ClusterOperation
+	switch {
+	case operation != nil && operation.ReconciliationPaused:
+		return StatePaused
+	case operation != nil && operation.Stopped:
+		return StateStopped
+	default:
+		return StateRunning
+	}
+}
+
+var _ prometheus.Collector = &StateCollector{}
+
+// StateCollector counts the history servers by state when the metrics are scraped,
+// the history servers are listed from the cache of the manager.
+type StateCollector struct {
+	reader ctrlclient.Reader
+	desc   *prometheus.Desc
+}
+
+func NewStateCollector(reader ctrlclient.Reader) *StateCollector {
+	return &StateCollector{
+		reader: reader,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "history_servers"),
+			"Number of managed SparkHistoryServers by state.",
+			[]string{"state"},
+			nil,
+		),
+	}
+}
+
+func (c *StateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *StateCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+	defer cancel()
+
+	list := &sparkv1alpha1.SparkHistoryServerList{}
+	if err := c.reader.List(ctx, list); err != nil {
+		// do not fail the whole scrape, e.g. when the cache is not synced yet
+		logger.Error(err, "Failed to list SparkHistoryServers")
+		return
+	}
+
+	states := map[string]int{StateRunning: 0, StateStopped: 0, StatePaused: 0}
+	for i := range list.Items {
+		states[GetState(&list.Items[i])]++
+	}
+
+	for state, count := range states {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(count), state)
+	}
+}
+
+// Register registers the metrics with the registry of controller-runtime.
+func Register(reader ctrlclient.Reader) error {
+	collectors := []prometheus.Collector{
+		NewStateCollector(reader),
+		ReconcileFailures,
+		LastSuccessfulReconcile,
+		ImageInfo,
+	}
+	for _, collector := range collectors {
+		if err := ctrlmetrics.Registry.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
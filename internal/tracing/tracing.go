@@ -0,0 +1,117 @@
+/*
+Copyright 2023 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing configures the OpenTelemetry tracing of the operator. Tracing is disabled
+// unless an OTLP endpoint is configured, spans are then no-ops.
+package tracing
+
+import (
+	"context"
+	"flag"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	TracerName = "github.com/zncdatadev/spark-k8s-operator"
+
+	DefaultServiceName = "spark-k8s-operator"
+)
+
+// Options configures the OTLP exporter of the operator.
+type Options struct {
+	// Endpoint of the OTLP gRPC receiver, e.g. otel-collector:4317. Tracing is disabled when empty.
+	Endpoint string
+	Insecure bool
+	// SampleRatio is the ratio of the traces sampled when the parent span is not sampled.
+	SampleRatio    float64
+	ServiceName    string
+	ServiceVersion string
+}
+
+// BindFlags binds the options to the command line flags.
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Endpoint, "otlp-endpoint", "",
+		"The OTLP gRPC endpoint the traces are exported to, e.g. otel-collector:4317. Tracing is disabled when empty.")
+	fs.BoolVar(&o.Insecure, "otlp-insecure", false, "If set, the traces are exported without TLS.")
+	fs.Float64Var(&o.SampleRatio, "tracing-sample-ratio", 1, "The ratio of the reconciles traced, between 0 and 1.")
+}
+
+// Setup installs the global tracer provider and returns the function which flushes
+// and stops it. Without endpoint the default no-op tracer provider is kept.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	if opts.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporterOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := opts.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+
+	provider := NewTracerProvider(
+		sdktrace.NewBatchSpanProcessor(exporter),
+		opts.SampleRatio,
+		resource.NewSchemaless(
+			semconv.ServiceName(serviceName),
+			semconv.ServiceVersion(opts.ServiceVersion),
+		),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// NewTracerProvider returns a tracer provider exporting the spans with the processor.
+func NewTracerProvider(processor sdktrace.SpanProcessor, sampleRatio float64, res *resource.Resource) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(res),
+	)
+}
+
+// Start starts a span with the tracer of the operator.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(TracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records the error on the span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
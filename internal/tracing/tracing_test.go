@@ -0,0 +1,89 @@
+/*
+Copyright 2023 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// useInMemoryExporter installs a tracer provider exporting to memory for the test.
+func useInMemoryExporter(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(NewTracerProvider(sdktrace.NewSimpleSpanProcessor(exporter), 1, resource.Empty()))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return exporter
+}
+
+func TestSetupWithoutEndpoint(t *testing.T) {
+	previous := otel.GetTracerProvider()
+
+	shutdown, err := Setup(context.Background(), Options{})
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown() error = %v", err)
+	}
+	if otel.GetTracerProvider() != previous {
+		t.Errorf("Setup() replaced the tracer provider without endpoint")
+	}
+}
+
+func TestStartAndEnd(t *testing.T) {
+	exporter := useInMemoryExporter(t)
+
+	ctx, parent := Start(context.Background(), "parent", attribute.String("name", "shs"))
+	_, child := Start(ctx, "child")
+	End(child, errors.New("lookup failed"))
+	End(parent, nil)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+
+	child0, parent0 := spans[0], spans[1]
+	if child0.Name != "child" || parent0.Name != "parent" {
+		t.Fatalf("got spans %q and %q, want child and parent", child0.Name, parent0.Name)
+	}
+	if child0.Parent.SpanID() != parent0.SpanContext.SpanID() {
+		t.Errorf("child span is not a child of the parent span")
+	}
+	if child0.Status.Code != codes.Error || child0.Status.Description != "lookup failed" {
+		t.Errorf("child status = %v, want error status", child0.Status)
+	}
+	if len(child0.Events) != 1 {
+		t.Errorf("child has %d events, want the recorded error", len(child0.Events))
+	}
+	if parent0.Status.Code != codes.Unset {
+		t.Errorf("parent status = %v, want unset", parent0.Status)
+	}
+	if got := parent0.Attributes; len(got) != 1 || got[0] != attribute.String("name", "shs") {
+		t.Errorf("parent attributes = %v", got)
+	}
+}
@@ -6,11 +6,13 @@ const (
 	HttpPortName   = "http"
 	GrpcPortName   = "grpc"
 	OidcPortName   = "oidc"
+	LdapPortName   = "ldap-proxy"
 	MetricPortName = "metrics"
 	HttpPort       = 18080
 	MetricsPort    = 18081
 	GrpcPort       = 15002
 	OidcPort       = 4180
+	LdapPort       = 4181
 )
 
 // GetMetricsPort returns the metrics port for a given role
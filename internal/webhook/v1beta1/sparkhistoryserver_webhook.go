@@ -0,0 +1,30 @@
+/*
+Copyright 2023 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1beta1 registers the webhooks of the v1beta1 API.
+package v1beta1
+
+import (
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	sparkv1beta1 "github.com/zncdatadev/spark-k8s-operator/api/v1beta1"
+)
+
+// SetupSparkHistoryServerWebhookWithManager registers the conversion webhook of SparkHistoryServer in the
+// manager. v1beta1 is the hub, the other versions implement the conversion to it.
+func SetupSparkHistoryServerWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &sparkv1beta1.SparkHistoryServer{}).Complete()
+}